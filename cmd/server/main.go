@@ -1,31 +1,183 @@
 package main
 
 import (
+	"context"
+	"flag"
+	"log"
 	"net/http"
+	"os"
+	"os/signal"
+	"strings"
+	"syscall"
+	"time"
 
 	"github.com/arfurlaneto/goexpert-challenge-rate-limiter/ratelimiter"
+	"github.com/arfurlaneto/goexpert-challenge-rate-limiter/ratelimiter/metrics"
 	"github.com/go-chi/chi/middleware"
 	"github.com/go-chi/chi/v5"
 	"github.com/joho/godotenv"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
 )
 
+const envFilePath = ".env"
+const startupTimeout = 5 * time.Second
+
 func main() {
-	godotenv.Load(".env")
+	configFile := flag.String("config", "", "path of a JSON or YAML rate limiter configuration file")
+	watchInterval := flag.Duration("watch", 0, "how often the configuration file (or .env) is checked for changes, e.g. 5s; 0 disables it")
+	flag.Parse()
+
+	envs := newEnvFile(envFilePath)
+	envs.load()
 
-	rateLimiter := ratelimiter.NewRateLimiter()
+	config, err := loadConfig(*configFile)
+	if err != nil {
+		log.Fatal(err)
+	}
+	if config == nil {
+		config = &ratelimiter.RateLimiterConfig{}
+	}
+
+	config.Metrics, err = metrics.NewPrometheusMetrics(prometheus.DefaultRegisterer)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), startupTimeout)
+	rateLimiter, err := ratelimiter.NewValidatedReloadableRateLimiter(ctx, config)
+	cancel()
+	if err != nil {
+		log.Fatalf("invalid rate limiter configuration:\n%s", err)
+	}
+
+	go reloadOnSignal(rateLimiter, envs, *configFile)
+	if *watchInterval > 0 {
+		go reloadOnChange(rateLimiter, envs, *configFile, *watchInterval)
+	}
 
 	r := chi.NewRouter()
 
-	r.Use(rateLimiter)
-	r.Use(middleware.Recoverer)
+	// metrics are scraped without going through the rate limiter
+	r.Handle("/metrics", promhttp.Handler())
 
-	r.Get("/", func(w http.ResponseWriter, r *http.Request) {
-		w.WriteHeader(http.StatusOK)
-		w.Write([]byte("OK"))
+	r.Group(func(r chi.Router) {
+		r.Use(rateLimiter.Handler)
+		r.Use(middleware.Recoverer)
+
+		r.Get("/", func(w http.ResponseWriter, r *http.Request) {
+			w.WriteHeader(http.StatusOK)
+			w.Write([]byte("OK"))
+		})
 	})
 
-	err := http.ListenAndServe(":8080", r)
+	err = http.ListenAndServe(":8080", r)
 	if err != nil {
 		panic(err)
 	}
 }
+
+func loadConfig(configFile string) (*ratelimiter.RateLimiterConfig, error) {
+	if configFile == "" {
+		return nil, nil
+	}
+	return ratelimiter.LoadConfigFile(configFile)
+}
+
+// envFile sets the envs of a .env file, keeping the ones already set by the
+// environment, and unsets the envs removed from it when loaded again.
+type envFile struct {
+	path string
+	// keys are the envs set from the file, environmentKeys the ones set
+	// before it was first loaded
+	keys            map[string]bool
+	environmentKeys map[string]bool
+}
+
+func newEnvFile(path string) *envFile {
+	environmentKeys := map[string]bool{}
+	for _, env := range os.Environ() {
+		key, _, _ := strings.Cut(env, "=")
+		environmentKeys[key] = true
+	}
+	return &envFile{path: path, keys: map[string]bool{}, environmentKeys: environmentKeys}
+}
+
+func (f *envFile) load() {
+	values, err := godotenv.Read(f.path)
+	if err != nil {
+		values = map[string]string{}
+	}
+
+	for key := range f.keys {
+		if _, ok := values[key]; !ok {
+			os.Unsetenv(key)
+			delete(f.keys, key)
+		}
+	}
+
+	for key, value := range values {
+		if f.environmentKeys[key] {
+			continue
+		}
+		os.Setenv(key, value)
+		f.keys[key] = true
+	}
+}
+
+// reload reads the .env and configuration files again. Counters and blocks
+// are kept.
+func reload(rateLimiter *ratelimiter.RateLimiter, envs *envFile, configFile string) {
+	envs.load()
+
+	config, err := loadConfig(configFile)
+	if err != nil {
+		log.Printf("reload failed: %s", err)
+		return
+	}
+
+	changes, err := rateLimiter.Reload(config)
+	if err != nil {
+		log.Printf("reload failed: %s", err)
+		return
+	}
+
+	// the changes are logged by the rate limiter
+	if len(changes) == 0 {
+		log.Printf("reloaded, nothing changed")
+	}
+}
+
+func reloadOnSignal(rateLimiter *ratelimiter.RateLimiter, envs *envFile, configFile string) {
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, syscall.SIGHUP)
+	for range signals {
+		reload(rateLimiter, envs, configFile)
+	}
+}
+
+// reloadOnChange polls the modification time of the configuration file, or of
+// the .env file when there is none.
+func reloadOnChange(rateLimiter *ratelimiter.RateLimiter, envs *envFile, configFile string, interval time.Duration) {
+	watchedFile := configFile
+	if watchedFile == "" {
+		watchedFile = envs.path
+	}
+
+	lastModTime := getModTime(watchedFile)
+	for range time.Tick(interval) {
+		modTime := getModTime(watchedFile)
+		if !modTime.Equal(lastModTime) {
+			lastModTime = modTime
+			reload(rateLimiter, envs, configFile)
+		}
+	}
+}
+
+func getModTime(path string) time.Time {
+	info, err := os.Stat(path)
+	if err != nil {
+		return time.Time{}
+	}
+	return info.ModTime()
+}
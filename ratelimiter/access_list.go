@@ -0,0 +1,114 @@
+package ratelimiter
+
+import (
+	"bufio"
+	"fmt"
+	"net/netip"
+	"os"
+	"strings"
+)
+
+type accessListResult int
+
+const (
+	accessListNotListed accessListResult = iota
+	accessListAllowed
+	accessListDenied
+)
+
+// accessList holds the IPs and tokens that bypass the rate limiter or are
+// always rejected. Denials take precedence over allowances.
+type accessList struct {
+	allowedIPs    *prefixTrie
+	deniedIPs     *prefixTrie
+	allowedTokens map[string]bool
+	deniedTokens  map[string]bool
+}
+
+func newAccessList() *accessList {
+	return &accessList{
+		allowedIPs:    newPrefixTrie(),
+		deniedIPs:     newPrefixTrie(),
+		allowedTokens: map[string]bool{},
+		deniedTokens:  map[string]bool{},
+	}
+}
+
+func (l *accessList) check(address netip.Addr, addressOk bool, token string) accessListResult {
+	if l == nil {
+		return accessListNotListed
+	}
+
+	if (addressOk && l.deniedIPs.contains(address)) || (token != "" && l.deniedTokens[token]) {
+		return accessListDenied
+	}
+
+	if (addressOk && l.allowedIPs.contains(address)) || (token != "" && l.allowedTokens[token]) {
+		return accessListAllowed
+	}
+
+	return accessListNotListed
+}
+
+// getDeniedKey returns the key type and key that made check deny a request.
+// The IP wins when both are denied.
+func (l *accessList) getDeniedKey(address netip.Addr, addressOk bool, token string) (string, string) {
+	if addressOk && l.deniedIPs.contains(address) {
+		return "IP", address.String()
+	}
+	return "TOKEN", token
+}
+
+// accessListEntries are the raw entries of an access list, before parsing.
+type accessListEntries struct {
+	allowedIPs    []string
+	deniedIPs     []string
+	allowedTokens []string
+	deniedTokens  []string
+}
+
+// loadAccessListFile reads an access list file. Each line is
+// "<allow|deny> <ip|token> <value>", where ip values are CIDRs or addresses.
+// Empty lines and lines starting with # are ignored.
+func loadAccessListFile(path string) (*accessListEntries, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	entries := &accessListEntries{}
+
+	scanner := bufio.NewScanner(file)
+	for lineNumber := 1; scanner.Scan(); lineNumber++ {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+
+		fields := strings.Fields(line)
+		if len(fields) != 3 {
+			return nil, fmt.Errorf("%s:%d: expected \"<allow|deny> <ip|token> <value>\"", path, lineNumber)
+		}
+
+		switch fields[0] + " " + fields[1] {
+		case "allow ip":
+			entries.allowedIPs = append(entries.allowedIPs, fields[2])
+		case "deny ip":
+			entries.deniedIPs = append(entries.deniedIPs, fields[2])
+		case "allow token":
+			entries.allowedTokens = append(entries.allowedTokens, fields[2])
+		case "deny token":
+			entries.deniedTokens = append(entries.deniedTokens, fields[2])
+		default:
+			return nil, fmt.Errorf("%s:%d: expected \"<allow|deny> <ip|token> <value>\"", path, lineNumber)
+		}
+	}
+
+	err = scanner.Err()
+	if err != nil {
+		return nil, err
+	}
+
+	return entries, nil
+}
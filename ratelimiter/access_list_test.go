@@ -0,0 +1,115 @@
+package ratelimiter
+
+import (
+	"net/netip"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/suite"
+)
+
+type AccessListTestSuite struct {
+	suite.Suite
+}
+
+func TestAccessListTestSuite(t *testing.T) {
+	suite.Run(t, new(AccessListTestSuite))
+}
+
+func (s *AccessListTestSuite) SetupTest() {
+	os.Unsetenv(envAllowedIPs)
+	os.Unsetenv(envDeniedIPs)
+	os.Unsetenv(envAllowedTokens)
+	os.Unsetenv(envDeniedTokens)
+	os.Unsetenv(envAccessListFile)
+	os.Unsetenv(envDeniedStatusCode)
+}
+
+func (s *AccessListTestSuite) TearDownTest() {
+	s.SetupTest()
+}
+
+func (s *AccessListTestSuite) TestCheck() {
+	config := &RateLimiterConfig{
+		AllowedIPs:    []string{"10.0.0.0/8", "2001:db8::/32"},
+		DeniedIPs:     []string{"10.6.6.0/24", "203.0.113.7"},
+		AllowedTokens: []string{"healthcheck"},
+		DeniedTokens:  []string{"stolen"},
+	}
+	configureAccessList(config)
+
+	assert.Equal(s.T(), accessListAllowed, config.accessList.check(netip.MustParseAddr("10.1.2.3"), true, ""))
+	assert.Equal(s.T(), accessListAllowed, config.accessList.check(netip.MustParseAddr("2001:db8::1"), true, ""))
+	assert.Equal(s.T(), accessListAllowed, config.accessList.check(netip.MustParseAddr("198.51.100.1"), true, "healthcheck"))
+	assert.Equal(s.T(), accessListDenied, config.accessList.check(netip.MustParseAddr("10.6.6.6"), true, ""))
+	assert.Equal(s.T(), accessListDenied, config.accessList.check(netip.MustParseAddr("203.0.113.7"), true, "healthcheck"))
+	assert.Equal(s.T(), accessListDenied, config.accessList.check(netip.MustParseAddr("10.1.2.3"), true, "stolen"))
+	assert.Equal(s.T(), accessListNotListed, config.accessList.check(netip.MustParseAddr("198.51.100.1"), true, "other"))
+	assert.Equal(s.T(), accessListNotListed, config.accessList.check(netip.Addr{}, false, ""))
+}
+
+func (s *AccessListTestSuite) TestCheck_Empty() {
+	config := &RateLimiterConfig{}
+	configureAccessList(config)
+
+	assert.Nil(s.T(), config.accessList)
+	assert.Equal(s.T(), accessListNotListed, config.accessList.check(netip.MustParseAddr("10.1.2.3"), true, "abc"))
+}
+
+func (s *AccessListTestSuite) TestCheck_InvalidEntriesAreIgnored() {
+	config := &RateLimiterConfig{DeniedIPs: []string{"not-an-ip", "10.0.0.0/8"}}
+	configureAccessList(config)
+
+	assert.Equal(s.T(), accessListDenied, config.accessList.check(netip.MustParseAddr("10.1.2.3"), true, ""))
+}
+
+func (s *AccessListTestSuite) TestConfigureAccessList_FromEnv() {
+	os.Setenv(envAllowedIPs, "10.0.0.0/8, 192.168.0.1")
+	os.Setenv(envDeniedIPs, "10.6.6.0/24")
+	os.Setenv(envAllowedTokens, "healthcheck")
+	os.Setenv(envDeniedTokens, "stolen,leaked")
+	os.Setenv(envDeniedStatusCode, "451")
+
+	config := &RateLimiterConfig{}
+	configureAccessList(config)
+
+	assert.Equal(s.T(), []string{"10.0.0.0/8", "192.168.0.1"}, config.AllowedIPs)
+	assert.Equal(s.T(), []string{"stolen", "leaked"}, config.DeniedTokens)
+	assert.Equal(s.T(), 451, config.GetDeniedStatusCode())
+	assert.Equal(s.T(), accessListDenied, config.accessList.check(netip.MustParseAddr("10.6.6.6"), true, ""))
+	assert.Equal(s.T(), accessListAllowed, config.accessList.check(netip.MustParseAddr("192.168.0.1"), true, ""))
+}
+
+func (s *AccessListTestSuite) TestConfigureAccessList_File() {
+	path := filepath.Join(s.T().TempDir(), "access-list")
+	os.WriteFile(path, []byte("# internal services\nallow ip 10.0.0.0/8\n\ndeny ip 10.6.6.0/24\nallow token healthcheck\ndeny token stolen\n"), 0644)
+	os.Setenv(envAccessListFile, path)
+
+	config := &RateLimiterConfig{DeniedTokens: []string{"leaked"}}
+	configureAccessList(config)
+
+	assert.Equal(s.T(), []string{"leaked"}, config.DeniedTokens)
+	assert.Equal(s.T(), accessListAllowed, config.accessList.check(netip.MustParseAddr("10.1.2.3"), true, ""))
+	assert.Equal(s.T(), accessListDenied, config.accessList.check(netip.MustParseAddr("10.6.6.6"), true, ""))
+	assert.Equal(s.T(), accessListAllowed, config.accessList.check(netip.MustParseAddr("198.51.100.1"), true, "healthcheck"))
+	assert.Equal(s.T(), accessListDenied, config.accessList.check(netip.MustParseAddr("198.51.100.1"), true, "stolen"))
+	assert.Equal(s.T(), accessListDenied, config.accessList.check(netip.MustParseAddr("198.51.100.1"), true, "leaked"))
+}
+
+func (s *AccessListTestSuite) TestLoadAccessListFile_Invalid() {
+	path := filepath.Join(s.T().TempDir(), "access-list")
+	os.WriteFile(path, []byte("allow ip 10.0.0.0/8\nblock ip 10.6.6.0/24\n"), 0644)
+
+	_, err := loadAccessListFile(path)
+	assert.EqualError(s.T(), err, path+":2: expected \"<allow|deny> <ip|token> <value>\"")
+
+	_, err = loadAccessListFile(filepath.Join(s.T().TempDir(), "missing"))
+	assert.NotNil(s.T(), err)
+}
+
+func (s *AccessListTestSuite) TestGetDeniedStatusCode_DefaultsToForbidden() {
+	config := &RateLimiterConfig{}
+	assert.Equal(s.T(), 403, config.GetDeniedStatusCode())
+}
@@ -1,103 +1,528 @@
 package adapter
 
 import (
+	"container/list"
 	"context"
+	"math"
 	"sync"
 	"time"
 )
 
+const DefaultMemoryCleanupIntervalMilliseconds = 60000
+const DefaultMemoryShards = 64
+
+// RateLimitMemoryStorageAdapterOptions configures the memory storage adapter.
+// A key is one IP or token for one limit, so an IP with extra limits is
+// tracked as several keys.
+type RateLimitMemoryStorageAdapterOptions struct {
+	// CleanupIntervalMilliseconds is how often expired keys are removed.
+	// Zero or less disables the background cleanup.
+	CleanupIntervalMilliseconds int64
+	// MaxKeys is the maximum number of tracked keys. When it is reached, the
+	// least recently used key is evicted. Zero or less means unlimited. The
+	// limit is split between shards, so eviction is per shard, and the
+	// shards never hold more than MaxKeys keys together.
+	MaxKeys int64
+	// Shards is the number of independently locked buckets keys are spread
+	// over. Zero or less uses DefaultMemoryShards. It is lowered to MaxKeys,
+	// so each shard can hold at least one key.
+	Shards int64
+}
+
+// rateLimitMemoryStorageAdapter spreads keys over lock-striped shards, so
+// requests for different IPs or tokens rarely wait for each other. All the
+// limits of an IP or token live in the same shard.
 type rateLimitMemoryStorageAdapter struct {
-	mutexAccesses sync.Mutex
-	mutexBlocks   sync.Mutex
-	accesses      map[string]*map[string]*[]*time.Time
-	blocks        map[string]*map[string]*time.Time
+	options     RateLimitMemoryStorageAdapterOptions
+	shards      []*memoryStorageShard
+	janitorOnce sync.Once
+	closeOnce   sync.Once
+	stop        chan struct{}
+	plansMutex  sync.RWMutex
+	tokenPlans  map[string]string
+	plans       map[string]string
+}
+
+type memoryStorageShard struct {
+	mutex   sync.Mutex
+	entries map[memoryStorageKey]*memoryStorageEntry
+	lru     *list.List
+	maxKeys int64
+}
+
+type memoryStorageKey struct {
+	keyType string
+	key     string
+}
+
+// memoryStorageEntry holds everything stored for a key. It can be removed
+// once expiresAt has passed, as none of its values would be used anymore.
+type memoryStorageEntry struct {
+	storageKey memoryStorageKey
+	accesses   accessRing
+	bucket     *tokenBucket
+	tat        *time.Time
+	block      *time.Time
+	expiresAt  time.Time
+	lruElement *list.Element
+}
+
+// accessRing keeps the accesses of a key in the sliding window, oldest first.
+// It grows up to the maximum accesses of the limit and is reused afterwards.
+type accessRing struct {
+	times []time.Time
+	start int
+	count int
+}
+
+type tokenBucket struct {
+	tokens     float64
+	lastRefill time.Time
 }
 
 func NewRateLimitMemoryStorageAdapter() *rateLimitMemoryStorageAdapter {
+	return NewRateLimitMemoryStorageAdapterWithOptions(RateLimitMemoryStorageAdapterOptions{
+		CleanupIntervalMilliseconds: DefaultMemoryCleanupIntervalMilliseconds,
+	})
+}
+
+// NewRateLimitMemoryStorageAdapterWithOptions creates a memory storage adapter.
+// The cleanup goroutine starts with the first stored key and runs until Close
+// is called.
+func NewRateLimitMemoryStorageAdapterWithOptions(options RateLimitMemoryStorageAdapterOptions) *rateLimitMemoryStorageAdapter {
+	if options.Shards <= 0 {
+		options.Shards = DefaultMemoryShards
+	}
+	if options.MaxKeys > 0 {
+		options.Shards = min(options.Shards, options.MaxKeys)
+	}
+
 	adapter := rateLimitMemoryStorageAdapter{}
-	adapter.mutexAccesses = sync.Mutex{}
-	adapter.mutexBlocks = sync.Mutex{}
-	adapter.accesses = map[string]*map[string]*[]*time.Time{}
-	adapter.blocks = map[string]*map[string]*time.Time{}
+	adapter.options = options
+	adapter.shards = make([]*memoryStorageShard, options.Shards)
+	for i := range adapter.shards {
+		adapter.shards[i] = &memoryStorageShard{
+			entries: map[memoryStorageKey]*memoryStorageEntry{},
+			lru:     list.New(),
+			maxKeys: getShardMaxKeys(options.MaxKeys, options.Shards, int64(i)),
+		}
+	}
+	adapter.stop = make(chan struct{})
+	adapter.tokenPlans = map[string]string{}
+	adapter.plans = map[string]string{}
 	return &adapter
 }
 
+// getShardMaxKeys splits MaxKeys between the shards, giving the remainder to
+// the first ones, so the shard limits add up to MaxKeys.
+func getShardMaxKeys(maxKeys int64, shards int64, shard int64) int64 {
+	if maxKeys <= 0 {
+		return 0
+	}
+	maxKeysPerShard := maxKeys / shards
+	if shard < maxKeys%shards {
+		maxKeysPerShard++
+	}
+	return maxKeysPerShard
+}
+
 func (s *rateLimitMemoryStorageAdapter) IncrementAccesses(ctx context.Context, keyType string, key string, maxAccesses int64) (bool, int64, error) {
-	s.mutexAccesses.Lock()
-	defer s.mutexAccesses.Unlock()
+	return s.IncrementWindowAccesses(ctx, keyType, key, maxAccesses, defaultWindowMilliseconds)
+}
 
-	keyTypeData, ok := s.accesses[keyType]
-	if !ok {
-		keyTypeData = &map[string]*[]*time.Time{}
-		s.accesses[keyType] = keyTypeData
-	}
+func (s *rateLimitMemoryStorageAdapter) IncrementWindowAccesses(ctx context.Context, keyType string, key string, maxAccesses int64, windowMilliseconds int64) (bool, int64, error) {
+	shard := s.getShard(key)
+	shard.mutex.Lock()
+	defer shard.mutex.Unlock()
 
-	keyData, ok := (*keyTypeData)[key]
-	if !ok {
-		keyData = &[]*time.Time{}
-		(*keyTypeData)[key] = keyData
-	}
+	now := time.Now()
+	entry := shard.getEntry(keyType, key, true)
 
-	filteredKeyData, count := s.filterInLastSecond(keyData)
+	window := time.Duration(int64(time.Millisecond) * windowMilliseconds)
+	count := entry.accesses.prune(now, window)
 
 	if count >= maxAccesses {
 		return false, count, nil
 	}
 
-	now := time.Now()
-	updatedKeyData := append(*filteredKeyData, &now)
-	(*keyTypeData)[key] = &updatedKeyData
+	entry.accesses.push(now, maxAccesses)
+	entry.extendExpiration(now.Add(window))
 
 	return true, count + 1, nil
 }
 
-func (s *rateLimitMemoryStorageAdapter) filterInLastSecond(keyData *[]*time.Time) (*[]*time.Time, int64) {
+// CheckAccesses holds the shard lock during the whole decision, so concurrent
+// requests for the same key can never overshoot a limit.
+func (s *rateLimitMemoryStorageAdapter) CheckAccesses(ctx context.Context, key string, limits []AccessLimit) (*AccessCheckResult, error) {
+	shard := s.getShard(key)
+	shard.mutex.Lock()
+	defer shard.mutex.Unlock()
+
 	now := time.Now()
-	filtered := []*time.Time{}
+	result := &AccessCheckResult{BlockedLimit: -1, Counts: make([]int64, len(limits))}
 
-	for _, value := range *keyData {
-		if now.Sub(*value).Seconds() < 1 {
-			filtered = append(filtered, value)
+	for i, limit := range limits {
+		block := shard.getBlock(limit.KeyType, key, now)
+		if block != nil {
+			result.BlockedLimit = i
+			result.Block = block
+			return result, nil
 		}
 	}
 
-	return &filtered, int64(len(filtered))
+	entries := make([]*memoryStorageEntry, len(limits))
+	for i, limit := range limits {
+		entries[i] = shard.getEntry(limit.KeyType, key, true)
+
+		window := time.Duration(int64(time.Millisecond) * limit.WindowMilliseconds)
+		result.Counts[i] = entries[i].accesses.prune(now, window)
+
+		if result.Counts[i] >= limit.MaxAccesses {
+			result.BlockedLimit = i
+			result.Block = shard.addBlock(limit.KeyType, key, limit.BlockMilliseconds, now)
+			return result, nil
+		}
+	}
+
+	for i, limit := range limits {
+		entries[i].accesses.push(now, limit.MaxAccesses)
+		entries[i].extendExpiration(now.Add(time.Duration(int64(time.Millisecond) * limit.WindowMilliseconds)))
+		result.Counts[i]++
+	}
+
+	return result, nil
+}
+
+// prune drops the accesses older than the window and returns how many are left.
+func (r *accessRing) prune(now time.Time, window time.Duration) int64 {
+	for r.count > 0 && now.Sub(r.times[r.start]) >= window {
+		r.times[r.start] = time.Time{}
+		r.start = (r.start + 1) % len(r.times)
+		r.count--
+	}
+	return int64(r.count)
+}
+
+func (r *accessRing) push(now time.Time, maxAccesses int64) {
+	if r.count == len(r.times) {
+		r.grow(max(int64(r.count)+1, min(int64(2*len(r.times)), maxAccesses), 4))
+	}
+	r.times[(r.start+r.count)%len(r.times)] = now
+	r.count++
+}
+
+// pop drops the newest access.
+func (r *accessRing) pop() {
+	if r.count == 0 {
+		return
+	}
+	r.count--
+	r.times[(r.start+r.count)%len(r.times)] = time.Time{}
+}
+
+func (r *accessRing) grow(size int64) {
+	times := make([]time.Time, size)
+	for i := 0; i < r.count; i++ {
+		times[i] = r.times[(r.start+i)%len(r.times)]
+	}
+	r.times = times
+	r.start = 0
+}
+
+func (s *rateLimitMemoryStorageAdapter) ConsumeBucketToken(ctx context.Context, keyType string, key string, capacity int64, refillRatePerSecond int64) (bool, int64, error) {
+	shard := s.getShard(key)
+	shard.mutex.Lock()
+	defer shard.mutex.Unlock()
+
+	now := time.Now()
+	entry := shard.getEntry(keyType, key, true)
+
+	if entry.bucket == nil {
+		entry.bucket = &tokenBucket{tokens: float64(capacity), lastRefill: now}
+	}
+
+	bucket := entry.bucket
+	s.refillBucket(bucket, now, capacity, refillRatePerSecond)
+
+	if refillRatePerSecond > 0 {
+		entry.extendExpiration(now.Add(time.Duration(float64(time.Second) * float64(capacity) / float64(refillRatePerSecond))))
+	}
+
+	if bucket.tokens < 1 {
+		return false, 0, nil
+	}
+
+	bucket.tokens--
+
+	return true, int64(bucket.tokens), nil
+}
+
+func (s *rateLimitMemoryStorageAdapter) refillBucket(bucket *tokenBucket, now time.Time, capacity int64, refillRatePerSecond int64) {
+	elapsed := now.Sub(bucket.lastRefill).Seconds()
+	if elapsed > 0 {
+		bucket.tokens = math.Min(float64(capacity), bucket.tokens+elapsed*float64(refillRatePerSecond))
+	}
+	bucket.lastRefill = now
+}
+
+// ConsumeGCRA applies the generic cell rate algorithm, keeping only the
+// theoretical arrival time (TAT) of the next request for each key.
+func (s *rateLimitMemoryStorageAdapter) ConsumeGCRA(ctx context.Context, keyType string, key string, maxRequests int64, periodMilliseconds int64) (bool, int64, error) {
+	if maxRequests <= 0 {
+		return false, 0, nil
+	}
+
+	emissionInterval, err := getGCRAEmissionInterval(maxRequests, periodMilliseconds)
+	if err != nil {
+		return false, 0, err
+	}
+	period := time.Duration(periodMilliseconds) * time.Millisecond
+
+	shard := s.getShard(key)
+	shard.mutex.Lock()
+	defer shard.mutex.Unlock()
+
+	now := time.Now()
+	entry := shard.getEntry(keyType, key, true)
+
+	tat := now
+	if entry.tat != nil && entry.tat.After(now) {
+		tat = *entry.tat
+	}
+
+	newTAT := tat.Add(emissionInterval)
+	allowAt := newTAT.Add(-period)
+
+	if now.Before(allowAt) {
+		return false, 0, nil
+	}
+
+	entry.tat = &newTAT
+	entry.extendExpiration(newTAT)
+
+	return true, int64(now.Sub(allowAt) / emissionInterval), nil
+}
+
+// RefundAccess removes the newest access of the key.
+func (s *rateLimitMemoryStorageAdapter) RefundAccess(ctx context.Context, keyType string, key string) error {
+	shard := s.getShard(key)
+	shard.mutex.Lock()
+	defer shard.mutex.Unlock()
+
+	entry := shard.getEntry(keyType, key, false)
+	if entry != nil {
+		entry.accesses.pop()
+	}
+	return nil
+}
+
+// RefundBucketToken puts a token back in the bucket of the key.
+func (s *rateLimitMemoryStorageAdapter) RefundBucketToken(ctx context.Context, keyType string, key string, capacity int64) error {
+	shard := s.getShard(key)
+	shard.mutex.Lock()
+	defer shard.mutex.Unlock()
+
+	entry := shard.getEntry(keyType, key, false)
+	if entry != nil && entry.bucket != nil {
+		entry.bucket.tokens = math.Min(float64(capacity), entry.bucket.tokens+1)
+	}
+	return nil
+}
+
+// RefundGCRA moves the theoretical arrival time of the key back by one
+// emission interval.
+func (s *rateLimitMemoryStorageAdapter) RefundGCRA(ctx context.Context, keyType string, key string, maxRequests int64, periodMilliseconds int64) error {
+	if maxRequests <= 0 {
+		return nil
+	}
+
+	emissionInterval, err := getGCRAEmissionInterval(maxRequests, periodMilliseconds)
+	if err != nil {
+		return err
+	}
+
+	shard := s.getShard(key)
+	shard.mutex.Lock()
+	defer shard.mutex.Unlock()
+
+	entry := shard.getEntry(keyType, key, false)
+	if entry != nil && entry.tat != nil {
+		tat := entry.tat.Add(-emissionInterval)
+		entry.tat = &tat
+	}
+	return nil
 }
 
 func (s *rateLimitMemoryStorageAdapter) GetBlock(ctx context.Context, keyType string, key string) (*time.Time, error) {
-	s.mutexBlocks.Lock()
-	defer s.mutexBlocks.Unlock()
+	shard := s.getShard(key)
+	shard.mutex.Lock()
+	defer shard.mutex.Unlock()
 
-	keyTypeData, ok := s.blocks[keyType]
-	if !ok {
-		return nil, nil
+	return shard.getBlock(keyType, key, time.Now()), nil
+}
+
+func (sh *memoryStorageShard) getBlock(keyType string, key string, now time.Time) *time.Time {
+	entry := sh.getEntry(keyType, key, false)
+	if entry == nil || entry.block == nil {
+		return nil
 	}
 
-	blockedUntil, ok := (*keyTypeData)[key]
+	if entry.block.After(now) {
+		return entry.block
+	}
+
+	entry.block = nil
+	return nil
+}
+
+func (s *rateLimitMemoryStorageAdapter) AddBlock(ctx context.Context, keyType string, key string, milliseconds int64) (*time.Time, error) {
+	shard := s.getShard(key)
+	shard.mutex.Lock()
+	defer shard.mutex.Unlock()
+
+	return shard.addBlock(keyType, key, milliseconds, time.Now()), nil
+}
+
+func (sh *memoryStorageShard) addBlock(keyType string, key string, milliseconds int64, now time.Time) *time.Time {
+	entry := sh.getEntry(keyType, key, true)
+
+	blockedUntil := now.Add(time.Duration(int64(time.Millisecond) * milliseconds))
+	entry.block = &blockedUntil
+	entry.extendExpiration(blockedUntil)
+
+	return &blockedUntil
+}
+
+func (s *rateLimitMemoryStorageAdapter) GetTokenPlan(ctx context.Context, token string) (*TokenPlan, error) {
+	s.plansMutex.RLock()
+	defer s.plansMutex.RUnlock()
+
+	plan, ok := s.tokenPlans[token]
 	if !ok {
 		return nil, nil
 	}
+	return &TokenPlan{Name: plan, Limits: s.plans[plan]}, nil
+}
+
+// SetTokenPlan assigns a token to a plan. An empty plan removes the token.
+func (s *rateLimitMemoryStorageAdapter) SetTokenPlan(token string, plan string) {
+	s.plansMutex.Lock()
+	defer s.plansMutex.Unlock()
+
+	if plan == "" {
+		delete(s.tokenPlans, token)
+	} else {
+		s.tokenPlans[token] = plan
+	}
+}
+
+// SetPlan stores the JSON encoded limits of a plan. Empty limits remove it.
+func (s *rateLimitMemoryStorageAdapter) SetPlan(plan string, limits string) {
+	s.plansMutex.Lock()
+	defer s.plansMutex.Unlock()
 
-	if blockedUntil.After(time.Now()) {
-		return blockedUntil, nil
+	if limits == "" {
+		delete(s.plans, plan)
+	} else {
+		s.plans[plan] = limits
 	}
+}
 
-	delete(*keyTypeData, key)
-	return nil, nil
+// Close stops the background cleanup. Stored keys are kept.
+func (s *rateLimitMemoryStorageAdapter) Close() error {
+	s.closeOnce.Do(func() {
+		close(s.stop)
+	})
+	return nil
 }
 
-func (s *rateLimitMemoryStorageAdapter) AddBlock(ctx context.Context, keyType string, key string, milliseconds int64) (*time.Time, error) {
-	s.mutexBlocks.Lock()
-	defer s.mutexBlocks.Unlock()
+// getShard returns the shard of a key (FNV-1a hash) and makes sure the
+// cleanup goroutine is running.
+func (s *rateLimitMemoryStorageAdapter) getShard(key string) *memoryStorageShard {
+	s.janitorOnce.Do(s.startJanitor)
 
-	keyTypeData, ok := s.blocks[keyType]
-	if !ok {
-		keyTypeData = &map[string]*time.Time{}
-		s.blocks[keyType] = keyTypeData
+	hash := uint32(2166136261)
+	for i := 0; i < len(key); i++ {
+		hash ^= uint32(key[i])
+		hash *= 16777619
+	}
+
+	return s.shards[hash%uint32(len(s.shards))]
+}
+
+// getEntry returns the entry of a key, marking it as the most recently used.
+// If create is true, a missing entry is created, evicting the least recently
+// used one of the shard when its share of MaxKeys is reached.
+func (sh *memoryStorageShard) getEntry(keyType string, key string, create bool) *memoryStorageEntry {
+	storageKey := memoryStorageKey{keyType: keyType, key: key}
+
+	entry, ok := sh.entries[storageKey]
+	if ok {
+		sh.lru.MoveToFront(entry.lruElement)
+		return entry
+	}
+
+	if !create {
+		return nil
+	}
+
+	if sh.maxKeys > 0 && int64(len(sh.entries)) >= sh.maxKeys {
+		sh.removeEntry(sh.lru.Back().Value.(*memoryStorageEntry))
 	}
 
-	blockedUntil := time.Now().Add(time.Duration(int64(time.Millisecond) * milliseconds))
-	(*keyTypeData)[key] = &blockedUntil
+	entry = &memoryStorageEntry{storageKey: storageKey}
+	entry.lruElement = sh.lru.PushFront(entry)
+	sh.entries[storageKey] = entry
 
-	return &blockedUntil, nil
+	return entry
+}
+
+func (sh *memoryStorageShard) removeEntry(entry *memoryStorageEntry) {
+	sh.lru.Remove(entry.lruElement)
+	delete(sh.entries, entry.storageKey)
+}
+
+func (e *memoryStorageEntry) extendExpiration(expiresAt time.Time) {
+	if expiresAt.After(e.expiresAt) {
+		e.expiresAt = expiresAt
+	}
+}
+
+func (s *rateLimitMemoryStorageAdapter) startJanitor() {
+	if s.options.CleanupIntervalMilliseconds <= 0 {
+		return
+	}
+
+	ticker := time.NewTicker(time.Duration(int64(time.Millisecond) * s.options.CleanupIntervalMilliseconds))
+
+	go func() {
+		defer ticker.Stop()
+		for {
+			select {
+			case <-s.stop:
+				return
+			case now := <-ticker.C:
+				s.cleanup(now)
+			}
+		}
+	}()
+}
+
+// cleanup removes the keys whose accesses, buckets and blocks have all
+// expired, locking one shard at a time.
+func (s *rateLimitMemoryStorageAdapter) cleanup(now time.Time) {
+	for _, shard := range s.shards {
+		shard.cleanup(now)
+	}
+}
+
+func (sh *memoryStorageShard) cleanup(now time.Time) {
+	sh.mutex.Lock()
+	defer sh.mutex.Unlock()
+
+	for _, entry := range sh.entries {
+		if !entry.expiresAt.After(now) {
+			sh.removeEntry(entry)
+		}
+	}
 }
@@ -0,0 +1,102 @@
+package adapter
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"sync/atomic"
+	"testing"
+)
+
+type benchmarkAdapter struct {
+	name   string
+	create func() RateLimitStorageAdapter
+}
+
+// shardedBenchmarkAdapters are the sharded adapter with a single shard, which
+// has the lock contention of a single mutex, and with the default shards.
+var shardedBenchmarkAdapters = []benchmarkAdapter{
+	{name: "shards=1", create: func() RateLimitStorageAdapter {
+		return newBenchmarkShardedAdapter(1)
+	}},
+	{name: fmt.Sprintf("shards=%d", DefaultMemoryShards), create: func() RateLimitStorageAdapter {
+		return newBenchmarkShardedAdapter(DefaultMemoryShards)
+	}},
+}
+
+// benchmarkAdapters compares the adapter before sharding with the sharded
+// one. Run them with several CPUs to see the lock contention, e.g.
+// go test ./ratelimiter/adapter -run ^$ -bench MemoryStorageAdapter -cpu 1,4,8
+var benchmarkAdapters = append([]benchmarkAdapter{
+	{name: "baseline", create: func() RateLimitStorageAdapter {
+		return newBaselineMemoryStorageAdapter()
+	}},
+}, shardedBenchmarkAdapters...)
+
+func newBenchmarkShardedAdapter(shards int64) *rateLimitMemoryStorageAdapter {
+	return NewRateLimitMemoryStorageAdapterWithOptions(RateLimitMemoryStorageAdapterOptions{
+		CleanupIntervalMilliseconds: DefaultMemoryCleanupIntervalMilliseconds,
+		Shards:                      shards,
+	})
+}
+
+func BenchmarkMemoryStorageAdapter_IncrementAccesses(b *testing.B) {
+	for _, benchmark := range benchmarkAdapters {
+		b.Run(benchmark.name, func(b *testing.B) {
+			ctx := context.Background()
+			storageAdapter := benchmark.create()
+			if closer, ok := storageAdapter.(interface{ Close() error }); ok {
+				defer closer.Close()
+			}
+
+			keys := benchmarkKeys(10000)
+			counter := atomic.Int64{}
+			b.SetParallelism(100)
+			b.ReportAllocs()
+			b.ResetTimer()
+			b.RunParallel(func(pb *testing.PB) {
+				for pb.Next() {
+					key := keys[counter.Add(1)%int64(len(keys))]
+					storageAdapter.IncrementAccesses(ctx, "IP", key, 100)
+				}
+			})
+		})
+	}
+}
+
+// BenchmarkMemoryStorageAdapter_CheckAccesses has no baseline, as the adapter
+// before sharding could not check limits atomically.
+func BenchmarkMemoryStorageAdapter_CheckAccesses(b *testing.B) {
+	limits := []AccessLimit{
+		{KeyType: "IP", MaxAccesses: 100, WindowMilliseconds: 1000, BlockMilliseconds: 1000},
+		{KeyType: "IP:minute", MaxAccesses: 1000, WindowMilliseconds: 60000, BlockMilliseconds: 1000},
+	}
+
+	for _, benchmark := range shardedBenchmarkAdapters {
+		b.Run(benchmark.name, func(b *testing.B) {
+			ctx := context.Background()
+			storageAdapter := benchmark.create().(*rateLimitMemoryStorageAdapter)
+			defer storageAdapter.Close()
+
+			keys := benchmarkKeys(10000)
+			counter := atomic.Int64{}
+			b.SetParallelism(100)
+			b.ReportAllocs()
+			b.ResetTimer()
+			b.RunParallel(func(pb *testing.PB) {
+				for pb.Next() {
+					key := keys[counter.Add(1)%int64(len(keys))]
+					storageAdapter.CheckAccesses(ctx, key, limits)
+				}
+			})
+		})
+	}
+}
+
+func benchmarkKeys(count int) []string {
+	keys := make([]string, count)
+	for i := range keys {
+		keys[i] = "10.0." + strconv.Itoa(i/256) + "." + strconv.Itoa(i%256)
+	}
+	return keys
+}
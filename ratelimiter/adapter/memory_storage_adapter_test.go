@@ -2,7 +2,11 @@ package adapter
 
 import (
 	"context"
+	"fmt"
+	"sync"
+	"sync/atomic"
 	"testing"
+	"time"
 
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/suite"
@@ -118,3 +122,413 @@ func (s *RateLimitMemoryStorageAdapterTestSuite) TestAddBlockGetBlock_ExpiredBlo
 	assert.Nil(s.T(), getBlockResult)
 	assert.NotEqual(s.T(), addBlockResult, getBlockResult)
 }
+
+func (s *RateLimitMemoryStorageAdapterTestSuite) TestConsumeBucketToken() {
+	ctx := s.context
+	keyType := "IP"
+	keyValue := "127.0.0.1"
+
+	storageAdapter := NewRateLimitMemoryStorageAdapter()
+
+	expectedResults := [][]interface{}{
+		{true, int64(2), nil},
+		{true, int64(1), nil},
+		{true, int64(0), nil},
+		{false, int64(0), nil},
+	}
+
+	for _, val := range expectedResults {
+		success, remaining, err := storageAdapter.ConsumeBucketToken(ctx, keyType, keyValue, 3, 1)
+		assert.Equal(s.T(), val[0], success)
+		assert.Equal(s.T(), val[1], remaining)
+		assert.Equal(s.T(), val[2], err)
+	}
+}
+
+func (s *RateLimitMemoryStorageAdapterTestSuite) TestConsumeBucketToken_Refill() {
+	ctx := s.context
+	keyType := "IP"
+	keyValue := "127.0.0.1"
+
+	storageAdapter := NewRateLimitMemoryStorageAdapter()
+
+	success, _, _ := storageAdapter.ConsumeBucketToken(ctx, keyType, keyValue, 1, 100)
+	assert.True(s.T(), success)
+
+	success, _, _ = storageAdapter.ConsumeBucketToken(ctx, keyType, keyValue, 1, 100)
+	assert.False(s.T(), success)
+
+	time.Sleep(15 * time.Millisecond)
+
+	success, _, _ = storageAdapter.ConsumeBucketToken(ctx, keyType, keyValue, 1, 100)
+	assert.True(s.T(), success)
+}
+
+func (s *RateLimitMemoryStorageAdapterTestSuite) TestConsumeGCRA() {
+	ctx := s.context
+	keyType := "IP"
+	keyValue := "127.0.0.1"
+
+	storageAdapter := NewRateLimitMemoryStorageAdapter()
+
+	expectedResults := [][]interface{}{
+		{true, int64(4), nil},
+		{true, int64(3), nil},
+		{true, int64(2), nil},
+		{true, int64(1), nil},
+		{true, int64(0), nil},
+		{false, int64(0), nil},
+	}
+
+	for _, val := range expectedResults {
+		success, remaining, err := storageAdapter.ConsumeGCRA(ctx, keyType, keyValue, 5, 1000)
+		assert.Equal(s.T(), val[0], success)
+		assert.Equal(s.T(), val[1], remaining)
+		assert.Equal(s.T(), val[2], err)
+	}
+
+	assert.Len(s.T(), storedKeys(storageAdapter), 1)
+}
+
+func (s *RateLimitMemoryStorageAdapterTestSuite) TestConsumeGCRA_EmissionInterval() {
+	ctx := s.context
+	keyType := "IP"
+	keyValue := "127.0.0.1"
+
+	storageAdapter := NewRateLimitMemoryStorageAdapter()
+
+	success, _, _ := storageAdapter.ConsumeGCRA(ctx, keyType, keyValue, 1, 10)
+	assert.True(s.T(), success)
+
+	success, _, _ = storageAdapter.ConsumeGCRA(ctx, keyType, keyValue, 1, 10)
+	assert.False(s.T(), success)
+
+	time.Sleep(15 * time.Millisecond)
+
+	success, _, _ = storageAdapter.ConsumeGCRA(ctx, keyType, keyValue, 1, 10)
+	assert.True(s.T(), success)
+}
+
+func (s *RateLimitMemoryStorageAdapterTestSuite) TestConsumeGCRA_HighLimits() {
+	ctx := s.context
+	storageAdapter := NewRateLimitMemoryStorageAdapter()
+
+	for _, maxRequests := range []int64{400000, 800000, 1000000000} {
+		success, remaining, err := storageAdapter.ConsumeGCRA(ctx, "IP", fmt.Sprint(maxRequests), maxRequests, 1000)
+		assert.Nil(s.T(), err)
+		assert.True(s.T(), success)
+		assert.Equal(s.T(), maxRequests-1, remaining)
+	}
+
+	success, _, err := storageAdapter.ConsumeGCRA(ctx, "IP", "127.0.0.1", 1000000001, 1000)
+	assert.ErrorContains(s.T(), err, "more than one request per nanosecond")
+	assert.False(s.T(), success)
+}
+
+func (s *RateLimitMemoryStorageAdapterTestSuite) TestIncrementWindowAccesses() {
+	ctx := s.context
+	keyType := "IP"
+	keyValue := "127.0.0.1"
+
+	storageAdapter := NewRateLimitMemoryStorageAdapter()
+
+	success, _, _ := storageAdapter.IncrementWindowAccesses(ctx, keyType, keyValue, 1, 10)
+	assert.True(s.T(), success)
+
+	success, _, _ = storageAdapter.IncrementWindowAccesses(ctx, keyType, keyValue, 1, 10)
+	assert.False(s.T(), success)
+
+	time.Sleep(15 * time.Millisecond)
+
+	success, count, _ := storageAdapter.IncrementWindowAccesses(ctx, keyType, keyValue, 1, 10)
+	assert.True(s.T(), success)
+	assert.Equal(s.T(), int64(1), count)
+}
+
+func (s *RateLimitMemoryStorageAdapterTestSuite) TestRefundAccess() {
+	ctx := s.context
+	storageAdapter := NewRateLimitMemoryStorageAdapter()
+
+	storageAdapter.IncrementAccesses(ctx, "IP", "127.0.0.1", 2)
+	storageAdapter.IncrementAccesses(ctx, "IP", "127.0.0.1", 2)
+	assert.Nil(s.T(), storageAdapter.RefundAccess(ctx, "IP", "127.0.0.1"))
+	assert.Nil(s.T(), storageAdapter.RefundAccess(ctx, "IP", "127.0.0.2"))
+
+	success, count, err := storageAdapter.IncrementAccesses(ctx, "IP", "127.0.0.1", 2)
+	assert.Nil(s.T(), err)
+	assert.True(s.T(), success)
+	assert.Equal(s.T(), int64(2), count)
+}
+
+func (s *RateLimitMemoryStorageAdapterTestSuite) TestRefundBucketToken() {
+	ctx := s.context
+	storageAdapter := NewRateLimitMemoryStorageAdapter()
+
+	storageAdapter.ConsumeBucketToken(ctx, "IP", "127.0.0.1", 2, 1)
+	assert.Nil(s.T(), storageAdapter.RefundBucketToken(ctx, "IP", "127.0.0.1", 2))
+	assert.Nil(s.T(), storageAdapter.RefundBucketToken(ctx, "IP", "127.0.0.1", 2))
+
+	_, remaining, err := storageAdapter.ConsumeBucketToken(ctx, "IP", "127.0.0.1", 2, 1)
+	assert.Nil(s.T(), err)
+	assert.Equal(s.T(), int64(1), remaining)
+}
+
+func (s *RateLimitMemoryStorageAdapterTestSuite) TestRefundGCRA() {
+	ctx := s.context
+	storageAdapter := NewRateLimitMemoryStorageAdapter()
+
+	for i := 0; i < 3; i++ {
+		storageAdapter.ConsumeGCRA(ctx, "IP", "127.0.0.1", 3, 60000)
+	}
+	assert.Nil(s.T(), storageAdapter.RefundGCRA(ctx, "IP", "127.0.0.1", 3, 60000))
+	assert.Nil(s.T(), storageAdapter.RefundGCRA(ctx, "IP", "127.0.0.2", 3, 60000))
+
+	success, remaining, err := storageAdapter.ConsumeGCRA(ctx, "IP", "127.0.0.1", 3, 60000)
+	assert.Nil(s.T(), err)
+	assert.True(s.T(), success)
+	assert.Equal(s.T(), int64(0), remaining)
+
+	success, _, _ = storageAdapter.ConsumeGCRA(ctx, "IP", "127.0.0.1", 3, 60000)
+	assert.False(s.T(), success)
+}
+
+func (s *RateLimitMemoryStorageAdapterTestSuite) TestCheckAccesses() {
+	ctx := s.context
+	keyValue := "127.0.0.1"
+	limits := []AccessLimit{
+		{KeyType: "IP", MaxAccesses: 5, WindowMilliseconds: 1000, BlockMilliseconds: 1000},
+		{KeyType: "IP:minute", MaxAccesses: 2, WindowMilliseconds: 60000, BlockMilliseconds: 5000},
+	}
+
+	storageAdapter := NewRateLimitMemoryStorageAdapter()
+
+	result, err := storageAdapter.CheckAccesses(ctx, keyValue, limits)
+	assert.Nil(s.T(), err)
+	assert.Equal(s.T(), -1, result.BlockedLimit)
+	assert.Nil(s.T(), result.Block)
+	assert.Equal(s.T(), []int64{1, 1}, result.Counts)
+
+	result, err = storageAdapter.CheckAccesses(ctx, keyValue, limits)
+	assert.Nil(s.T(), err)
+	assert.Equal(s.T(), -1, result.BlockedLimit)
+	assert.Equal(s.T(), []int64{2, 2}, result.Counts)
+
+	result, err = storageAdapter.CheckAccesses(ctx, keyValue, limits)
+	assert.Nil(s.T(), err)
+	assert.Equal(s.T(), 1, result.BlockedLimit)
+	assert.NotNil(s.T(), result.Block)
+	assert.InDelta(s.T(), 5000, time.Until(*result.Block).Milliseconds(), 100)
+
+	blockedUntil := *result.Block
+
+	result, err = storageAdapter.CheckAccesses(ctx, keyValue, limits)
+	assert.Nil(s.T(), err)
+	assert.Equal(s.T(), 1, result.BlockedLimit)
+	assert.True(s.T(), blockedUntil.Equal(*result.Block))
+
+	_, count, _ := storageAdapter.IncrementAccesses(ctx, "IP", keyValue, 5)
+	assert.Equal(s.T(), int64(3), count)
+}
+
+func (s *RateLimitMemoryStorageAdapterTestSuite) TestCheckAccesses_Concurrent() {
+	ctx := s.context
+	keyValue := "127.0.0.1"
+	limits := []AccessLimit{
+		{KeyType: "IP", MaxAccesses: 10, WindowMilliseconds: 60000, BlockMilliseconds: 0},
+	}
+
+	storageAdapter := NewRateLimitMemoryStorageAdapter()
+
+	allowed := atomic.Int64{}
+	wg := sync.WaitGroup{}
+	for i := 0; i < 50; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			result, err := storageAdapter.CheckAccesses(ctx, keyValue, limits)
+			if err == nil && result.BlockedLimit == -1 {
+				allowed.Add(1)
+			}
+		}()
+	}
+	wg.Wait()
+
+	assert.Equal(s.T(), int64(10), allowed.Load())
+}
+
+func (s *RateLimitMemoryStorageAdapterTestSuite) TestCleanup() {
+	ctx := s.context
+
+	storageAdapter := NewRateLimitMemoryStorageAdapterWithOptions(RateLimitMemoryStorageAdapterOptions{})
+
+	storageAdapter.IncrementAccesses(ctx, "IP", "127.0.0.1", 10)
+	storageAdapter.IncrementWindowAccesses(ctx, "IP", "127.0.0.2", 10, 60000)
+	storageAdapter.ConsumeGCRA(ctx, "IP", "127.0.0.3", 10, 1000)
+	storageAdapter.AddBlock(ctx, "IP", "127.0.0.4", 60000)
+	assert.Len(s.T(), storedKeys(storageAdapter), 4)
+
+	storageAdapter.cleanup(time.Now().Add(2 * time.Second))
+
+	assert.ElementsMatch(s.T(), []memoryStorageKey{
+		{keyType: "IP", key: "127.0.0.2"},
+		{keyType: "IP", key: "127.0.0.4"},
+	}, storedKeys(storageAdapter))
+
+	lruLen := 0
+	for _, shard := range storageAdapter.shards {
+		lruLen += shard.lru.Len()
+	}
+	assert.Equal(s.T(), 2, lruLen)
+}
+
+func (s *RateLimitMemoryStorageAdapterTestSuite) TestCleanup_Background() {
+	ctx := s.context
+
+	storageAdapter := NewRateLimitMemoryStorageAdapterWithOptions(RateLimitMemoryStorageAdapterOptions{
+		CleanupIntervalMilliseconds: 5,
+	})
+	defer storageAdapter.Close()
+
+	storageAdapter.IncrementWindowAccesses(ctx, "IP", "127.0.0.1", 10, 1)
+
+	assert.Eventually(s.T(), func() bool {
+		return len(storedKeys(storageAdapter)) == 0
+	}, time.Second, 5*time.Millisecond)
+}
+
+func (s *RateLimitMemoryStorageAdapterTestSuite) TestMaxKeys_EvictsLeastRecentlyUsed() {
+	ctx := s.context
+
+	storageAdapter := NewRateLimitMemoryStorageAdapterWithOptions(RateLimitMemoryStorageAdapterOptions{
+		MaxKeys: 2,
+		Shards:  1,
+	})
+
+	storageAdapter.IncrementAccesses(ctx, "IP", "127.0.0.1", 10)
+	storageAdapter.IncrementAccesses(ctx, "IP", "127.0.0.2", 10)
+	storageAdapter.IncrementAccesses(ctx, "IP", "127.0.0.1", 10)
+	storageAdapter.IncrementAccesses(ctx, "IP", "127.0.0.3", 10)
+
+	assert.ElementsMatch(s.T(), []memoryStorageKey{
+		{keyType: "IP", key: "127.0.0.1"},
+		{keyType: "IP", key: "127.0.0.3"},
+	}, storedKeys(storageAdapter))
+
+	_, count, _ := storageAdapter.IncrementAccesses(ctx, "IP", "127.0.0.1", 10)
+	assert.Equal(s.T(), int64(3), count)
+}
+
+func (s *RateLimitMemoryStorageAdapterTestSuite) TestGetBlock_DoesNotTrackKey() {
+	ctx := s.context
+
+	storageAdapter := NewRateLimitMemoryStorageAdapter()
+
+	block, err := storageAdapter.GetBlock(ctx, "IP", "127.0.0.1")
+	assert.Nil(s.T(), err)
+	assert.Nil(s.T(), block)
+	assert.Empty(s.T(), storedKeys(storageAdapter))
+}
+
+func (s *RateLimitMemoryStorageAdapterTestSuite) TestClose() {
+	ctx := s.context
+
+	storageAdapter := NewRateLimitMemoryStorageAdapter()
+	storageAdapter.IncrementAccesses(ctx, "IP", "127.0.0.1", 10)
+
+	assert.Nil(s.T(), storageAdapter.Close())
+	assert.Nil(s.T(), storageAdapter.Close())
+
+	success, _, err := storageAdapter.IncrementAccesses(ctx, "IP", "127.0.0.1", 10)
+	assert.True(s.T(), success)
+	assert.Nil(s.T(), err)
+}
+
+func (s *RateLimitMemoryStorageAdapterTestSuite) TestShards_MaxKeysIsSplit() {
+	storageAdapter := NewRateLimitMemoryStorageAdapterWithOptions(RateLimitMemoryStorageAdapterOptions{
+		MaxKeys: 10,
+		Shards:  4,
+	})
+
+	maxKeys := []int64{}
+	for _, shard := range storageAdapter.shards {
+		maxKeys = append(maxKeys, shard.maxKeys)
+	}
+	assert.Equal(s.T(), []int64{3, 3, 2, 2}, maxKeys)
+}
+
+func (s *RateLimitMemoryStorageAdapterTestSuite) TestShards_MaxKeysIsGlobal() {
+	storageAdapter := NewRateLimitMemoryStorageAdapterWithOptions(RateLimitMemoryStorageAdapterOptions{
+		MaxKeys: 10,
+	})
+
+	assert.Len(s.T(), storageAdapter.shards, 10)
+
+	for i := 0; i < 1000; i++ {
+		storageAdapter.IncrementAccesses(s.context, "IP", fmt.Sprintf("10.0.%d.%d", i/256, i%256), 10)
+	}
+	assert.LessOrEqual(s.T(), len(storedKeys(storageAdapter)), 10)
+}
+
+func (s *RateLimitMemoryStorageAdapterTestSuite) TestShards_Default() {
+	storageAdapter := NewRateLimitMemoryStorageAdapter()
+
+	assert.Len(s.T(), storageAdapter.shards, DefaultMemoryShards)
+	assert.Same(s.T(), storageAdapter.getShard("127.0.0.1"), storageAdapter.getShard("127.0.0.1"))
+}
+
+func (s *RateLimitMemoryStorageAdapterTestSuite) TestAccessRing() {
+	now := time.Now()
+	ring := accessRing{}
+
+	for i := 0; i < 5; i++ {
+		ring.push(now.Add(time.Duration(i)*time.Millisecond), 6)
+	}
+	assert.Equal(s.T(), int64(5), ring.prune(now.Add(4*time.Millisecond), 10*time.Millisecond))
+	assert.Len(s.T(), ring.times, 6)
+
+	assert.Equal(s.T(), int64(2), ring.prune(now.Add(12*time.Millisecond), 10*time.Millisecond))
+
+	for i := 14; i < 18; i++ {
+		ring.push(now.Add(time.Duration(i)*time.Millisecond), 6)
+	}
+	assert.Len(s.T(), ring.times, 6)
+	assert.Equal(s.T(), int64(6), ring.prune(now.Add(12*time.Millisecond), 10*time.Millisecond))
+	assert.Equal(s.T(), int64(4), ring.prune(now.Add(17*time.Millisecond), 10*time.Millisecond))
+	assert.Equal(s.T(), now.Add(14*time.Millisecond), ring.times[ring.start])
+
+	assert.Equal(s.T(), int64(0), ring.prune(now.Add(time.Second), 10*time.Millisecond))
+}
+
+func storedKeys(storageAdapter *rateLimitMemoryStorageAdapter) []memoryStorageKey {
+	keys := []memoryStorageKey{}
+	for _, shard := range storageAdapter.shards {
+		shard.mutex.Lock()
+		for key := range shard.entries {
+			keys = append(keys, key)
+		}
+		shard.mutex.Unlock()
+	}
+	return keys
+}
+
+func (s *RateLimitMemoryStorageAdapterTestSuite) TestGetTokenPlan() {
+	storageAdapter := NewRateLimitMemoryStorageAdapter()
+
+	tokenPlan, err := storageAdapter.GetTokenPlan(s.context, "abc")
+	assert.Nil(s.T(), err)
+	assert.Nil(s.T(), tokenPlan)
+
+	storageAdapter.SetTokenPlan("abc", "pro")
+	tokenPlan, err = storageAdapter.GetTokenPlan(s.context, "abc")
+	assert.Nil(s.T(), err)
+	assert.Equal(s.T(), &TokenPlan{Name: "pro"}, tokenPlan)
+
+	storageAdapter.SetPlan("pro", `{"maxRequestsPerSecond":50}`)
+	tokenPlan, _ = storageAdapter.GetTokenPlan(s.context, "abc")
+	assert.Equal(s.T(), &TokenPlan{Name: "pro", Limits: `{"maxRequestsPerSecond":50}`}, tokenPlan)
+
+	storageAdapter.SetPlan("pro", "")
+	storageAdapter.SetTokenPlan("abc", "")
+	tokenPlan, _ = storageAdapter.GetTokenPlan(s.context, "abc")
+	assert.Nil(s.T(), tokenPlan)
+}
@@ -3,6 +3,7 @@ package adapter
 import (
 	"context"
 	"fmt"
+	"log/slog"
 	"strconv"
 	"strings"
 	"time"
@@ -10,27 +11,209 @@ import (
 	"github.com/redis/go-redis/v9"
 )
 
+// consumeBucketTokenScript refills the bucket stored at KEYS[1] according to the
+// time elapsed since its last refill and then tries to take one token from it.
+// ARGV: capacity, refill rate per second, current time in microseconds.
+var consumeBucketTokenScript = redis.NewScript(`
+local capacity = tonumber(ARGV[1])
+local refillRate = tonumber(ARGV[2])
+local now = tonumber(ARGV[3])
+
+local bucket = redis.call("HMGET", KEYS[1], "tokens", "timestamp")
+local tokens = tonumber(bucket[1])
+local timestamp = tonumber(bucket[2])
+
+if tokens == nil or timestamp == nil then
+	tokens = capacity
+	timestamp = now
+end
+
+local elapsed = math.max(0, now - timestamp)
+tokens = math.min(capacity, tokens + (elapsed * refillRate / 1000000))
+
+local allowed = 0
+if tokens >= 1 then
+	tokens = tokens - 1
+	allowed = 1
+end
+
+redis.call("HSET", KEYS[1], "tokens", tostring(tokens), "timestamp", string.format("%.0f", now))
+
+if refillRate > 0 then
+	redis.call("PEXPIRE", KEYS[1], math.max(1, math.ceil((capacity - tokens) * 1000 / refillRate)))
+end
+
+return {allowed, math.floor(tokens)}
+`)
+
+// refundBucketTokenScript puts a token back in the bucket stored at KEYS[1].
+// ARGV: capacity.
+var refundBucketTokenScript = redis.NewScript(`
+local tokens = tonumber(redis.call("HGET", KEYS[1], "tokens"))
+if tokens then
+	redis.call("HSET", KEYS[1], "tokens", tostring(math.min(tonumber(ARGV[1]), tokens + 1)))
+end
+return 0
+`)
+
+// consumeGCRAScript applies the generic cell rate algorithm to the theoretical
+// arrival time stored at KEYS[1], which is the only value kept per key. The
+// TAT is stored as microseconds with a nanoseconds fraction, e.g.
+// "1700000000000000.250", and only its difference to the current time is
+// computed, so the nanoseconds stay exact with Lua numbers.
+// ARGV: emission interval and period in nanoseconds, then the current time in
+// microseconds and its nanoseconds.
+var consumeGCRAScript = redis.NewScript(`
+local emissionInterval = tonumber(ARGV[1])
+local period = tonumber(ARGV[2])
+local nowMicro = tonumber(ARGV[3])
+local nowNano = tonumber(ARGV[4])
+
+local tat = 0
+local stored = redis.call("GET", KEYS[1])
+if stored then
+	local micro, fraction = string.match(stored, "^(%d+)%.?(%d*)$")
+	if micro then
+		fraction = string.sub(fraction .. "000", 1, 3)
+		tat = math.max(0, (tonumber(micro) - nowMicro) * 1000 + tonumber(fraction) - nowNano)
+	end
+end
+
+local newTat = tat + emissionInterval
+local allowAt = newTat - period
+
+if allowAt > 0 then
+	return {0, 0}
+end
+
+local nano = nowNano + newTat
+redis.call("SET", KEYS[1], string.format("%.0f.%03d", nowMicro + math.floor(nano / 1000), nano % 1000), "PX", math.max(1, math.ceil(newTat / 1000000)))
+
+return {1, math.floor(-allowAt / emissionInterval)}
+`)
+
+// refundGCRAScript moves the theoretical arrival time stored at KEYS[1] back by
+// one emission interval, keeping its microseconds and nanoseconds format.
+// ARGV: emission interval in nanoseconds.
+var refundGCRAScript = redis.NewScript(`
+local stored = redis.call("GET", KEYS[1])
+if not stored then
+	return 0
+end
+
+local micro, fraction = string.match(stored, "^(%d+)%.?(%d*)$")
+if not micro then
+	return 0
+end
+
+fraction = string.sub(fraction .. "000", 1, 3)
+local nano = tonumber(fraction) - tonumber(ARGV[1])
+redis.call("SET", KEYS[1], string.format("%.0f.%03d", tonumber(micro) + math.floor(nano / 1000), nano % 1000), "KEEPTTL")
+return 0
+`)
+
+// checkAccessesScript takes the whole sliding window decision for a key: it
+// checks the blocks of all limits, prunes and counts their accesses, blocks the
+// first limit that is exceeded or, if none is, adds the access to all of them.
+// KEYS: block key and access key of each limit.
+// ARGV: current time in microseconds, access member, then max accesses,
+// window milliseconds, block milliseconds and block value of each limit.
+var checkAccessesScript = redis.NewScript(`
+local now = tonumber(ARGV[1])
+local member = ARGV[2]
+local limits = #KEYS / 2
+
+for i = 1, limits do
+	local block = redis.call("GET", KEYS[i * 2 - 1])
+	if block then
+		return {i - 1, block}
+	end
+end
+
+local result = {-1, ""}
+for i = 1, limits do
+	local accessKey = KEYS[i * 2]
+	local maxAccesses = tonumber(ARGV[i * 4 - 1])
+	local window = tonumber(ARGV[i * 4])
+
+	redis.call("ZREMRANGEBYSCORE", accessKey, "0", string.format("%.0f", now - window * 1000))
+	local count = redis.call("ZCARD", accessKey)
+
+	if count >= maxAccesses then
+		local blockMilliseconds = tonumber(ARGV[i * 4 + 1])
+		local blockValue = ARGV[i * 4 + 2]
+		if blockMilliseconds > 0 then
+			redis.call("SET", KEYS[i * 2 - 1], blockValue, "PX", blockMilliseconds)
+		end
+		return {i - 1, blockValue}
+	end
+
+	result[i + 2] = count + 1
+end
+
+for i = 1, limits do
+	redis.call("ZADD", KEYS[i * 2], string.format("%.0f", now), member)
+	redis.call("PEXPIRE", KEYS[i * 2], ARGV[i * 4])
+end
+
+return result
+`)
+
+// getTokenPlanScript returns the plan of a token from the hash at KEYS[1] and
+// the limits of that plan from the hash at KEYS[2].
+// ARGV: token.
+var getTokenPlanScript = redis.NewScript(`
+local plan = redis.call("HGET", KEYS[1], ARGV[1])
+if not plan then
+  return {}
+end
+
+local limits = redis.call("HGET", KEYS[2], plan)
+if not limits then
+  return {plan}
+end
+
+return {plan, limits}
+`)
+
+// RedisTokenPlansKey is the hash of token plans, token to plan name, and
+// RedisPlansKey is the hash of plan limits, plan name to JSON encoded limits.
+// They share a hash tag, so they land on the same Redis Cluster slot.
+const RedisTokenPlansKey = "{rate-limiter-plans}-tokens"
+const RedisPlansKey = "{rate-limiter-plans}-limits"
+
 type rateLimitRedisStorageAdapter struct {
-	client *redis.Client
+	client redis.UniversalClient
+	logger *slog.Logger
 }
 
 func NewRateLimitRedisStorageAdapter(address string, password string, db int64) *rateLimitRedisStorageAdapter {
-	adapter := rateLimitRedisStorageAdapter{}
-
-	adapter.client = redis.NewClient(&redis.Options{
+	return NewRateLimitRedisStorageAdapterWithClient(redis.NewClient(&redis.Options{
 		Addr:     address,
 		Password: password,
 		DB:       int(db),
-	})
+	}))
+}
 
+// NewRateLimitRedisStorageAdapterWithClient accepts any Redis client, so a
+// Sentinel managed (redis.NewFailoverClient) or a Cluster
+// (redis.NewClusterClient) deployment can be used.
+func NewRateLimitRedisStorageAdapterWithClient(client redis.UniversalClient) *rateLimitRedisStorageAdapter {
+	adapter := rateLimitRedisStorageAdapter{}
+	adapter.client = client
 	return &adapter
 }
 
 func (s *rateLimitRedisStorageAdapter) IncrementAccesses(ctx context.Context, keyType string, key string, maxAccesses int64) (bool, int64, error) {
+	return s.IncrementWindowAccesses(ctx, keyType, key, maxAccesses, defaultWindowMilliseconds)
+}
+
+func (s *rateLimitRedisStorageAdapter) IncrementWindowAccesses(ctx context.Context, keyType string, key string, maxAccesses int64, windowMilliseconds int64) (bool, int64, error) {
 	redisKey := s.formatRedisKey("access", keyType, key)
 
 	now := time.Now()
-	clearBefore := now.Add(-time.Second)
+	window := time.Duration(int64(time.Millisecond) * windowMilliseconds)
+	clearBefore := now.Add(-window)
 
 	pipeline := s.client.Pipeline()
 
@@ -39,7 +222,7 @@ func (s *rateLimitRedisStorageAdapter) IncrementAccesses(ctx context.Context, ke
 
 	_, err := pipeline.Exec(ctx)
 	if err != nil {
-		logRedisError(err)
+		s.logError(ctx, "IncrementWindowAccesses", err)
 		return false, 0, err
 	}
 
@@ -50,17 +233,133 @@ func (s *rateLimitRedisStorageAdapter) IncrementAccesses(ctx context.Context, ke
 	pipeline = s.client.Pipeline()
 
 	pipeline.ZAdd(ctx, redisKey, redis.Z{Score: float64(now.UnixMicro()), Member: now.Format(time.RFC3339Nano)})
-	pipeline.Expire(ctx, redisKey, time.Second)
+	pipeline.PExpire(ctx, redisKey, window)
 
 	_, err = pipeline.Exec(ctx)
 	if err != nil {
-		logRedisError(err)
+		s.logError(ctx, "IncrementWindowAccesses", err)
 		return false, 0, err
 	}
 
 	return true, count.Val() + 1, nil
 }
 
+func (s *rateLimitRedisStorageAdapter) CheckAccesses(ctx context.Context, key string, limits []AccessLimit) (*AccessCheckResult, error) {
+	now := time.Now()
+
+	keys := []string{}
+	args := []interface{}{now.UnixMicro(), now.Format(time.RFC3339Nano)}
+	for _, limit := range limits {
+		blockedUntil := now.Add(time.Duration(int64(time.Millisecond) * limit.BlockMilliseconds))
+		keys = append(keys, s.formatRedisKey("block", limit.KeyType, key), s.formatRedisKey("access", limit.KeyType, key))
+		args = append(args, limit.MaxAccesses, limit.WindowMilliseconds, limit.BlockMilliseconds, blockedUntil.Format(time.RFC3339Nano))
+	}
+
+	values, err := checkAccessesScript.Run(ctx, s.client, keys, args...).Slice()
+	if err != nil {
+		s.logError(ctx, "CheckAccesses", err)
+		return nil, err
+	}
+
+	result := &AccessCheckResult{BlockedLimit: int(values[0].(int64)), Counts: make([]int64, len(limits))}
+
+	if result.BlockedLimit >= 0 {
+		blockedUntil, err := time.Parse(time.RFC3339Nano, values[1].(string))
+		if err != nil {
+			return nil, err
+		}
+		result.Block = &blockedUntil
+		return result, nil
+	}
+
+	for i := range limits {
+		result.Counts[i] = values[i+2].(int64)
+	}
+
+	return result, nil
+}
+
+func (s *rateLimitRedisStorageAdapter) ConsumeBucketToken(ctx context.Context, keyType string, key string, capacity int64, refillRatePerSecond int64) (bool, int64, error) {
+	redisKey := s.formatRedisKey("bucket", keyType, key)
+
+	now := time.Now()
+
+	result, err := consumeBucketTokenScript.Run(ctx, s.client, []string{redisKey}, capacity, refillRatePerSecond, now.UnixMicro()).Int64Slice()
+	if err != nil {
+		s.logError(ctx, "ConsumeBucketToken", err)
+		return false, 0, err
+	}
+
+	return result[0] == 1, result[1], nil
+}
+
+func (s *rateLimitRedisStorageAdapter) ConsumeGCRA(ctx context.Context, keyType string, key string, maxRequests int64, periodMilliseconds int64) (bool, int64, error) {
+	if maxRequests <= 0 {
+		return false, 0, nil
+	}
+
+	emissionInterval, err := getGCRAEmissionInterval(maxRequests, periodMilliseconds)
+	if err != nil {
+		return false, 0, err
+	}
+	period := time.Duration(periodMilliseconds) * time.Millisecond
+
+	redisKey := s.formatRedisKey("gcra", keyType, key)
+
+	now := time.Now()
+
+	result, err := consumeGCRAScript.Run(ctx, s.client, []string{redisKey}, int64(emissionInterval), int64(period), now.UnixMicro(), now.Nanosecond()%1000).Int64Slice()
+	if err != nil {
+		s.logError(ctx, "ConsumeGCRA", err)
+		return false, 0, err
+	}
+
+	return result[0] == 1, result[1], nil
+}
+
+// RefundAccess removes the newest access of the key.
+func (s *rateLimitRedisStorageAdapter) RefundAccess(ctx context.Context, keyType string, key string) error {
+	redisKey := s.formatRedisKey("access", keyType, key)
+
+	err := s.client.ZPopMax(ctx, redisKey).Err()
+	if err != nil {
+		s.logError(ctx, "RefundAccess", err)
+		return err
+	}
+	return nil
+}
+
+func (s *rateLimitRedisStorageAdapter) RefundBucketToken(ctx context.Context, keyType string, key string, capacity int64) error {
+	redisKey := s.formatRedisKey("bucket", keyType, key)
+
+	err := refundBucketTokenScript.Run(ctx, s.client, []string{redisKey}, capacity).Err()
+	if err != nil {
+		s.logError(ctx, "RefundBucketToken", err)
+		return err
+	}
+	return nil
+}
+
+func (s *rateLimitRedisStorageAdapter) RefundGCRA(ctx context.Context, keyType string, key string, maxRequests int64, periodMilliseconds int64) error {
+	if maxRequests <= 0 {
+		return nil
+	}
+
+	emissionInterval, err := getGCRAEmissionInterval(maxRequests, periodMilliseconds)
+	if err != nil {
+		return err
+	}
+
+	redisKey := s.formatRedisKey("gcra", keyType, key)
+
+	err = refundGCRAScript.Run(ctx, s.client, []string{redisKey}, int64(emissionInterval)).Err()
+	if err != nil {
+		s.logError(ctx, "RefundGCRA", err)
+		return err
+	}
+	return nil
+}
+
 func (s *rateLimitRedisStorageAdapter) GetBlock(ctx context.Context, keyType string, key string) (*time.Time, error) {
 	redisKey := s.formatRedisKey("block", keyType, key)
 
@@ -69,7 +368,7 @@ func (s *rateLimitRedisStorageAdapter) GetBlock(ctx context.Context, keyType str
 		return nil, nil
 	}
 	if err != nil {
-		logRedisError(err)
+		s.logError(ctx, "GetBlock", err)
 		return nil, err
 	}
 
@@ -89,26 +388,61 @@ func (s *rateLimitRedisStorageAdapter) AddBlock(ctx context.Context, keyType str
 
 	_, err := s.client.Set(ctx, redisKey, blockedUntil.Format(time.RFC3339Nano), expiration).Result()
 	if err != nil {
-		logRedisError(err)
+		s.logError(ctx, "AddBlock", err)
 		return nil, err
 	}
 
 	return &blockedUntil, nil
 }
 
+func (s *rateLimitRedisStorageAdapter) GetTokenPlan(ctx context.Context, token string) (*TokenPlan, error) {
+	values, err := getTokenPlanScript.Run(ctx, s.client, []string{RedisTokenPlansKey, RedisPlansKey}, token).StringSlice()
+	if err != nil {
+		s.logError(ctx, "GetTokenPlan", err)
+		return nil, err
+	}
+
+	if len(values) == 0 {
+		return nil, nil
+	}
+
+	tokenPlan := &TokenPlan{Name: values[0]}
+	if len(values) > 1 {
+		tokenPlan.Limits = values[1]
+	}
+	return tokenPlan, nil
+}
+
+// Ping checks that Redis is reachable.
+func (s *rateLimitRedisStorageAdapter) Ping(ctx context.Context) error {
+	return s.client.Ping(ctx).Err()
+}
+
+// Close closes the Redis client.
+func (s *rateLimitRedisStorageAdapter) Close() error {
+	return s.client.Close()
+}
+
+// formatRedisKey wraps the key in a hash tag, so all the keys of an IP or token
+// land on the same Redis Cluster slot and can be used by the same script.
 func (s *rateLimitRedisStorageAdapter) formatRedisKey(prefix string, keyType string, key string) string {
 	return fmt.Sprintf(
-		"%s-%s-%s",
+		"%s-%s-{%s}",
 		strings.ToLower(prefix),
 		strings.ToLower(strings.ReplaceAll(keyType, "-", "_")),
 		key,
 	)
 }
 
-func logRedisError(err error) {
-	fmt.Printf(
-		"%s [REDIS STORAGE ADAPTER] ERROR: %s\n",
-		time.Now().UTC().Format("2006-01-02 15:04:05"),
-		err.Error(),
-	)
+// SetLogger sets the logger of the Redis errors. Defaults to slog.Default().
+func (s *rateLimitRedisStorageAdapter) SetLogger(logger *slog.Logger) {
+	s.logger = logger
+}
+
+func (s *rateLimitRedisStorageAdapter) logError(ctx context.Context, operation string, err error) {
+	logger := s.logger
+	if logger == nil {
+		logger = slog.Default()
+	}
+	logger.ErrorContext(ctx, "redis storage adapter error", "operation", operation, "error", err)
 }
@@ -1,9 +1,18 @@
 package adapter
 
 import (
+	"bytes"
 	"context"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"sync"
+	"sync/atomic"
 	"testing"
+	"time"
 
+	"github.com/alicebob/miniredis/v2"
+	"github.com/redis/go-redis/v9"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/suite"
 )
@@ -11,6 +20,7 @@ import (
 type RateLimitRedisStorageAdapter struct {
 	suite.Suite
 	context context.Context
+	redis   *miniredis.Miniredis
 }
 
 func TestRateLimitRedisStorageAdapter(t *testing.T) {
@@ -19,6 +29,7 @@ func TestRateLimitRedisStorageAdapter(t *testing.T) {
 
 func (s *RateLimitRedisStorageAdapter) SetupTest() {
 	s.context = context.Background()
+	s.redis = miniredis.RunT(s.T())
 }
 
 func (s *RateLimitRedisStorageAdapter) TestNewRateLimitRedisStorageAdapter() {
@@ -29,5 +40,390 @@ func (s *RateLimitRedisStorageAdapter) TestNewRateLimitRedisStorageAdapter() {
 func (s *RateLimitRedisStorageAdapter) TestFormatRedisKey() {
 	storageAdapter := NewRateLimitRedisStorageAdapter("", "", 0)
 	redisKeys := storageAdapter.formatRedisKey("block", "uSeR-ToKeN", "AbC123*#")
-	assert.Equal(s.T(), "block-user_token-AbC123*#", redisKeys)
+	assert.Equal(s.T(), "block-user_token-{AbC123*#}", redisKeys)
+}
+
+func (s *RateLimitRedisStorageAdapter) TestConsumeBucketToken() {
+	ctx := s.context
+	keyType := "IP"
+	keyValue := "127.0.0.1"
+
+	storageAdapter := NewRateLimitRedisStorageAdapter(s.redis.Addr(), "", 0)
+
+	expectedResults := [][]interface{}{
+		{true, int64(2), nil},
+		{true, int64(1), nil},
+		{true, int64(0), nil},
+		{false, int64(0), nil},
+	}
+
+	for _, val := range expectedResults {
+		success, remaining, err := storageAdapter.ConsumeBucketToken(ctx, keyType, keyValue, 3, 1)
+		assert.Equal(s.T(), val[0], success)
+		assert.Equal(s.T(), val[1], remaining)
+		assert.Equal(s.T(), val[2], err)
+	}
+
+	assert.True(s.T(), s.redis.Exists("bucket-ip-{127.0.0.1}"))
+}
+
+func (s *RateLimitRedisStorageAdapter) TestConsumeBucketToken_Refill() {
+	ctx := s.context
+	keyType := "IP"
+	keyValue := "127.0.0.1"
+
+	storageAdapter := NewRateLimitRedisStorageAdapter(s.redis.Addr(), "", 0)
+
+	success, _, _ := storageAdapter.ConsumeBucketToken(ctx, keyType, keyValue, 1, 100)
+	assert.True(s.T(), success)
+
+	success, _, _ = storageAdapter.ConsumeBucketToken(ctx, keyType, keyValue, 1, 100)
+	assert.False(s.T(), success)
+
+	time.Sleep(15 * time.Millisecond)
+
+	success, _, _ = storageAdapter.ConsumeBucketToken(ctx, keyType, keyValue, 1, 100)
+	assert.True(s.T(), success)
+}
+
+func (s *RateLimitRedisStorageAdapter) TestConsumeGCRA() {
+	ctx := s.context
+	keyType := "IP"
+	keyValue := "127.0.0.1"
+
+	storageAdapter := NewRateLimitRedisStorageAdapter(s.redis.Addr(), "", 0)
+
+	expectedResults := [][]interface{}{
+		{true, int64(4), nil},
+		{true, int64(3), nil},
+		{true, int64(2), nil},
+		{true, int64(1), nil},
+		{true, int64(0), nil},
+		{false, int64(0), nil},
+	}
+
+	for _, val := range expectedResults {
+		success, remaining, err := storageAdapter.ConsumeGCRA(ctx, keyType, keyValue, 5, 1000)
+		assert.Equal(s.T(), val[0], success)
+		assert.Equal(s.T(), val[1], remaining)
+		assert.Equal(s.T(), val[2], err)
+	}
+
+	assert.Equal(s.T(), []string{"gcra-ip-{127.0.0.1}"}, s.redis.Keys())
+}
+
+func (s *RateLimitRedisStorageAdapter) TestConsumeGCRA_EmissionInterval() {
+	ctx := s.context
+	keyType := "IP"
+	keyValue := "127.0.0.1"
+
+	storageAdapter := NewRateLimitRedisStorageAdapter(s.redis.Addr(), "", 0)
+
+	success, _, _ := storageAdapter.ConsumeGCRA(ctx, keyType, keyValue, 1, 10)
+	assert.True(s.T(), success)
+
+	success, _, _ = storageAdapter.ConsumeGCRA(ctx, keyType, keyValue, 1, 10)
+	assert.False(s.T(), success)
+
+	time.Sleep(15 * time.Millisecond)
+
+	success, _, _ = storageAdapter.ConsumeGCRA(ctx, keyType, keyValue, 1, 10)
+	assert.True(s.T(), success)
+}
+
+func (s *RateLimitRedisStorageAdapter) TestConsumeGCRA_HighLimits() {
+	ctx := s.context
+	storageAdapter := NewRateLimitRedisStorageAdapter(s.redis.Addr(), "", 0)
+
+	for _, maxRequests := range []int64{400000, 800000, 1000000000} {
+		success, remaining, err := storageAdapter.ConsumeGCRA(ctx, "IP", fmt.Sprint(maxRequests), maxRequests, 1000)
+		assert.Nil(s.T(), err)
+		assert.True(s.T(), success)
+		assert.Equal(s.T(), maxRequests-1, remaining)
+
+		success, remaining, err = storageAdapter.ConsumeGCRA(ctx, "IP", fmt.Sprint(maxRequests), maxRequests, 1000)
+		assert.Nil(s.T(), err)
+		assert.True(s.T(), success)
+		assert.GreaterOrEqual(s.T(), remaining, maxRequests-2)
+		assert.Less(s.T(), remaining, maxRequests)
+	}
+
+	success, _, err := storageAdapter.ConsumeGCRA(ctx, "IP", "127.0.0.1", 1000000001, 1000)
+	assert.ErrorContains(s.T(), err, "more than one request per nanosecond")
+	assert.False(s.T(), success)
+}
+
+func (s *RateLimitRedisStorageAdapter) TestConsumeGCRA_NanosecondsFraction() {
+	ctx := s.context
+	storageAdapter := NewRateLimitRedisStorageAdapter(s.redis.Addr(), "", 0)
+
+	success, _, err := storageAdapter.ConsumeGCRA(ctx, "IP", "127.0.0.1", 3, 1)
+	assert.Nil(s.T(), err)
+	assert.True(s.T(), success)
+
+	value, err := s.redis.Get("gcra-ip-{127.0.0.1}")
+	assert.Nil(s.T(), err)
+	assert.Regexp(s.T(), `^\d+\.\d{3}$`, value)
+
+	// values stored in microseconds only are still read
+	s.redis.Set("gcra-ip-{127.0.0.1}", fmt.Sprint(time.Now().Add(time.Hour).UnixMicro()))
+	success, _, err = storageAdapter.ConsumeGCRA(ctx, "IP", "127.0.0.1", 3, 1)
+	assert.Nil(s.T(), err)
+	assert.False(s.T(), success)
+}
+
+func (s *RateLimitRedisStorageAdapter) TestIncrementAccesses() {
+	ctx := s.context
+	keyType := "IP"
+	keyValue := "127.0.0.1"
+	maxAccesses := 5
+
+	storageAdapter := NewRateLimitRedisStorageAdapter(s.redis.Addr(), "", 0)
+
+	expectedResults := [][]interface{}{
+		{true, int64(1), nil},
+		{true, int64(2), nil},
+		{true, int64(3), nil},
+		{true, int64(4), nil},
+		{true, int64(5), nil},
+		{false, int64(5), nil},
+	}
+
+	for _, val := range expectedResults {
+		success, count, err := storageAdapter.IncrementWindowAccesses(ctx, keyType, keyValue, int64(maxAccesses), 60000)
+		assert.Equal(s.T(), val[0], success)
+		assert.Equal(s.T(), val[1], count)
+		assert.Equal(s.T(), val[2], err)
+	}
+
+	assert.Equal(s.T(), time.Minute, s.redis.TTL("access-ip-{127.0.0.1}"))
+}
+
+func (s *RateLimitRedisStorageAdapter) TestIncrementWindowAccesses() {
+	ctx := s.context
+	keyType := "IP"
+	keyValue := "127.0.0.1"
+
+	storageAdapter := NewRateLimitRedisStorageAdapter(s.redis.Addr(), "", 0)
+
+	success, _, _ := storageAdapter.IncrementWindowAccesses(ctx, keyType, keyValue, 1, 10)
+	assert.True(s.T(), success)
+
+	success, _, _ = storageAdapter.IncrementWindowAccesses(ctx, keyType, keyValue, 1, 10)
+	assert.False(s.T(), success)
+
+	time.Sleep(15 * time.Millisecond)
+
+	success, count, _ := storageAdapter.IncrementWindowAccesses(ctx, keyType, keyValue, 1, 10)
+	assert.True(s.T(), success)
+	assert.Equal(s.T(), int64(1), count)
+}
+
+func (s *RateLimitRedisStorageAdapter) TestRefundAccess() {
+	ctx := s.context
+	storageAdapter := NewRateLimitRedisStorageAdapter(s.redis.Addr(), "", 0)
+
+	storageAdapter.IncrementAccesses(ctx, "IP", "127.0.0.1", 2)
+	storageAdapter.IncrementAccesses(ctx, "IP", "127.0.0.1", 2)
+	assert.Nil(s.T(), storageAdapter.RefundAccess(ctx, "IP", "127.0.0.1"))
+	assert.Nil(s.T(), storageAdapter.RefundAccess(ctx, "IP", "127.0.0.2"))
+
+	success, count, err := storageAdapter.IncrementAccesses(ctx, "IP", "127.0.0.1", 2)
+	assert.Nil(s.T(), err)
+	assert.True(s.T(), success)
+	assert.Equal(s.T(), int64(2), count)
+}
+
+func (s *RateLimitRedisStorageAdapter) TestRefundBucketToken() {
+	ctx := s.context
+	storageAdapter := NewRateLimitRedisStorageAdapter(s.redis.Addr(), "", 0)
+
+	storageAdapter.ConsumeBucketToken(ctx, "IP", "127.0.0.1", 2, 1)
+	assert.Nil(s.T(), storageAdapter.RefundBucketToken(ctx, "IP", "127.0.0.1", 2))
+	assert.Nil(s.T(), storageAdapter.RefundBucketToken(ctx, "IP", "127.0.0.1", 2))
+
+	_, remaining, err := storageAdapter.ConsumeBucketToken(ctx, "IP", "127.0.0.1", 2, 1)
+	assert.Nil(s.T(), err)
+	assert.Equal(s.T(), int64(1), remaining)
+}
+
+func (s *RateLimitRedisStorageAdapter) TestRefundGCRA() {
+	ctx := s.context
+	storageAdapter := NewRateLimitRedisStorageAdapter(s.redis.Addr(), "", 0)
+
+	for i := 0; i < 3; i++ {
+		storageAdapter.ConsumeGCRA(ctx, "IP", "127.0.0.1", 3, 60000)
+	}
+	assert.Nil(s.T(), storageAdapter.RefundGCRA(ctx, "IP", "127.0.0.1", 3, 60000))
+	assert.Nil(s.T(), storageAdapter.RefundGCRA(ctx, "IP", "127.0.0.2", 3, 60000))
+
+	success, remaining, err := storageAdapter.ConsumeGCRA(ctx, "IP", "127.0.0.1", 3, 60000)
+	assert.Nil(s.T(), err)
+	assert.True(s.T(), success)
+	assert.Equal(s.T(), int64(0), remaining)
+
+	success, _, _ = storageAdapter.ConsumeGCRA(ctx, "IP", "127.0.0.1", 3, 60000)
+	assert.False(s.T(), success)
+}
+
+func (s *RateLimitRedisStorageAdapter) TestCheckAccesses() {
+	ctx := s.context
+	keyValue := "127.0.0.1"
+	limits := []AccessLimit{
+		{KeyType: "IP", MaxAccesses: 5, WindowMilliseconds: 1000, BlockMilliseconds: 1000},
+		{KeyType: "IP:minute", MaxAccesses: 2, WindowMilliseconds: 60000, BlockMilliseconds: 5000},
+	}
+
+	storageAdapter := NewRateLimitRedisStorageAdapter(s.redis.Addr(), "", 0)
+
+	result, err := storageAdapter.CheckAccesses(ctx, keyValue, limits)
+	assert.Nil(s.T(), err)
+	assert.Equal(s.T(), -1, result.BlockedLimit)
+	assert.Nil(s.T(), result.Block)
+	assert.Equal(s.T(), []int64{1, 1}, result.Counts)
+
+	result, err = storageAdapter.CheckAccesses(ctx, keyValue, limits)
+	assert.Nil(s.T(), err)
+	assert.Equal(s.T(), -1, result.BlockedLimit)
+	assert.Equal(s.T(), []int64{2, 2}, result.Counts)
+
+	result, err = storageAdapter.CheckAccesses(ctx, keyValue, limits)
+	assert.Nil(s.T(), err)
+	assert.Equal(s.T(), 1, result.BlockedLimit)
+	assert.NotNil(s.T(), result.Block)
+	assert.InDelta(s.T(), 5000, time.Until(*result.Block).Milliseconds(), 100)
+
+	blockedUntil := *result.Block
+
+	result, err = storageAdapter.CheckAccesses(ctx, keyValue, limits)
+	assert.Nil(s.T(), err)
+	assert.Equal(s.T(), 1, result.BlockedLimit)
+	assert.True(s.T(), blockedUntil.Equal(*result.Block))
+
+	_, count, _ := storageAdapter.IncrementAccesses(ctx, "IP", keyValue, 5)
+	assert.Equal(s.T(), int64(3), count)
+}
+
+func (s *RateLimitRedisStorageAdapter) TestCheckAccesses_Concurrent() {
+	ctx := s.context
+	keyValue := "127.0.0.1"
+	limits := []AccessLimit{
+		{KeyType: "IP", MaxAccesses: 10, WindowMilliseconds: 60000, BlockMilliseconds: 0},
+	}
+
+	storageAdapter := NewRateLimitRedisStorageAdapter(s.redis.Addr(), "", 0)
+
+	allowed := atomic.Int64{}
+	wg := sync.WaitGroup{}
+	for i := 0; i < 50; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			result, err := storageAdapter.CheckAccesses(ctx, keyValue, limits)
+			if err == nil && result.BlockedLimit == -1 {
+				allowed.Add(1)
+			}
+		}()
+	}
+	wg.Wait()
+
+	assert.Equal(s.T(), int64(10), allowed.Load())
+}
+
+func (s *RateLimitRedisStorageAdapter) TestNewRateLimitRedisStorageAdapterWithClient_Cluster() {
+	ctx := s.context
+	keyValue := "127.0.0.1"
+	limits := []AccessLimit{
+		{KeyType: "IP", MaxAccesses: 1, WindowMilliseconds: 1000, BlockMilliseconds: 1000},
+		{KeyType: "IP:minute", MaxAccesses: 10, WindowMilliseconds: 60000, BlockMilliseconds: 5000},
+	}
+
+	client := redis.NewClusterClient(&redis.ClusterOptions{Addrs: []string{s.redis.Addr()}})
+	storageAdapter := NewRateLimitRedisStorageAdapterWithClient(client)
+
+	result, err := storageAdapter.CheckAccesses(ctx, keyValue, limits)
+	assert.Nil(s.T(), err)
+	assert.Equal(s.T(), -1, result.BlockedLimit)
+
+	result, err = storageAdapter.CheckAccesses(ctx, keyValue, limits)
+	assert.Nil(s.T(), err)
+	assert.Equal(s.T(), 0, result.BlockedLimit)
+
+	block, err := storageAdapter.GetBlock(ctx, "IP", keyValue)
+	assert.Nil(s.T(), err)
+	assert.NotNil(s.T(), block)
+}
+
+func (s *RateLimitRedisStorageAdapter) TestFormatRedisKey_SameSlotForAllKeysOfAKey() {
+	storageAdapter := NewRateLimitRedisStorageAdapter("", "", 0)
+	keys := []string{
+		storageAdapter.formatRedisKey("block", "IP", "127.0.0.1"),
+		storageAdapter.formatRedisKey("access", "IP", "127.0.0.1"),
+		storageAdapter.formatRedisKey("access", "IP:minute", "127.0.0.1"),
+	}
+
+	client := redis.NewClient(&redis.Options{Addr: s.redis.Addr()})
+	slots := map[int64]bool{}
+	for _, key := range keys {
+		slot, err := client.ClusterKeySlot(s.context, key).Result()
+		assert.Nil(s.T(), err)
+		slots[slot] = true
+	}
+	assert.Len(s.T(), slots, 1)
+}
+
+func (s *RateLimitRedisStorageAdapter) TestGetTokenPlan() {
+	storageAdapter := NewRateLimitRedisStorageAdapter(s.redis.Addr(), "", 0)
+
+	tokenPlan, err := storageAdapter.GetTokenPlan(s.context, "abc")
+	assert.Nil(s.T(), err)
+	assert.Nil(s.T(), tokenPlan)
+
+	s.redis.HSet(RedisTokenPlansKey, "abc", "pro")
+	tokenPlan, err = storageAdapter.GetTokenPlan(s.context, "abc")
+	assert.Nil(s.T(), err)
+	assert.Equal(s.T(), &TokenPlan{Name: "pro"}, tokenPlan)
+
+	s.redis.HSet(RedisPlansKey, "pro", `{"maxRequestsPerSecond":50}`)
+	tokenPlan, err = storageAdapter.GetTokenPlan(s.context, "abc")
+	assert.Nil(s.T(), err)
+	assert.Equal(s.T(), &TokenPlan{Name: "pro", Limits: `{"maxRequestsPerSecond":50}`}, tokenPlan)
+}
+
+func (s *RateLimitRedisStorageAdapter) TestGetTokenPlan_SameSlot() {
+	client := redis.NewClient(&redis.Options{Addr: s.redis.Addr()})
+	tokensSlot, _ := client.ClusterKeySlot(s.context, RedisTokenPlansKey).Result()
+	plansSlot, _ := client.ClusterKeySlot(s.context, RedisPlansKey).Result()
+	assert.Equal(s.T(), tokensSlot, plansSlot)
+}
+
+func (s *RateLimitRedisStorageAdapter) TestPing() {
+	storageAdapter := NewRateLimitRedisStorageAdapter(s.redis.Addr(), "", 0)
+	assert.Nil(s.T(), storageAdapter.Ping(s.context))
+
+	s.redis.Close()
+	assert.NotNil(s.T(), storageAdapter.Ping(s.context))
+}
+
+func (s *RateLimitRedisStorageAdapter) TestClose() {
+	storageAdapter := NewRateLimitRedisStorageAdapter(s.redis.Addr(), "", 0)
+	assert.Nil(s.T(), storageAdapter.Close())
+	assert.ErrorIs(s.T(), storageAdapter.Ping(s.context), redis.ErrClosed)
+}
+
+func (s *RateLimitRedisStorageAdapter) TestLogError() {
+	output := &bytes.Buffer{}
+	storageAdapter := NewRateLimitRedisStorageAdapter(s.redis.Addr(), "", 0)
+	storageAdapter.SetLogger(slog.New(slog.NewJSONHandler(output, nil)))
+
+	s.redis.Close()
+	_, err := storageAdapter.GetBlock(s.context, "IP", "127.0.0.1")
+	assert.NotNil(s.T(), err)
+
+	record := map[string]any{}
+	assert.Nil(s.T(), json.Unmarshal(output.Bytes(), &record))
+	assert.Equal(s.T(), "ERROR", record["level"])
+	assert.Equal(s.T(), "redis storage adapter error", record["msg"])
+	assert.Equal(s.T(), "GetBlock", record["operation"])
+	assert.NotEmpty(s.T(), record["error"])
 }
@@ -2,11 +2,102 @@ package adapter
 
 import (
 	"context"
+	"fmt"
 	"time"
 )
 
+// defaultWindowMilliseconds is the window of IncrementAccesses.
+const defaultWindowMilliseconds = 1000
+
 type RateLimitStorageAdapter interface {
 	IncrementAccesses(ctx context.Context, keyType string, key string, maxAccesses int64) (bool, int64, error)
 	GetBlock(ctx context.Context, keyType string, key string) (*time.Time, error)
 	AddBlock(ctx context.Context, keyType string, key string, milliseconds int64) (*time.Time, error)
 }
+
+// RateLimitWindowStorageAdapter is implemented by storage adapters whose
+// sliding window can be longer or shorter than the one second of
+// IncrementAccesses.
+type RateLimitWindowStorageAdapter interface {
+	RateLimitStorageAdapter
+	IncrementWindowAccesses(ctx context.Context, keyType string, key string, maxAccesses int64, windowMilliseconds int64) (bool, int64, error)
+}
+
+// RateLimitBucketStorageAdapter is implemented by storage adapters that
+// support the token bucket algorithm.
+type RateLimitBucketStorageAdapter interface {
+	RateLimitStorageAdapter
+	ConsumeBucketToken(ctx context.Context, keyType string, key string, capacity int64, refillRatePerSecond int64) (bool, int64, error)
+}
+
+// RateLimitGCRAStorageAdapter is implemented by storage adapters that support
+// the generic cell rate algorithm.
+type RateLimitGCRAStorageAdapter interface {
+	RateLimitStorageAdapter
+	ConsumeGCRA(ctx context.Context, keyType string, key string, maxRequests int64, periodMilliseconds int64) (bool, int64, error)
+}
+
+// RateLimitRefundStorageAdapter is implemented by storage adapters that can
+// give back a request a limit allowed, so that a request rejected by another
+// limit of the same key uses none of its quota. Each method undoes one
+// successful IncrementAccesses (or IncrementWindowAccesses), ConsumeBucketToken
+// or ConsumeGCRA call.
+type RateLimitRefundStorageAdapter interface {
+	RateLimitStorageAdapter
+	RefundAccess(ctx context.Context, keyType string, key string) error
+	RefundBucketToken(ctx context.Context, keyType string, key string, capacity int64) error
+	RefundGCRA(ctx context.Context, keyType string, key string, maxRequests int64, periodMilliseconds int64) error
+}
+
+// RateLimitAtomicStorageAdapter is implemented by storage adapters that can
+// take the whole sliding window decision for a key in a single operation.
+type RateLimitAtomicStorageAdapter interface {
+	RateLimitStorageAdapter
+	CheckAccesses(ctx context.Context, key string, limits []AccessLimit) (*AccessCheckResult, error)
+}
+
+// AccessLimit is one sliding window limit checked by CheckAccesses. KeyType
+// identifies its counters and blocks.
+type AccessLimit struct {
+	KeyType            string
+	MaxAccesses        int64
+	WindowMilliseconds int64
+	BlockMilliseconds  int64
+}
+
+// AccessCheckResult is returned by CheckAccesses. If the key is blocked,
+// BlockedLimit is the index of the limit holding the block, otherwise -1 and
+// Counts holds the accesses of each limit, including the current one.
+type AccessCheckResult struct {
+	BlockedLimit int
+	Block        *time.Time
+	Counts       []int64
+}
+
+// RateLimitPlanStorageAdapter is implemented by storage adapters that also
+// keep rate limit plans and the plan of each token, so they can be changed
+// without restarting the servers.
+type RateLimitPlanStorageAdapter interface {
+	RateLimitStorageAdapter
+	GetTokenPlan(ctx context.Context, token string) (*TokenPlan, error)
+}
+
+// TokenPlan is the plan of a token. Limits is the JSON encoded rate config of
+// the plan, or empty if the plan is not stored, in which case it is looked up
+// by Name in the configured plans.
+type TokenPlan struct {
+	Name   string
+	Limits string
+}
+
+// getGCRAEmissionInterval returns the time between two requests of a GCRA
+// limit, in nanoseconds, so that high limits are not rounded. Limits of more
+// than one request per nanosecond cannot be represented.
+func getGCRAEmissionInterval(maxRequests int64, periodMilliseconds int64) (time.Duration, error) {
+	period := time.Duration(periodMilliseconds) * time.Millisecond
+	emissionInterval := period / time.Duration(maxRequests)
+	if emissionInterval <= 0 {
+		return 0, fmt.Errorf("gcra limit of %d requests per %d milliseconds is more than one request per nanosecond", maxRequests, periodMilliseconds)
+	}
+	return emissionInterval, nil
+}
@@ -0,0 +1,182 @@
+package ratelimiter
+
+import (
+	"fmt"
+	"net"
+	"net/http"
+	"net/netip"
+	"strings"
+)
+
+// unknownClientIP is the IP key of requests whose address cannot be parsed.
+// They are limited together instead of not being limited at all.
+const unknownClientIP = "unknown"
+
+// getClientIPKey returns the IP key of a client resolved by resolveClientIP:
+// its address aggregated to the configured IPv4 or IPv6 prefix.
+func getClientIPKey(config *RateLimiterConfig, address netip.Addr, ok bool) string {
+	if !ok {
+		config.GetLogger().Debug("could not parse the client address", "ip", unknownClientIP)
+		return unknownClientIP
+	}
+	return getIPKey(config, address)
+}
+
+// getIPKey masks an address to the configured prefix length. Full length
+// prefixes keep the plain address, e.g. "203.0.113.7" or "2001:db8::/64".
+func getIPKey(config *RateLimiterConfig, address netip.Addr) string {
+	prefixLength := config.GetIPv6PrefixLength()
+	if address.Is4() {
+		prefixLength = config.GetIPv4PrefixLength()
+	}
+
+	if int(prefixLength) == address.BitLen() {
+		return address.String()
+	}
+
+	prefix, _ := address.Prefix(int(prefixLength))
+	return prefix.String()
+}
+
+// resolveClientIP returns the IP of the client. Forwarding headers are only
+// read when the peer is a trusted proxy. They are walked from the right,
+// skipping trusted proxies, for at most TrustedProxyHops addresses.
+func resolveClientIP(config *RateLimiterConfig, r *http.Request) (netip.Addr, bool) {
+	peer, ok := parseRemoteAddr(r.RemoteAddr)
+	if !ok {
+		return netip.Addr{}, false
+	}
+
+	if !isTrustedProxy(config, peer) {
+		return peer, true
+	}
+
+	client := peer
+	forwardedFor := getForwardedFor(r)
+	for hop := 1; hop <= len(forwardedFor); hop++ {
+		address, ok := parseForwardedAddress(forwardedFor[len(forwardedFor)-hop])
+		if !ok {
+			break
+		}
+
+		client = address
+		if !isTrustedProxy(config, address) {
+			break
+		}
+		if config.TrustedProxyHops > 0 && int64(hop) >= config.TrustedProxyHops {
+			break
+		}
+	}
+
+	return client, true
+}
+
+func parseRemoteAddr(remoteAddr string) (netip.Addr, bool) {
+	host, _, err := net.SplitHostPort(remoteAddr)
+	if err != nil {
+		host = remoteAddr
+	}
+
+	address, err := netip.ParseAddr(host)
+	if err != nil {
+		return netip.Addr{}, false
+	}
+	return address.Unmap().WithZone(""), true
+}
+
+func isTrustedProxy(config *RateLimiterConfig, address netip.Addr) bool {
+	for _, prefix := range config.trustedProxyPrefixes {
+		if prefix.Contains(address) {
+			return true
+		}
+	}
+	return false
+}
+
+// getForwardedFor returns the addresses a request was forwarded for, closest
+// to the client first. Forwarded is preferred, then X-Forwarded-For and then
+// X-Real-IP.
+func getForwardedFor(r *http.Request) []string {
+	forwarded := r.Header.Values("Forwarded")
+	if len(forwarded) > 0 {
+		return parseForwardedHeader(forwarded)
+	}
+
+	xForwardedFor := r.Header.Values("X-Forwarded-For")
+	if len(xForwardedFor) > 0 {
+		addresses := []string{}
+		for _, value := range xForwardedFor {
+			for _, address := range strings.Split(value, ",") {
+				addresses = append(addresses, strings.TrimSpace(address))
+			}
+		}
+		return addresses
+	}
+
+	xRealIP := r.Header.Get("X-Real-IP")
+	if xRealIP != "" {
+		return []string{strings.TrimSpace(xRealIP)}
+	}
+
+	return []string{}
+}
+
+// parseForwardedHeader returns the "for" parameters of RFC 7239 Forwarded
+// headers, e.g. `for=192.0.2.60;proto=http, for="[2001:db8::17]:4711"`.
+// Elements without "for" are kept as empty addresses, so they stop the walk.
+func parseForwardedHeader(values []string) []string {
+	addresses := []string{}
+	for _, value := range values {
+		for _, element := range strings.Split(value, ",") {
+			address := ""
+			for _, pair := range strings.Split(element, ";") {
+				key, value, _ := strings.Cut(strings.TrimSpace(pair), "=")
+				if strings.EqualFold(key, "for") {
+					address = strings.Trim(value, "\"")
+				}
+			}
+			addresses = append(addresses, address)
+		}
+	}
+	return addresses
+}
+
+// parseForwardedAddress parses an address with an optional port, and IPv6
+// addresses in brackets. Obfuscated identifiers like "unknown" are invalid.
+func parseForwardedAddress(value string) (netip.Addr, bool) {
+	addrPort, err := netip.ParseAddrPort(value)
+	if err == nil {
+		return addrPort.Addr().Unmap().WithZone(""), true
+	}
+
+	address, err := netip.ParseAddr(strings.TrimSuffix(strings.TrimPrefix(value, "["), "]"))
+	if err != nil {
+		return netip.Addr{}, false
+	}
+	return address.Unmap().WithZone(""), true
+}
+
+// parsePrefixes parses CIDRs and single addresses.
+func parsePrefixes(values []string) ([]netip.Prefix, error) {
+	prefixes := []netip.Prefix{}
+	for _, value := range values {
+		value = strings.TrimSpace(value)
+
+		if strings.Contains(value, "/") {
+			prefix, err := netip.ParsePrefix(value)
+			if err != nil {
+				return nil, fmt.Errorf("invalid CIDR \"%s\"", value)
+			}
+			prefixes = append(prefixes, prefix.Masked())
+			continue
+		}
+
+		address, err := netip.ParseAddr(value)
+		if err != nil {
+			return nil, fmt.Errorf("invalid address \"%s\"", value)
+		}
+		address = address.Unmap()
+		prefixes = append(prefixes, netip.PrefixFrom(address, address.BitLen()))
+	}
+	return prefixes, nil
+}
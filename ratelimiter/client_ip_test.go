@@ -0,0 +1,215 @@
+package ratelimiter
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/suite"
+)
+
+type ClientIPTestSuite struct {
+	suite.Suite
+}
+
+func TestClientIPTestSuite(t *testing.T) {
+	suite.Run(t, new(ClientIPTestSuite))
+}
+
+func (s *ClientIPTestSuite) SetupTest() {
+	os.Unsetenv(envTrustedProxies)
+	os.Unsetenv(envTrustedProxyHops)
+	os.Unsetenv(envIPv4PrefixLength)
+	os.Unsetenv(envIPv6PrefixLength)
+}
+
+func (s *ClientIPTestSuite) TestGetClientIPKey_IPv6Prefix() {
+	request := httptest.NewRequest("GET", "http://testing", nil)
+	request.RemoteAddr = "[2001:db8:1:2:3:4:5:6]:1234"
+
+	assert.Equal(s.T(), "2001:db8:1:2::/64", s.getClientIPKey(s.newConfig(nil, 0), request))
+
+	config := s.newConfig(nil, 0)
+	config.IPv6PrefixLength = 48
+	assert.Equal(s.T(), "2001:db8:1::/48", s.getClientIPKey(config, request))
+
+	config.IPv6PrefixLength = 128
+	assert.Equal(s.T(), "2001:db8:1:2:3:4:5:6", s.getClientIPKey(config, request))
+}
+
+func (s *ClientIPTestSuite) TestGetClientIPKey_IPv4Prefix() {
+	request := httptest.NewRequest("GET", "http://testing", nil)
+	request.RemoteAddr = "203.0.113.7:1234"
+
+	config := s.newConfig(nil, 0)
+	assert.Equal(s.T(), "203.0.113.7", s.getClientIPKey(config, request))
+
+	config.IPv4PrefixLength = 24
+	assert.Equal(s.T(), "203.0.113.0/24", s.getClientIPKey(config, request))
+}
+
+func (s *ClientIPTestSuite) TestGetClientIPKey_IPv4MappedIPv6() {
+	request := httptest.NewRequest("GET", "http://testing", nil)
+	request.RemoteAddr = "[::ffff:203.0.113.7]:1234"
+
+	config := s.newConfig(nil, 0)
+	config.IPv4PrefixLength = 24
+	assert.Equal(s.T(), "203.0.113.0/24", s.getClientIPKey(config, request))
+
+	request.RemoteAddr = "10.0.0.1:1234"
+	request.Header.Add("X-Forwarded-For", "::ffff:198.51.100.9")
+	config = s.newConfig([]string{"10.0.0.0/8"}, 0)
+	assert.Equal(s.T(), "198.51.100.9", s.getClientIPKey(config, request))
+}
+
+func (s *ClientIPTestSuite) TestGetClientIPKey_MixedIPv4AndIPv6() {
+	config := s.newConfig(nil, 0)
+	config.IPv4PrefixLength = 24
+	config.IPv6PrefixLength = 56
+
+	request := httptest.NewRequest("GET", "http://testing", nil)
+	request.RemoteAddr = "198.51.100.9:1234"
+	assert.Equal(s.T(), "198.51.100.0/24", s.getClientIPKey(config, request))
+
+	request.RemoteAddr = "[2001:db8:0:12ff::1]:1234"
+	assert.Equal(s.T(), "2001:db8:0:1200::/56", s.getClientIPKey(config, request))
+}
+
+func (s *ClientIPTestSuite) getClientIPKey(config *RateLimiterConfig, r *http.Request) string {
+	address, ok := resolveClientIP(config, r)
+	return getClientIPKey(config, address, ok)
+}
+
+func (s *ClientIPTestSuite) newConfig(trustedProxies []string, trustedProxyHops int64) *RateLimiterConfig {
+	config := &RateLimiterConfig{TrustedProxies: trustedProxies, TrustedProxyHops: trustedProxyHops}
+	configureClientIP(config)
+	return config
+}
+
+func (s *ClientIPTestSuite) TestResolveClientIP_NoTrustedProxies() {
+	request := httptest.NewRequest("GET", "http://testing", nil)
+	request.RemoteAddr = "10.0.0.1:1234"
+	request.Header.Add("X-Forwarded-For", "203.0.113.7")
+
+	assert.Equal(s.T(), "10.0.0.1", s.getClientIPKey(s.newConfig(nil, 0), request))
+}
+
+func (s *ClientIPTestSuite) TestResolveClientIP_UntrustedPeer() {
+	request := httptest.NewRequest("GET", "http://testing", nil)
+	request.RemoteAddr = "198.51.100.1:1234"
+	request.Header.Add("X-Forwarded-For", "203.0.113.7")
+
+	assert.Equal(s.T(), "198.51.100.1", s.getClientIPKey(s.newConfig([]string{"10.0.0.0/8"}, 0), request))
+}
+
+func (s *ClientIPTestSuite) TestResolveClientIP_XForwardedFor() {
+	request := httptest.NewRequest("GET", "http://testing", nil)
+	request.RemoteAddr = "10.0.0.1:1234"
+	request.Header.Add("X-Forwarded-For", "1.1.1.1, 203.0.113.7")
+	request.Header.Add("X-Forwarded-For", "10.0.0.2")
+
+	assert.Equal(s.T(), "203.0.113.7", s.getClientIPKey(s.newConfig([]string{"10.0.0.0/8"}, 0), request))
+}
+
+func (s *ClientIPTestSuite) TestResolveClientIP_XRealIP() {
+	request := httptest.NewRequest("GET", "http://testing", nil)
+	request.RemoteAddr = "10.0.0.1:1234"
+	request.Header.Add("X-Real-IP", "203.0.113.7")
+
+	assert.Equal(s.T(), "203.0.113.7", s.getClientIPKey(s.newConfig([]string{"10.0.0.1"}, 0), request))
+}
+
+func (s *ClientIPTestSuite) TestResolveClientIP_Forwarded() {
+	request := httptest.NewRequest("GET", "http://testing", nil)
+	request.RemoteAddr = "[2001:db8::1]:1234"
+	request.Header.Add("Forwarded", `for="[2001:db8:cafe::17]:4711";proto=https, For=10.0.0.2;by=10.0.0.3`)
+	request.Header.Add("X-Forwarded-For", "203.0.113.7")
+
+	assert.Equal(s.T(), "2001:db8:cafe::/64", s.getClientIPKey(s.newConfig([]string{"10.0.0.0/8", "2001:db8::/64"}, 0), request))
+}
+
+func (s *ClientIPTestSuite) TestResolveClientIP_ForwardedObfuscated() {
+	request := httptest.NewRequest("GET", "http://testing", nil)
+	request.RemoteAddr = "10.0.0.1:1234"
+	request.Header.Add("Forwarded", `for=unknown, for=10.0.0.2`)
+
+	assert.Equal(s.T(), "10.0.0.2", s.getClientIPKey(s.newConfig([]string{"10.0.0.0/8"}, 0), request))
+}
+
+func (s *ClientIPTestSuite) TestResolveClientIP_Hops() {
+	request := httptest.NewRequest("GET", "http://testing", nil)
+	request.RemoteAddr = "10.0.0.1:1234"
+	request.Header.Add("X-Forwarded-For", "203.0.113.7, 10.0.0.3, 10.0.0.2")
+
+	assert.Equal(s.T(), "10.0.0.2", s.getClientIPKey(s.newConfig([]string{"10.0.0.0/8"}, 1), request))
+	assert.Equal(s.T(), "10.0.0.3", s.getClientIPKey(s.newConfig([]string{"10.0.0.0/8"}, 2), request))
+	assert.Equal(s.T(), "203.0.113.7", s.getClientIPKey(s.newConfig([]string{"10.0.0.0/8"}, 3), request))
+}
+
+func (s *ClientIPTestSuite) TestResolveClientIP_AllTrusted() {
+	request := httptest.NewRequest("GET", "http://testing", nil)
+	request.RemoteAddr = "10.0.0.1:1234"
+	request.Header.Add("X-Forwarded-For", "10.0.0.3, 10.0.0.2")
+
+	assert.Equal(s.T(), "10.0.0.3", s.getClientIPKey(s.newConfig([]string{"10.0.0.0/8"}, 0), request))
+}
+
+func (s *ClientIPTestSuite) TestResolveClientIP_InvalidForwardedAddress() {
+	request := httptest.NewRequest("GET", "http://testing", nil)
+	request.RemoteAddr = "10.0.0.1:1234"
+	request.Header.Add("X-Forwarded-For", "203.0.113.7, garbage, 10.0.0.2")
+
+	assert.Equal(s.T(), "10.0.0.2", s.getClientIPKey(s.newConfig([]string{"10.0.0.0/8"}, 0), request))
+}
+
+func (s *ClientIPTestSuite) TestResolveClientIP_RemoteAddrWithoutPort() {
+	request := httptest.NewRequest("GET", "http://testing", nil)
+	request.RemoteAddr = "::ffff:203.0.113.7"
+
+	assert.Equal(s.T(), "203.0.113.7", s.getClientIPKey(s.newConfig(nil, 0), request))
+}
+
+func (s *ClientIPTestSuite) TestResolveClientIP_InvalidRemoteAddr() {
+	request := httptest.NewRequest("GET", "http://testing", nil)
+	request.RemoteAddr = "@"
+
+	assert.Equal(s.T(), unknownClientIP, s.getClientIPKey(s.newConfig(nil, 0), request))
+}
+
+func (s *ClientIPTestSuite) TestConfigureClientIP_TrustedProxiesFromEnv() {
+	os.Setenv(envTrustedProxies, "10.0.0.0/8, 192.168.0.1")
+	os.Setenv(envTrustedProxyHops, "2")
+
+	config := s.newConfig(nil, 0)
+
+	assert.Equal(s.T(), int64(2), config.TrustedProxyHops)
+	assert.Len(s.T(), config.trustedProxyPrefixes, 2)
+	assert.Equal(s.T(), "192.168.0.1/32", config.trustedProxyPrefixes[1].String())
+}
+
+func (s *ClientIPTestSuite) TestConfigureClientIP_InvalidTrustedProxies() {
+	config := s.newConfig([]string{"10.0.0.0/8", "10.0.0.0/99"}, 0)
+	assert.Empty(s.T(), config.trustedProxyPrefixes)
+
+	_, err := parsePrefixes([]string{"not-an-ip"})
+	assert.NotNil(s.T(), err)
+}
+
+func (s *ClientIPTestSuite) TestConfigureClientIP_PrefixLengthsFromEnv() {
+	os.Setenv(envIPv4PrefixLength, "24")
+	os.Setenv(envIPv6PrefixLength, "56")
+
+	config := s.newConfig(nil, 0)
+
+	assert.Equal(s.T(), int64(24), config.GetIPv4PrefixLength())
+	assert.Equal(s.T(), int64(56), config.GetIPv6PrefixLength())
+}
+
+func (s *ClientIPTestSuite) TestGetPrefixLengths_Defaults() {
+	config := &RateLimiterConfig{IPv4PrefixLength: 33, IPv6PrefixLength: -1}
+
+	assert.Equal(s.T(), int64(32), config.GetIPv4PrefixLength())
+	assert.Equal(s.T(), int64(64), config.GetIPv6PrefixLength())
+}
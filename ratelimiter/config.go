@@ -1,39 +1,293 @@
 package ratelimiter
 
 import (
+	"context"
 	"encoding/json"
 	"fmt"
+	"log/slog"
+	"net/netip"
 	"os"
 	"regexp"
+	"strconv"
 	"strings"
 
 	"github.com/arfurlaneto/goexpert-challenge-rate-limiter/ratelimiter/adapter"
+	"github.com/arfurlaneto/goexpert-challenge-rate-limiter/ratelimiter/metrics"
 	"github.com/arfurlaneto/goexpert-challenge-rate-limiter/ratelimiter/responsewriter"
+	"github.com/arfurlaneto/goexpert-challenge-rate-limiter/ratelimiter/tokenextractor"
+	"github.com/arfurlaneto/goexpert-challenge-rate-limiter/ratelimiter/tokenstore"
+	"github.com/redis/go-redis/v9"
+	"go.opentelemetry.io/otel/trace"
+	"go.opentelemetry.io/otel/trace/noop"
 )
 
-const envKeyIPMaxRequestsPerSecond = "RATE_LIMITER_IP_MAX_REQUESTS"
-const envKeyIPBlockTimeMilliseconds = "RATE_LIMITER_IP_BLOCK_TIME"
-const envKeyTokenMaxRequestsPerSecond = "RATE_LIMITER_TOKEN_MAX_REQUESTS"
-const envKeyTokenBlockTimeMilliseconds = "RATE_LIMITER_TOKEN_BLOCK_TIME"
+const envKeyIPPrefix = "RATE_LIMITER_IP"
+const envKeyTokenPrefix = "RATE_LIMITER_TOKEN"
+const envKeySuffixMaxRequests = "_MAX_REQUESTS"
+const envKeySuffixBlockTime = "_BLOCK_TIME"
+const envKeySuffixWindowTime = "_WINDOW_TIME"
+const envKeySuffixAlgorithm = "_ALGORITHM"
+const envKeySuffixBucketCapacity = "_BUCKET_CAPACITY"
+const envKeySuffixRefillRate = "_REFILL_RATE"
+const envKeySuffixExtraLimits = "_EXTRA_LIMITS"
+const envKeyRulePrefix = "RATE_LIMITER_RULE"
+const envKeySuffixRulePath = "_PATH"
+const envKeySuffixRulePathType = "_PATH_TYPE"
+const envKeySuffixRuleMethods = "_METHODS"
+const envKeyIPMaxRequestsPerSecond = envKeyIPPrefix + envKeySuffixMaxRequests
+const envKeyIPBlockTimeMilliseconds = envKeyIPPrefix + envKeySuffixBlockTime
+const envKeyTokenMaxRequestsPerSecond = envKeyTokenPrefix + envKeySuffixMaxRequests
+const envKeyTokenBlockTimeMilliseconds = envKeyTokenPrefix + envKeySuffixBlockTime
 const envKeyDebug = "RATE_LIMITER_DEBUG"
+const envLegacyHeaders = "RATE_LIMITER_LEGACY_HEADERS"
+const envRedactTokens = "RATE_LIMITER_REDACT_TOKENS"
+const envTokenSources = "RATE_LIMITER_TOKEN_SOURCES"
+const envTrustedProxies = "RATE_LIMITER_TRUSTED_PROXIES"
+const envTrustedProxyHops = "RATE_LIMITER_TRUSTED_PROXY_HOPS"
+const envIPv4PrefixLength = "RATE_LIMITER_IPV4_PREFIX"
+const envIPv6PrefixLength = "RATE_LIMITER_IPV6_PREFIX"
+const envEnforceIPAndToken = "RATE_LIMITER_ENFORCE_IP_AND_TOKEN"
+const envKeyMaxTokensPerIPPrefix = "RATE_LIMITER_IP_MAX_TOKENS"
+const envAllowedIPs = "RATE_LIMITER_ALLOWED_IPS"
+const envDeniedIPs = "RATE_LIMITER_DENIED_IPS"
+const envAllowedTokens = "RATE_LIMITER_ALLOWED_TOKENS"
+const envDeniedTokens = "RATE_LIMITER_DENIED_TOKENS"
+const envAccessListFile = "RATE_LIMITER_ACCESS_LIST_FILE"
+const envDeniedStatusCode = "RATE_LIMITER_DENIED_STATUS"
+const envPlansFile = "RATE_LIMITER_PLANS_FILE"
+const envStoragePlans = "RATE_LIMITER_STORAGE_PLANS"
+const envUnknownTokens = "RATE_LIMITER_UNKNOWN_TOKENS"
+const envTokenStore = "RATE_LIMITER_TOKEN_STORE"
 const envUseRedis = "RATE_LIMITER_USE_REDIS"
 const envRedisAddress = "RATE_LIMITER_REDIS_ADDRESS"
 const envRedisPassword = "RATE_LIMITER_REDIS_PASSWORD"
 const envRedisDB = "RATE_LIMITER_REDIS_DB"
+const envMemoryCleanupInterval = "RATE_LIMITER_MEMORY_CLEANUP_INTERVAL"
+const envMemoryMaxKeys = "RATE_LIMITER_MEMORY_MAX_KEYS"
+const envMemoryShards = "RATE_LIMITER_MEMORY_SHARDS"
+const envRedisMasterName = "RATE_LIMITER_REDIS_MASTER_NAME"
+const envRedisSentinelPassword = "RATE_LIMITER_REDIS_SENTINEL_PASSWORD"
+const envRedisCluster = "RATE_LIMITER_REDIS_CLUSTER"
+
+const defaultWindowMilliseconds = 1000
+const defaultIPv4PrefixLength = 32
+const defaultIPv6PrefixLength = 64
+const defaultDeniedStatusCode = 403
+
+const AlgorithmSlidingWindow = "sliding_window"
+const AlgorithmTokenBucket = "token_bucket"
+const AlgorithmGCRA = "gcra"
+
+const UnknownTokensAllow = "allow"
+const UnknownTokensReject = "reject"
+const UnknownTokensAsIP = "ip"
+
+var rateConfigEnvKeySuffixes = []string{
+	envKeySuffixMaxRequests,
+	envKeySuffixBlockTime,
+	envKeySuffixWindowTime,
+	envKeySuffixAlgorithm,
+	envKeySuffixBucketCapacity,
+	envKeySuffixRefillRate,
+	envKeySuffixExtraLimits,
+}
 
+// RateLimiterRateConfig allows MaxRequestsPerSecond requests per window. Despite
+// its name, MaxRequestsPerSecond is counted over WindowMilliseconds, which
+// defaults to one second.
 type RateLimiterRateConfig struct {
-	MaxRequestsPerSecond  int64 `json:"maxRequestsPerSecond"`
-	BlockTimeMilliseconds int64 `json:"blockTimeMilliseconds"`
+	MaxRequestsPerSecond  int64  `json:"maxRequestsPerSecond"`
+	BlockTimeMilliseconds int64  `json:"blockTimeMilliseconds"`
+	WindowMilliseconds    int64  `json:"windowMilliseconds"`
+	Algorithm             string `json:"algorithm"`
+	BucketCapacity        int64  `json:"bucketCapacity"`
+	RefillRatePerSecond   int64  `json:"refillRatePerSecond"`
+	Name                  string `json:"name"`
+	// ExtraLimits are checked together with this limit for the same key, e.g.
+	// 20 requests per second, but no more than 1000 per minute.
+	ExtraLimits []*RateLimiterRateConfig `json:"extraLimits"`
+}
+
+// GetName returns the limit name, defaulting to a description of the limit.
+func (c *RateLimiterRateConfig) GetName() string {
+	if c.Name == "" {
+		return fmt.Sprintf("%d-per-%dms", c.MaxRequestsPerSecond, c.GetWindowMilliseconds())
+	}
+	return c.Name
+}
+
+// GetLimits returns this limit followed by its extra limits.
+func (c *RateLimiterRateConfig) GetLimits() []*RateLimiterRateConfig {
+	limits := []*RateLimiterRateConfig{c}
+	for _, extraLimit := range c.ExtraLimits {
+		if extraLimit != nil {
+			limits = append(limits, extraLimit)
+		}
+	}
+	return limits
+}
+
+// GetWindowMilliseconds returns the window length, defaulting to one second.
+func (c *RateLimiterRateConfig) GetWindowMilliseconds() int64 {
+	if c.WindowMilliseconds <= 0 {
+		return defaultWindowMilliseconds
+	}
+	return c.WindowMilliseconds
+}
+
+// GetAlgorithm returns the configured algorithm, defaulting to the sliding window.
+func (c *RateLimiterRateConfig) GetAlgorithm() string {
+	if c.Algorithm == "" {
+		return AlgorithmSlidingWindow
+	}
+	return c.Algorithm
+}
+
+// GetBucketCapacity returns the token bucket capacity, defaulting to MaxRequestsPerSecond.
+func (c *RateLimiterRateConfig) GetBucketCapacity() int64 {
+	if c.BucketCapacity <= 0 {
+		return c.MaxRequestsPerSecond
+	}
+	return c.BucketCapacity
+}
+
+// GetQuota returns how many requests the limit allows at once: the bucket
+// capacity for the token bucket, MaxRequestsPerSecond otherwise.
+func (c *RateLimiterRateConfig) GetQuota() int64 {
+	if c.GetAlgorithm() == AlgorithmTokenBucket {
+		return c.GetBucketCapacity()
+	}
+	return c.MaxRequestsPerSecond
+}
+
+// GetRefillRatePerSecond returns the token bucket refill rate, defaulting to
+// MaxRequestsPerSecond spread over the window (at least one token per second).
+func (c *RateLimiterRateConfig) GetRefillRatePerSecond() int64 {
+	if c.RefillRatePerSecond <= 0 {
+		return max(1, c.MaxRequestsPerSecond*1000/c.GetWindowMilliseconds())
+	}
+	return c.RefillRatePerSecond
+}
+
+// RateLimiterRedisConfig configures the Redis Storage Adapter. More than one
+// address without a master name also uses Redis Cluster.
+type RateLimiterRedisConfig struct {
+	Addresses        []string `json:"addresses"`
+	Password         string   `json:"password"`
+	DB               int64    `json:"db"`
+	MasterName       string   `json:"masterName"`
+	SentinelPassword string   `json:"sentinelPassword"`
+	Cluster          bool     `json:"cluster"`
+}
+
+// MarshalJSON hides the passwords, so the configuration can be logged.
+func (c RateLimiterRedisConfig) MarshalJSON() ([]byte, error) {
+	type redisConfig RateLimiterRedisConfig
+	if c.Password != "" {
+		c.Password = "***"
+	}
+	if c.SentinelPassword != "" {
+		c.SentinelPassword = "***"
+	}
+	return json.Marshal(redisConfig(c))
 }
 
 type RateLimiterConfig struct {
-	IP             *RateLimiterRateConfig                   `json:"ip"`
-	Token          *RateLimiterRateConfig                   `json:"token"`
-	CustomTokens   *map[string]*RateLimiterRateConfig       `json:"tokens"`
+	IP           *RateLimiterRateConfig             `json:"ip"`
+	Token        *RateLimiterRateConfig             `json:"token"`
+	CustomTokens *map[string]*RateLimiterRateConfig `json:"tokens"`
+	// Plans are named sets of limits, like "free" or "pro", and TokenPlans
+	// assigns tokens to them. Changing a plan changes all of its tokens.
+	// Custom tokens keep their own limits.
+	Plans      map[string]*RateLimiterRateConfig `json:"plans"`
+	TokenPlans map[string]string                 `json:"tokenPlans"`
+	// PlansFile is a JSON file with more plans and token plans, in the format
+	// {"plans": {...}, "tokenPlans": {...}}. Plans and TokenPlans win over it.
+	PlansFile string `json:"plansFile"`
+	// StoragePlans also reads token plans, and optionally the plan limits,
+	// from a storage adapter implementing RateLimitPlanStorageAdapter.
+	StoragePlans bool `json:"storagePlans"`
+	// Rules apply other limits to some methods and paths. The first matching
+	// rule is used.
+	Rules          []*RateLimiterRule                       `json:"rules"`
 	StorageAdapter adapter.RateLimitStorageAdapter          `json:"-"`
 	ResponseWriter responsewriter.RateLimiterResponseWriter `json:"-"`
+	// TokenExtractor reads the token of a request. Requests without a token are
+	// limited by IP. Defaults to the API_KEY header.
+	TokenExtractor tokenextractor.RateLimiterTokenExtractor `json:"-"`
 	Debug          bool                                     `json:"debug"`
 	DisableEnvs    bool                                     `json:"disableEnvs"`
+	// EnforceIPAndToken checks requests with a token against the IP limits
+	// too, instead of only against the token limits.
+	EnforceIPAndToken bool `json:"enforceIPAndToken"`
+	// MaxTokensPerIP limits how many distinct tokens one IP may present per
+	// window, MaxRequestsPerSecond being the number of tokens. IPs over the
+	// limit are blocked for BlockTimeMilliseconds.
+	MaxTokensPerIP *RateLimiterRateConfig `json:"maxTokensPerIP"`
+	// TrustedProxies are the CIDRs or addresses of the proxies in front of the
+	// server. Forwarding headers are only read from them.
+	TrustedProxies []string `json:"trustedProxies"`
+	// TrustedProxyHops is the maximum number of forwarded addresses walked
+	// back to find the client. Zero or less means no maximum.
+	TrustedProxyHops int64 `json:"trustedProxyHops"`
+	// IPv4PrefixLength and IPv6PrefixLength aggregate client IPs, so all the
+	// addresses of a network share the same limit. IPv6 clients usually own a
+	// whole /64.
+	IPv4PrefixLength int64 `json:"ipv4PrefixLength"`
+	IPv6PrefixLength int64 `json:"ipv6PrefixLength"`
+	// AllowedIPs and AllowedTokens bypass the rate limiter. DeniedIPs and
+	// DeniedTokens are always rejected with DeniedStatusCode, even if allowed.
+	// IPs are CIDRs or addresses.
+	AllowedIPs       []string `json:"allowedIPs"`
+	DeniedIPs        []string `json:"deniedIPs"`
+	AllowedTokens    []string `json:"allowedTokens"`
+	DeniedTokens     []string `json:"deniedTokens"`
+	DeniedStatusCode int      `json:"deniedStatusCode"`
+	// AccessListFile adds entries to the lists above, one per line, in the
+	// format "<allow|deny> <ip|token> <value>".
+	AccessListFile string `json:"accessListFile"`
+	// TokenStore holds the registered tokens, next to the CustomTokens. It is
+	// only used when UnknownTokens is not "allow".
+	TokenStore tokenstore.RateLimiterTokenStore `json:"-"`
+	// UnknownTokens is what happens to requests with a token that is neither a
+	// custom token nor in the TokenStore: "allow" limits them with the Token
+	// config, "reject" answers 401 and "ip" limits them by IP. Defaults to
+	// "allow".
+	UnknownTokens string `json:"unknownTokens"`
+	// Redis uses the Redis Storage Adapter when no StorageAdapter is set.
+	Redis *RateLimiterRedisConfig `json:"redis"`
+	// Metrics receives the allowed, rejected and failed keys, and the
+	// storage adapter latency. See metrics.NewPrometheusMetrics.
+	Metrics metrics.RateLimiterMetrics `json:"-"`
+	// Logger receives structured records: requests blocked (info), denied
+	// or rejected (info), ignored configuration values (warn), errors and,
+	// at debug level, the details of each decision. Defaults to a logger
+	// writing warnings and errors to slog.Default(), or everything to stdout
+	// with Debug.
+	Logger *slog.Logger `json:"-"`
+	// RedactTokens logs a hash of the tokens instead of the tokens.
+	RedactTokens bool `json:"redactTokens"`
+	// TracerProvider creates a span for each rate limit check, with a child
+	// span for each storage adapter call. Nothing is traced without it, see
+	// otel.GetTracerProvider to use the global one.
+	TracerProvider trace.TracerProvider `json:"-"`
+	// LegacyHeaders also writes the X-RateLimit-* headers next to the
+	// RateLimit-* ones.
+	LegacyHeaders bool `json:"legacyHeaders"`
+
+	trustedProxyPrefixes []netip.Prefix
+	accessList           *accessList
+	planCache            *planCache
+	// ignoreAllEnvs also ignores RATE_LIMITER_USE_REDIS and the custom token
+	// envs, which DisableEnvs still reads. It is set by New with DisableEnvs.
+	ignoreAllEnvs bool
+	// reloading keeps the storage adapter of the configuration being
+	// replaced, so its counters and blocks survive a reload.
+	reloading bool
+	// collectProblems reports a missing Redis address as a problem instead
+	// of panicking. problems are the ignored invalid values.
+	collectProblems bool
+	problems        []error
 }
 
 func (c *RateLimiterConfig) GetRateLimiterRateConfigForToken(token string) (*RateLimiterRateConfig, bool) {
@@ -45,6 +299,74 @@ func (c *RateLimiterConfig) GetRateLimiterRateConfigForToken(token string) (*Rat
 	}
 }
 
+// GetIPv4PrefixLength returns the IPv4 prefix length, defaulting to the full address.
+func (c *RateLimiterConfig) GetIPv4PrefixLength() int64 {
+	if c.IPv4PrefixLength <= 0 || c.IPv4PrefixLength > 32 {
+		return defaultIPv4PrefixLength
+	}
+	return c.IPv4PrefixLength
+}
+
+// GetIPv6PrefixLength returns the IPv6 prefix length, defaulting to /64.
+func (c *RateLimiterConfig) GetIPv6PrefixLength() int64 {
+	if c.IPv6PrefixLength <= 0 || c.IPv6PrefixLength > 128 {
+		return defaultIPv6PrefixLength
+	}
+	return c.IPv6PrefixLength
+}
+
+// GetDeniedStatusCode returns the status code of denied requests, defaulting to 403.
+func (c *RateLimiterConfig) GetDeniedStatusCode() int {
+	if c.DeniedStatusCode <= 0 {
+		return defaultDeniedStatusCode
+	}
+	return c.DeniedStatusCode
+}
+
+// GetUnknownTokens returns what happens to unknown tokens, defaulting to "allow".
+func (c *RateLimiterConfig) GetUnknownTokens() string {
+	if c.UnknownTokens != UnknownTokensReject && c.UnknownTokens != UnknownTokensAsIP {
+		return UnknownTokensAllow
+	}
+	return c.UnknownTokens
+}
+
+// GetTokenExtractor returns the token extractor, defaulting to the API_KEY header.
+func (c *RateLimiterConfig) GetTokenExtractor() tokenextractor.RateLimiterTokenExtractor {
+	if c.TokenExtractor == nil {
+		return tokenextractor.NewHeaderTokenExtractor(tokenextractor.DefaultHeaderName)
+	}
+	return c.TokenExtractor
+}
+
+// GetLogger returns the logger, see Logger.
+func (c *RateLimiterConfig) GetLogger() *slog.Logger {
+	if c.Logger != nil {
+		return c.Logger
+	}
+	if c.Debug {
+		return debugLogger
+	}
+	return defaultLogger
+}
+
+// GetTracer returns the tracer of the rate limiter spans, defaulting to
+// discarding them.
+func (c *RateLimiterConfig) GetTracer() trace.Tracer {
+	if c.TracerProvider == nil {
+		return noop.NewTracerProvider().Tracer(tracerName)
+	}
+	return c.TracerProvider.Tracer(tracerName)
+}
+
+// GetMetrics returns the metrics, defaulting to discarding them.
+func (c *RateLimiterConfig) GetMetrics() metrics.RateLimiterMetrics {
+	if c.Metrics == nil {
+		return metrics.NewNoopMetrics()
+	}
+	return c.Metrics
+}
+
 func getDefaultConfiguration() *RateLimiterConfig {
 	return &RateLimiterConfig{
 		IP: &RateLimiterRateConfig{
@@ -58,6 +380,7 @@ func getDefaultConfiguration() *RateLimiterConfig {
 		CustomTokens:   &map[string]*RateLimiterRateConfig{},
 		StorageAdapter: adapter.NewRateLimitMemoryStorageAdapter(),
 		ResponseWriter: responsewriter.NewRateLimiterDefaultResponseWriter(),
+		TokenExtractor: tokenextractor.NewHeaderTokenExtractor(tokenextractor.DefaultHeaderName),
 		Debug:          false,
 	}
 }
@@ -68,25 +391,52 @@ func setConfiguration(config *RateLimiterConfig) *RateLimiterConfig {
 	if config == nil {
 		config = defaultConfiguration
 	}
+	config.problems = nil
 
 	if !config.DisableEnvs {
 		debug, ok := getBoolEnv(envKeyDebug)
 		if ok {
 			config.Debug = debug
-			DebugPrintfWithoutKey(config, "using env %s", envKeyDebug)
+			config.GetLogger().Debug("using env", "env", envKeyDebug)
+		}
+
+		legacyHeaders, ok := getBoolEnv(envLegacyHeaders)
+		if ok {
+			config.LegacyHeaders = legacyHeaders
+			config.GetLogger().Debug("using env", "env", envLegacyHeaders)
+		}
+
+		redactTokens, ok := getBoolEnv(envRedactTokens)
+		if ok {
+			config.RedactTokens = redactTokens
+			config.GetLogger().Debug("using env", "env", envRedactTokens)
 		}
 	}
 
 	configureIP(config, defaultConfiguration)
 	configureToken(config, defaultConfiguration)
 	configureCustomTokens(config, defaultConfiguration)
+	configurePlans(config)
+	configureRules(config)
+	configureTokenSpraying(config)
 	configureStorageAdapter(config, defaultConfiguration)
 	configureResponseWriter(config, defaultConfiguration)
+	configureTokenExtractor(config, defaultConfiguration)
+	configureClientIP(config)
+	configureAccessList(config)
+	configureTokenStore(config)
+
+	err := config.Validate()
+	if err != nil {
+		config.GetLogger().Warn("invalid configuration", "error", err)
+	}
 
-	if config.Debug {
+	// the configuration holds the custom tokens, so it is not logged when
+	// they are redacted
+	if config.GetLogger().Enabled(context.Background(), slog.LevelDebug) && !config.RedactTokens {
 		jsonConfiguration, err := json.Marshal(config)
 		if err == nil {
-			DebugPrintfWithoutKey(config, "using configuration: %s", jsonConfiguration)
+			config.GetLogger().Debug("using configuration", "configuration", json.RawMessage(jsonConfiguration))
 		}
 	}
 
@@ -99,17 +449,7 @@ func configureIP(config *RateLimiterConfig, defaultConfiguration *RateLimiterCon
 	}
 
 	if !config.DisableEnvs {
-		mrps, ok := getInt64Env(envKeyIPMaxRequestsPerSecond)
-		if ok {
-			config.IP.MaxRequestsPerSecond = mrps
-			DebugPrintfWithoutKey(config, "using env %s", envKeyIPMaxRequestsPerSecond)
-		}
-
-		bt, ok := getInt64Env(envKeyIPBlockTimeMilliseconds)
-		if ok {
-			config.IP.BlockTimeMilliseconds = bt
-			DebugPrintfWithoutKey(config, "using env %s", envKeyIPBlockTimeMilliseconds)
-		}
+		configureRateConfigFromEnvs(config, config.IP, envKeyIPPrefix)
 	}
 }
 
@@ -119,18 +459,100 @@ func configureToken(config *RateLimiterConfig, defaultConfiguration *RateLimiter
 	}
 
 	if !config.DisableEnvs {
-		mrps, ok := getInt64Env(envKeyTokenMaxRequestsPerSecond)
-		if ok {
-			config.Token.MaxRequestsPerSecond = mrps
-			DebugPrintfWithoutKey(config, "using env %s", envKeyTokenMaxRequestsPerSecond)
+		configureRateConfigFromEnvs(config, config.Token, envKeyTokenPrefix)
+	}
+}
+
+func configureRateConfigFromEnvs(config *RateLimiterConfig, rateConfig *RateLimiterRateConfig, envKeyPrefix string) {
+	maxRequestsEnvKey := envKeyPrefix + envKeySuffixMaxRequests
+	mrps, ok := getInt64Env(maxRequestsEnvKey)
+	if ok {
+		rateConfig.MaxRequestsPerSecond = mrps
+		config.GetLogger().Debug("using env", "env", maxRequestsEnvKey)
+	}
+
+	blockTimeEnvKey := envKeyPrefix + envKeySuffixBlockTime
+	bt, ok := getInt64Env(blockTimeEnvKey)
+	if ok {
+		rateConfig.BlockTimeMilliseconds = bt
+		config.GetLogger().Debug("using env", "env", blockTimeEnvKey)
+	}
+
+	windowTimeEnvKey := envKeyPrefix + envKeySuffixWindowTime
+	wt, ok := getInt64Env(windowTimeEnvKey)
+	if ok {
+		rateConfig.WindowMilliseconds = wt
+		config.GetLogger().Debug("using env", "env", windowTimeEnvKey)
+	}
+
+	algorithmEnvKey := envKeyPrefix + envKeySuffixAlgorithm
+	algorithm, ok := getStringEnv(algorithmEnvKey)
+	if ok {
+		rateConfig.Algorithm = algorithm
+		config.GetLogger().Debug("using env", "env", algorithmEnvKey)
+	}
+
+	bucketCapacityEnvKey := envKeyPrefix + envKeySuffixBucketCapacity
+	bc, ok := getInt64Env(bucketCapacityEnvKey)
+	if ok {
+		rateConfig.BucketCapacity = bc
+		config.GetLogger().Debug("using env", "env", bucketCapacityEnvKey)
+	}
+
+	refillRateEnvKey := envKeyPrefix + envKeySuffixRefillRate
+	rr, ok := getInt64Env(refillRateEnvKey)
+	if ok {
+		rateConfig.RefillRatePerSecond = rr
+		config.GetLogger().Debug("using env", "env", refillRateEnvKey)
+	}
+
+	extraLimitsEnvKey := envKeyPrefix + envKeySuffixExtraLimits
+	el, ok := getStringEnv(extraLimitsEnvKey)
+	if ok {
+		extraLimits, err := parseExtraLimits(el)
+		if err != nil {
+			addConfigurationProblem(config, "env %s: %s", extraLimitsEnvKey, err)
+		} else {
+			rateConfig.ExtraLimits = extraLimits
+			config.GetLogger().Debug("using env", "env", extraLimitsEnvKey)
 		}
+	}
+}
 
-		bt, ok := getInt64Env(envKeyTokenBlockTimeMilliseconds)
-		if ok {
-			config.Token.BlockTimeMilliseconds = bt
-			DebugPrintfWithoutKey(config, "using env %s", envKeyTokenBlockTimeMilliseconds)
+// parseExtraLimits parses a comma separated list of limits in the format
+// name:maxRequests:windowMilliseconds:blockTimeMilliseconds[:algorithm].
+func parseExtraLimits(value string) ([]*RateLimiterRateConfig, error) {
+	extraLimits := []*RateLimiterRateConfig{}
+
+	for _, entry := range strings.Split(value, ",") {
+		fields := strings.Split(strings.TrimSpace(entry), ":")
+		if len(fields) != 4 && len(fields) != 5 {
+			return nil, fmt.Errorf("invalid limit \"%s\": expected name:maxRequests:windowMilliseconds:blockTimeMilliseconds[:algorithm]", entry)
+		}
+
+		numbers := []int64{}
+		for _, field := range fields[1:4] {
+			number, err := strconv.ParseInt(field, 10, 64)
+			if err != nil {
+				return nil, fmt.Errorf("invalid limit \"%s\": \"%s\" is not an integer", entry, field)
+			}
+			numbers = append(numbers, number)
 		}
+
+		extraLimit := &RateLimiterRateConfig{
+			Name:                  fields[0],
+			MaxRequestsPerSecond:  numbers[0],
+			WindowMilliseconds:    numbers[1],
+			BlockTimeMilliseconds: numbers[2],
+		}
+		if len(fields) == 5 {
+			extraLimit.Algorithm = fields[4]
+		}
+
+		extraLimits = append(extraLimits, extraLimit)
 	}
+
+	return extraLimits, nil
 }
 
 func configureCustomTokens(config *RateLimiterConfig, defaultConfiguration *RateLimiterConfig) {
@@ -145,6 +567,11 @@ func configureCustomTokens(config *RateLimiterConfig, defaultConfiguration *Rate
 		}
 	}
 
+	// DisableEnvs keeps reading the custom token envs, as it always did
+	if config.ignoreAllEnvs {
+		return
+	}
+
 	customTokens := getCustomTokenList()
 	for _, customToken := range *customTokens {
 		configureCustomToken(config, defaultConfiguration, customToken)
@@ -152,7 +579,7 @@ func configureCustomTokens(config *RateLimiterConfig, defaultConfiguration *Rate
 }
 
 func getCustomTokenList() *[]string {
-	envKeyRegex := regexp.MustCompile("^RATE_LIMITER_TOKEN_(.*)_(MAX_REQUESTS|BLOCK_TIME)$")
+	envKeyRegex := regexp.MustCompile(fmt.Sprintf("^%s_(.*)(%s)$", envKeyTokenPrefix, strings.Join(rateConfigEnvKeySuffixes, "|")))
 
 	foundTokens := map[string]bool{}
 
@@ -175,28 +602,12 @@ func getCustomTokenList() *[]string {
 
 func configureCustomToken(config *RateLimiterConfig, defaultConfiguration *RateLimiterConfig, customToken string) {
 
-	DebugPrintfWithoutKey(config, "configuring custom token \"%s\"", customToken)
+	config.GetLogger().Debug("configuring custom token from envs, envs not found will use token values", "key", getLogToken(config, customToken))
 
-	maxRequestsPerSecondEnvKey := fmt.Sprintf("RATE_LIMITER_TOKEN_%s_MAX_REQUESTS", customToken)
-	maxRequestsPerSecond, ok := getInt64Env(maxRequestsPerSecondEnvKey)
-	if !ok {
-		defaultValue := config.Token.MaxRequestsPerSecond
-		DebugPrintfWithoutKey(config, "env \"%s\" not found: using default value %d", maxRequestsPerSecondEnvKey, defaultValue)
-		maxRequestsPerSecond = defaultValue
-	}
-
-	blockTimeMillisecondEnvKey := fmt.Sprintf("RATE_LIMITER_TOKEN_%s_BLOCK_TIME", customToken)
-	blockTimeMilliseconds, ok := getInt64Env(blockTimeMillisecondEnvKey)
-	if !ok {
-		defaultValue := config.Token.BlockTimeMilliseconds
-		DebugPrintfWithoutKey(config, "env \"%s\" not found: using default value %d", blockTimeMillisecondEnvKey, defaultValue)
-		blockTimeMilliseconds = defaultValue
-	}
+	customTokenConfig := *config.Token
+	configureRateConfigFromEnvs(config, &customTokenConfig, fmt.Sprintf("%s_%s", envKeyTokenPrefix, customToken))
 
-	(*config.CustomTokens)[customToken] = &RateLimiterRateConfig{
-		MaxRequestsPerSecond:  maxRequestsPerSecond,
-		BlockTimeMilliseconds: blockTimeMilliseconds,
-	}
+	(*config.CustomTokens)[customToken] = &customTokenConfig
 }
 
 func configureStorageAdapter(config *RateLimiterConfig, defaultConfiguration *RateLimiterConfig) {
@@ -204,22 +615,83 @@ func configureStorageAdapter(config *RateLimiterConfig, defaultConfiguration *Ra
 		config.StorageAdapter = defaultConfiguration.StorageAdapter
 	}
 
-	useRedis, ok := getBoolEnv(envUseRedis)
-	if ok && useRedis {
+	if config.reloading {
+		config.GetLogger().Debug("keeping StorageAdapter")
+		return
+	}
+
+	// DisableEnvs keeps reading RATE_LIMITER_USE_REDIS, as it always did
+	useRedis := false
+	if !config.ignoreAllEnvs {
+		useRedis, _ = getBoolEnv(envUseRedis)
+	}
+
+	if useRedis {
+		redisConfig, err := getRedisConfigFromEnvs()
+		if err != nil && !config.collectProblems {
+			panic(err.Error())
+		}
+		if err != nil {
+			addConfigurationProblem(config, "%s", err)
+			config.GetLogger().Debug("using StorageAdapter", "storage_adapter", "default")
+			return
+		}
+		config.Redis = redisConfig
 		configureRedisStorageAdapter(config)
 	} else if config.StorageAdapter != defaultConfiguration.StorageAdapter {
-		DebugPrintfWithoutKey(config, "using StorageAdapter Custom")
+		config.GetLogger().Debug("using StorageAdapter", "storage_adapter", "custom")
+	} else if config.Redis != nil {
+		configureRedisStorageAdapter(config)
 	} else {
-		DebugPrintfWithoutKey(config, "using StorageAdapter Default")
+		config.GetLogger().Debug("using StorageAdapter", "storage_adapter", "default")
+		if !config.DisableEnvs {
+			configureMemoryStorageAdapter(config)
+		}
+	}
+}
+
+func configureMemoryStorageAdapter(config *RateLimiterConfig) {
+	cleanupInterval, cleanupIntervalOk := getInt64Env(envMemoryCleanupInterval)
+	maxKeys, maxKeysOk := getInt64Env(envMemoryMaxKeys)
+	shards, shardsOk := getInt64Env(envMemoryShards)
+
+	if !cleanupIntervalOk && !maxKeysOk && !shardsOk {
+		return
+	}
+
+	options := adapter.RateLimitMemoryStorageAdapterOptions{
+		CleanupIntervalMilliseconds: adapter.DefaultMemoryCleanupIntervalMilliseconds,
+	}
+
+	if cleanupIntervalOk {
+		options.CleanupIntervalMilliseconds = cleanupInterval
+		config.GetLogger().Debug("using env", "env", envMemoryCleanupInterval)
 	}
+
+	if maxKeysOk {
+		options.MaxKeys = maxKeys
+		config.GetLogger().Debug("using env", "env", envMemoryMaxKeys)
+	}
+
+	if shardsOk {
+		options.Shards = shards
+		config.GetLogger().Debug("using env", "env", envMemoryShards)
+	}
+
+	config.StorageAdapter = adapter.NewRateLimitMemoryStorageAdapterWithOptions(options)
 }
 
 func configureRedisStorageAdapter(config *RateLimiterConfig) {
-	DebugPrintfWithoutKey(config, "using StorageAdapter Redis")
+	config.GetLogger().Debug("using StorageAdapter", "storage_adapter", "redis")
+	redisStorageAdapter := adapter.NewRateLimitRedisStorageAdapterWithClient(newRedisClient(config, config.Redis))
+	redisStorageAdapter.SetLogger(config.GetLogger())
+	config.StorageAdapter = redisStorageAdapter
+}
 
+func getRedisConfigFromEnvs() (*RateLimiterRedisConfig, error) {
 	redisAddress, ok := getStringEnv(envRedisAddress)
 	if !ok {
-		panic(fmt.Sprintf("%s env is required when using redis adapter with env configuration", envRedisAddress))
+		return nil, fmt.Errorf("%s env is required when using redis with env configuration", envRedisAddress)
 	}
 
 	redisPassword, ok := getStringEnv(envRedisPassword)
@@ -232,7 +704,37 @@ func configureRedisStorageAdapter(config *RateLimiterConfig) {
 		redisDB = 0
 	}
 
-	config.StorageAdapter = adapter.NewRateLimitRedisStorageAdapter(redisAddress, redisPassword, redisDB)
+	redisMasterName, _ := getStringEnv(envRedisMasterName)
+	redisSentinelPassword, _ := getStringEnv(envRedisSentinelPassword)
+	redisCluster, _ := getBoolEnv(envRedisCluster)
+
+	return &RateLimiterRedisConfig{
+		Addresses:        strings.Split(redisAddress, ","),
+		Password:         redisPassword,
+		DB:               redisDB,
+		MasterName:       redisMasterName,
+		SentinelPassword: redisSentinelPassword,
+		Cluster:          redisCluster,
+	}, nil
+}
+
+func newRedisClient(config *RateLimiterConfig, redisConfig *RateLimiterRedisConfig) redis.UniversalClient {
+	options := &redis.UniversalOptions{
+		Addrs:            redisConfig.Addresses,
+		Password:         redisConfig.Password,
+		DB:               int(redisConfig.DB),
+		MasterName:       redisConfig.MasterName,
+		SentinelPassword: redisConfig.SentinelPassword,
+	}
+
+	if redisConfig.Cluster {
+		config.GetLogger().Debug("using Redis Cluster")
+		return redis.NewClusterClient(options.Cluster())
+	} else if redisConfig.MasterName != "" {
+		config.GetLogger().Debug("using Redis Sentinel", "master", redisConfig.MasterName)
+		return redis.NewFailoverClient(options.Failover())
+	}
+	return redis.NewUniversalClient(options)
 }
 
 func configureResponseWriter(config *RateLimiterConfig, defaultConfiguration *RateLimiterConfig) {
@@ -241,8 +743,273 @@ func configureResponseWriter(config *RateLimiterConfig, defaultConfiguration *Ra
 	}
 
 	if config.ResponseWriter != defaultConfiguration.ResponseWriter {
-		DebugPrintfWithoutKey(config, "using ResponseWriter Custom")
+		config.GetLogger().Debug("using ResponseWriter", "response_writer", "custom")
 	} else {
-		DebugPrintfWithoutKey(config, "using ResponseWriter Default")
+		config.GetLogger().Debug("using ResponseWriter", "response_writer", "default")
+	}
+}
+
+func configureTokenExtractor(config *RateLimiterConfig, defaultConfiguration *RateLimiterConfig) {
+	if config.TokenExtractor == nil {
+		config.TokenExtractor = defaultConfiguration.TokenExtractor
+	}
+
+	if config.DisableEnvs {
+		return
+	}
+
+	tokenSources, ok := getStringEnv(envTokenSources)
+	if ok {
+		tokenExtractor, err := parseTokenSources(tokenSources)
+		if err != nil {
+			addConfigurationProblem(config, "env %s: %s", envTokenSources, err)
+		} else {
+			config.TokenExtractor = tokenExtractor
+			config.GetLogger().Debug("using env", "env", envTokenSources)
+		}
+	}
+}
+
+// parseTokenSources parses a comma separated list of token sources, tried in
+// order: header:<name>, bearer, query:<name> or cookie:<name>.
+func parseTokenSources(value string) (tokenextractor.RateLimiterTokenExtractor, error) {
+	extractors := []tokenextractor.RateLimiterTokenExtractor{}
+
+	for _, entry := range strings.Split(value, ",") {
+		source, name, _ := strings.Cut(strings.TrimSpace(entry), ":")
+
+		if source == "bearer" {
+			extractors = append(extractors, tokenextractor.NewBearerTokenExtractor())
+			continue
+		}
+
+		if name == "" {
+			return nil, fmt.Errorf("invalid token source \"%s\": expected header:<name>, bearer, query:<name> or cookie:<name>", entry)
+		}
+
+		switch source {
+		case "header":
+			extractors = append(extractors, tokenextractor.NewHeaderTokenExtractor(name))
+		case "query":
+			extractors = append(extractors, tokenextractor.NewQueryTokenExtractor(name))
+		case "cookie":
+			extractors = append(extractors, tokenextractor.NewCookieTokenExtractor(name))
+		default:
+			return nil, fmt.Errorf("invalid token source \"%s\": expected header:<name>, bearer, query:<name> or cookie:<name>", entry)
+		}
+	}
+
+	if len(extractors) == 1 {
+		return extractors[0], nil
+	}
+	return tokenextractor.NewChainTokenExtractor(extractors...), nil
+}
+
+func configureClientIP(config *RateLimiterConfig) {
+	if !config.DisableEnvs {
+		trustedProxies, ok := getStringEnv(envTrustedProxies)
+		if ok {
+			config.TrustedProxies = strings.Split(trustedProxies, ",")
+			config.GetLogger().Debug("using env", "env", envTrustedProxies)
+		}
+
+		trustedProxyHops, ok := getInt64Env(envTrustedProxyHops)
+		if ok {
+			config.TrustedProxyHops = trustedProxyHops
+			config.GetLogger().Debug("using env", "env", envTrustedProxyHops)
+		}
+
+		ipv4PrefixLength, ok := getInt64Env(envIPv4PrefixLength)
+		if ok {
+			config.IPv4PrefixLength = ipv4PrefixLength
+			config.GetLogger().Debug("using env", "env", envIPv4PrefixLength)
+		}
+
+		ipv6PrefixLength, ok := getInt64Env(envIPv6PrefixLength)
+		if ok {
+			config.IPv6PrefixLength = ipv6PrefixLength
+			config.GetLogger().Debug("using env", "env", envIPv6PrefixLength)
+		}
+	}
+
+	prefixes, err := parsePrefixes(config.TrustedProxies)
+	if err != nil {
+		config.GetLogger().Warn("ignoring trusted proxies", "error", err)
+		prefixes = []netip.Prefix{}
+	}
+	config.trustedProxyPrefixes = prefixes
+}
+
+func configureAccessList(config *RateLimiterConfig) {
+	if !config.DisableEnvs {
+		configureStringListFromEnv(config, &config.AllowedIPs, envAllowedIPs)
+		configureStringListFromEnv(config, &config.DeniedIPs, envDeniedIPs)
+		configureStringListFromEnv(config, &config.AllowedTokens, envAllowedTokens)
+		configureStringListFromEnv(config, &config.DeniedTokens, envDeniedTokens)
+
+		deniedStatusCode, ok := getInt64Env(envDeniedStatusCode)
+		if ok {
+			config.DeniedStatusCode = int(deniedStatusCode)
+			config.GetLogger().Debug("using env", "env", envDeniedStatusCode)
+		}
+
+		accessListFile, ok := getStringEnv(envAccessListFile)
+		if ok {
+			config.AccessListFile = accessListFile
+			config.GetLogger().Debug("using env", "env", envAccessListFile)
+		}
+	}
+
+	entries := &accessListEntries{
+		allowedIPs:    config.AllowedIPs,
+		deniedIPs:     config.DeniedIPs,
+		allowedTokens: config.AllowedTokens,
+		deniedTokens:  config.DeniedTokens,
+	}
+
+	if config.AccessListFile != "" {
+		fileEntries, err := loadAccessListFile(config.AccessListFile)
+		if err != nil {
+			addConfigurationProblem(config, "access list file: %s", err)
+		} else {
+			for _, value := range append(append([]string{}, fileEntries.allowedIPs...), fileEntries.deniedIPs...) {
+				_, err := parsePrefixes([]string{value})
+				if err != nil {
+					addConfigurationProblem(config, "access list file entry: %s", err)
+				}
+			}
+
+			entries.allowedIPs = append(append([]string{}, entries.allowedIPs...), fileEntries.allowedIPs...)
+			entries.deniedIPs = append(append([]string{}, entries.deniedIPs...), fileEntries.deniedIPs...)
+			entries.allowedTokens = append(append([]string{}, entries.allowedTokens...), fileEntries.allowedTokens...)
+			entries.deniedTokens = append(append([]string{}, entries.deniedTokens...), fileEntries.deniedTokens...)
+		}
+	}
+
+	if len(entries.allowedIPs)+len(entries.deniedIPs)+len(entries.allowedTokens)+len(entries.deniedTokens) == 0 {
+		config.accessList = nil
+		return
+	}
+
+	config.accessList = newAccessList()
+	configureAccessListIPs(config, config.accessList.allowedIPs, entries.allowedIPs)
+	configureAccessListIPs(config, config.accessList.deniedIPs, entries.deniedIPs)
+	for _, token := range entries.allowedTokens {
+		config.accessList.allowedTokens[token] = true
+	}
+	for _, token := range entries.deniedTokens {
+		config.accessList.deniedTokens[token] = true
+	}
+}
+
+func configureAccessListIPs(config *RateLimiterConfig, trie *prefixTrie, values []string) {
+	for _, value := range values {
+		prefixes, err := parsePrefixes([]string{value})
+		if err != nil {
+			config.GetLogger().Warn("ignoring access list entry", "error", err)
+			continue
+		}
+		trie.insert(prefixes[0])
+	}
+}
+
+func configureStringListFromEnv(config *RateLimiterConfig, list *[]string, envKey string) {
+	values, ok := getStringListEnv(envKey)
+	if ok {
+		*list = values
+		config.GetLogger().Debug("using env", "env", envKey)
+	}
+}
+
+func configureTokenSpraying(config *RateLimiterConfig) {
+	if config.DisableEnvs {
+		return
+	}
+
+	enforceIPAndToken, ok := getBoolEnv(envEnforceIPAndToken)
+	if ok {
+		config.EnforceIPAndToken = enforceIPAndToken
+		config.GetLogger().Debug("using env", "env", envEnforceIPAndToken)
+	}
+
+	maxTokens, ok := getInt64Env(envKeyMaxTokensPerIPPrefix)
+	if ok {
+		if config.MaxTokensPerIP == nil {
+			config.MaxTokensPerIP = &RateLimiterRateConfig{}
+		}
+		config.MaxTokensPerIP.MaxRequestsPerSecond = maxTokens
+		config.GetLogger().Debug("using env", "env", envKeyMaxTokensPerIPPrefix)
+	}
+
+	if config.MaxTokensPerIP != nil {
+		windowTimeEnvKey := envKeyMaxTokensPerIPPrefix + envKeySuffixWindowTime
+		wt, ok := getInt64Env(windowTimeEnvKey)
+		if ok {
+			config.MaxTokensPerIP.WindowMilliseconds = wt
+			config.GetLogger().Debug("using env", "env", windowTimeEnvKey)
+		}
+
+		blockTimeEnvKey := envKeyMaxTokensPerIPPrefix + envKeySuffixBlockTime
+		bt, ok := getInt64Env(blockTimeEnvKey)
+		if ok {
+			config.MaxTokensPerIP.BlockTimeMilliseconds = bt
+			config.GetLogger().Debug("using env", "env", blockTimeEnvKey)
+		}
+	}
+}
+
+func configureTokenStore(config *RateLimiterConfig) {
+	if config.DisableEnvs {
+		return
+	}
+
+	unknownTokens, ok := getStringEnv(envUnknownTokens)
+	if ok {
+		if unknownTokens != UnknownTokensAllow && unknownTokens != UnknownTokensReject && unknownTokens != UnknownTokensAsIP {
+			addConfigurationProblem(config, "env %s: expected allow, reject or ip", envUnknownTokens)
+		} else {
+			config.UnknownTokens = unknownTokens
+			config.GetLogger().Debug("using env", "env", envUnknownTokens)
+		}
+	}
+
+	tokenStore, ok := getStringEnv(envTokenStore)
+	if ok && config.reloading && config.TokenStore != nil && strings.HasPrefix(tokenStore, "redis") {
+		config.GetLogger().Debug("keeping TokenStore")
+	} else if ok {
+		store, err := parseTokenStore(config, tokenStore)
+		if err != nil {
+			addConfigurationProblem(config, "env %s: %s", envTokenStore, err)
+		} else {
+			config.TokenStore = store
+			config.GetLogger().Debug("using env", "env", envTokenStore)
+		}
+	}
+}
+
+// parseTokenStore parses a token store: file:<path> or redis[:<key>]. Redis
+// uses the Redis configuration or, if there is none, the RATE_LIMITER_REDIS_*
+// envs.
+func parseTokenStore(config *RateLimiterConfig, value string) (tokenstore.RateLimiterTokenStore, error) {
+	kind, argument, _ := strings.Cut(strings.TrimSpace(value), ":")
+
+	switch kind {
+	case "file":
+		if argument == "" {
+			return nil, fmt.Errorf("invalid token store \"%s\": expected file:<path> or redis[:<key>]", value)
+		}
+		return tokenstore.NewFileTokenStore(argument)
+	case "redis":
+		redisConfig := config.Redis
+		if redisConfig == nil {
+			var err error
+			redisConfig, err = getRedisConfigFromEnvs()
+			if err != nil {
+				return nil, err
+			}
+		}
+		return tokenstore.NewRedisTokenStore(newRedisClient(config, redisConfig), argument), nil
+	default:
+		return nil, fmt.Errorf("invalid token store \"%s\": expected file:<path> or redis[:<key>]", value)
 	}
 }
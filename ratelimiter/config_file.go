@@ -0,0 +1,88 @@
+package ratelimiter
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// LoadConfigFile reads a JSON (.json) or YAML (.yaml or .yml) configuration
+// file. Both use the JSON field names of RateLimiterConfig. Unknown fields are
+// errors, and the configuration is validated with Validate. Envs still
+// override the file, unless it sets disableEnvs.
+func LoadConfigFile(path string) (*RateLimiterConfig, error) {
+	content, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".json":
+	case ".yaml", ".yml":
+		content, err = convertYAMLToJSON(content)
+		if err != nil {
+			return nil, fmt.Errorf("invalid config file \"%s\": %w", path, err)
+		}
+	default:
+		return nil, fmt.Errorf("invalid config file \"%s\": expected a .json, .yaml or .yml file", path)
+	}
+
+	config := &RateLimiterConfig{}
+	decoder := json.NewDecoder(bytes.NewReader(content))
+	decoder.DisallowUnknownFields()
+	err = decoder.Decode(config)
+	if err != nil {
+		return nil, fmt.Errorf("invalid config file \"%s\": %w", path, err)
+	}
+
+	err = config.Validate()
+	if err != nil {
+		return nil, fmt.Errorf("invalid config file \"%s\":\n%w", path, err)
+	}
+
+	return config, nil
+}
+
+// convertYAMLToJSON converts YAML to JSON, so YAML files are decoded with the
+// JSON field names and the same checks as JSON files.
+func convertYAMLToJSON(content []byte) ([]byte, error) {
+	var value any
+	err := yaml.Unmarshal(content, &value)
+	if err != nil {
+		return nil, err
+	}
+	if value == nil {
+		value = map[string]any{}
+	}
+	return json.Marshal(normalizeYAMLValue(value))
+}
+
+// normalizeYAMLValue turns the maps with non string keys decoded by yaml.v3,
+// e.g. tokens made of digits, into maps with string keys.
+func normalizeYAMLValue(value any) any {
+	switch typedValue := value.(type) {
+	case map[string]any:
+		for key, item := range typedValue {
+			typedValue[key] = normalizeYAMLValue(item)
+		}
+		return typedValue
+	case map[any]any:
+		normalized := map[string]any{}
+		for key, item := range typedValue {
+			normalized[fmt.Sprint(key)] = normalizeYAMLValue(item)
+		}
+		return normalized
+	case []any:
+		for i, item := range typedValue {
+			typedValue[i] = normalizeYAMLValue(item)
+		}
+		return typedValue
+	default:
+		return value
+	}
+}
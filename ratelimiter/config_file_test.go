@@ -0,0 +1,131 @@
+package ratelimiter
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/suite"
+)
+
+type ConfigFileTestSuite struct {
+	suite.Suite
+}
+
+func TestConfigFileTestSuite(t *testing.T) {
+	suite.Run(t, new(ConfigFileTestSuite))
+}
+
+func (s *ConfigFileTestSuite) writeFile(name string, content string) string {
+	path := filepath.Join(s.T().TempDir(), name)
+	os.WriteFile(path, []byte(content), 0644)
+	return path
+}
+
+func (s *ConfigFileTestSuite) TestLoadConfigFile_JSONAndYAML() {
+	jsonPath := s.writeFile("config.json", `{
+		"ip": {"maxRequestsPerSecond": 10, "blockTimeMilliseconds": 1000},
+		"token": {"maxRequestsPerSecond": 20, "blockTimeMilliseconds": 500, "algorithm": "token_bucket"},
+		"tokens": {"abc": {"maxRequestsPerSecond": 30, "blockTimeMilliseconds": 100}, "123": {"maxRequestsPerSecond": 40, "blockTimeMilliseconds": 100}},
+		"rules": [{"id": "login", "path": "/login", "methods": ["POST"], "ip": {"maxRequestsPerSecond": 5, "blockTimeMilliseconds": 60000}}],
+		"trustedProxies": ["10.0.0.0/8"],
+		"redis": {"addresses": ["localhost:6379"], "db": 1},
+		"disableEnvs": true
+	}`)
+	yamlPath := s.writeFile("config.yaml", `
+ip:
+  maxRequestsPerSecond: 10
+  blockTimeMilliseconds: 1000
+token:
+  maxRequestsPerSecond: 20
+  blockTimeMilliseconds: 500
+  algorithm: token_bucket
+tokens:
+  abc: {maxRequestsPerSecond: 30, blockTimeMilliseconds: 100}
+  123: {maxRequestsPerSecond: 40, blockTimeMilliseconds: 100}
+rules:
+  - id: login
+    path: /login
+    methods: [POST]
+    ip: {maxRequestsPerSecond: 5, blockTimeMilliseconds: 60000}
+trustedProxies: [10.0.0.0/8]
+redis:
+  addresses: [localhost:6379]
+  db: 1
+disableEnvs: true
+`)
+
+	jsonConfig, err := LoadConfigFile(jsonPath)
+	assert.Nil(s.T(), err)
+	yamlConfig, err := LoadConfigFile(yamlPath)
+	assert.Nil(s.T(), err)
+
+	assert.Equal(s.T(), int64(10), jsonConfig.IP.MaxRequestsPerSecond)
+	assert.Equal(s.T(), AlgorithmTokenBucket, jsonConfig.Token.Algorithm)
+	assert.Equal(s.T(), int64(40), (*jsonConfig.CustomTokens)["123"].MaxRequestsPerSecond)
+	assert.Equal(s.T(), "login", jsonConfig.Rules[0].ID)
+	assert.Equal(s.T(), []string{"localhost:6379"}, jsonConfig.Redis.Addresses)
+	assert.True(s.T(), jsonConfig.DisableEnvs)
+
+	assert.Equal(s.T(), jsonConfig, yamlConfig)
+}
+
+func (s *ConfigFileTestSuite) TestLoadConfigFile_EmptyYAML() {
+	config, err := LoadConfigFile(s.writeFile("config.yml", ""))
+	assert.Nil(s.T(), err)
+	assert.Equal(s.T(), &RateLimiterConfig{}, config)
+}
+
+func (s *ConfigFileTestSuite) TestLoadConfigFile_Errors() {
+	_, err := LoadConfigFile(filepath.Join(s.T().TempDir(), "missing.json"))
+	assert.NotNil(s.T(), err)
+
+	_, err = LoadConfigFile(s.writeFile("config.toml", ""))
+	assert.ErrorContains(s.T(), err, "expected a .json, .yaml or .yml file")
+
+	_, err = LoadConfigFile(s.writeFile("config.json", `{"ip": {"maxRequests": 10}}`))
+	assert.ErrorContains(s.T(), err, `unknown field "maxRequests"`)
+
+	_, err = LoadConfigFile(s.writeFile("config.yaml", "ip:\n  maxRequestsPerSecond: ten\n"))
+	assert.ErrorContains(s.T(), err, "maxRequestsPerSecond")
+
+	_, err = LoadConfigFile(s.writeFile("config.yaml", "ip: [\n"))
+	assert.NotNil(s.T(), err)
+}
+
+func (s *ConfigFileTestSuite) TestLoadConfigFile_ValidationErrors() {
+	_, err := LoadConfigFile(s.writeFile("config.yaml", `
+ip:
+  maxRequestsPerSecond: -1
+  blockTimeMilliseconds: 0
+tokens:
+  abc: {maxRequestsPerSecond: 10}
+redis:
+  password: secret
+`))
+
+	assert.ErrorContains(s.T(), err, "ip.maxRequestsPerSecond: must be greater than 0, got -1")
+	assert.ErrorContains(s.T(), err, "ip.blockTimeMilliseconds: must be greater than 0, got 0")
+	assert.ErrorContains(s.T(), err, "tokens.abc.blockTimeMilliseconds: must be greater than 0, got 0")
+	assert.ErrorContains(s.T(), err, "redis.addresses: is required")
+}
+
+func (s *ConfigFileTestSuite) TestLoadConfigFile_TokenPlansFromPlansFile() {
+	plansPath := s.writeFile("plans.json", `{"plans": {"pro": {"maxRequestsPerSecond": 100, "blockTimeMilliseconds": 1000}}}`)
+	path := s.writeFile("config.json", `{
+		"plansFile": "`+plansPath+`",
+		"tokenPlans": {"abc": "pro"},
+		"disableEnvs": true
+	}`)
+
+	config, err := LoadConfigFile(path)
+	assert.Nil(s.T(), err)
+
+	config = setConfiguration(config)
+	assert.Nil(s.T(), config.Validate())
+	assert.Equal(s.T(), int64(100), config.Plans["pro"].MaxRequestsPerSecond)
+
+	_, err = LoadConfigFile(s.writeFile("config.json", `{"tokenPlans": {"abc": "pro"}}`))
+	assert.ErrorContains(s.T(), err, `tokenPlans.abc: plan "pro" does not exist`)
+}
@@ -1,9 +1,12 @@
 package ratelimiter
 
 import (
+	"net/http"
+	"net/http/httptest"
 	"os"
 	"testing"
 
+	"github.com/arfurlaneto/goexpert-challenge-rate-limiter/ratelimiter/adapter"
 	"github.com/arfurlaneto/goexpert-challenge-rate-limiter/ratelimiter/mocks"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/suite"
@@ -26,14 +29,50 @@ func (s *ConfigTestSuite) SetupTest() {
 	os.Unsetenv(envKeyTokenMaxRequestsPerSecond)
 	os.Unsetenv(envKeyTokenBlockTimeMilliseconds)
 	os.Unsetenv(envKeyDebug)
+	os.Unsetenv(envLegacyHeaders)
+	os.Unsetenv(envTokenSources)
+	os.Unsetenv(envTrustedProxies)
+	os.Unsetenv(envTrustedProxyHops)
+	os.Unsetenv(envIPv4PrefixLength)
+	os.Unsetenv(envIPv6PrefixLength)
+	os.Unsetenv(envEnforceIPAndToken)
+	os.Unsetenv(envKeyMaxTokensPerIPPrefix)
+	os.Unsetenv(envAllowedIPs)
+	os.Unsetenv(envDeniedIPs)
+	os.Unsetenv(envAllowedTokens)
+	os.Unsetenv(envDeniedTokens)
+	os.Unsetenv(envAccessListFile)
+	os.Unsetenv(envDeniedStatusCode)
+	os.Unsetenv(envPlansFile)
+	os.Unsetenv(envStoragePlans)
+	os.Unsetenv(envUnknownTokens)
+	os.Unsetenv(envTokenStore)
 	os.Unsetenv(envUseRedis)
 	os.Unsetenv(envRedisAddress)
 	os.Unsetenv(envRedisPassword)
 	os.Unsetenv(envRedisDB)
+	os.Unsetenv(envMemoryCleanupInterval)
+	os.Unsetenv(envMemoryMaxKeys)
+	os.Unsetenv(envMemoryShards)
+	os.Unsetenv(envRedisMasterName)
+	os.Unsetenv(envRedisSentinelPassword)
+	os.Unsetenv(envRedisCluster)
 	os.Unsetenv("RATE_LIMITER_TOKEN_abc_MAX_REQUESTS")
 	os.Unsetenv("RATE_LIMITER_TOKEN_abc_BLOCK_TIME")
 	os.Unsetenv("RATE_LIMITER_TOKEN_def_MAX_REQUESTS")
 	os.Unsetenv("RATE_LIMITER_TOKEN_def_BLOCK_TIME")
+	os.Unsetenv("RATE_LIMITER_IP_WINDOW_TIME")
+	os.Unsetenv("RATE_LIMITER_TOKEN_WINDOW_TIME")
+	os.Unsetenv("RATE_LIMITER_TOKEN_abc_WINDOW_TIME")
+	os.Unsetenv("RATE_LIMITER_IP_EXTRA_LIMITS")
+	os.Unsetenv("RATE_LIMITER_TOKEN_abc_EXTRA_LIMITS")
+	os.Unsetenv("RATE_LIMITER_IP_ALGORITHM")
+	os.Unsetenv("RATE_LIMITER_IP_BUCKET_CAPACITY")
+	os.Unsetenv("RATE_LIMITER_IP_REFILL_RATE")
+	os.Unsetenv("RATE_LIMITER_TOKEN_ALGORITHM")
+	os.Unsetenv("RATE_LIMITER_TOKEN_abc_ALGORITHM")
+	os.Unsetenv("RATE_LIMITER_TOKEN_abc_BUCKET_CAPACITY")
+	os.Unsetenv("RATE_LIMITER_TOKEN_abc_REFILL_RATE")
 }
 
 func (s *ConfigTestSuite) TestGetDefaultConfiguration() {
@@ -206,6 +245,178 @@ func (s *ConfigTestSuite) TestSetConfiguration_ValuesFromEnv_CustomTokenDefaults
 	assert.Equal(s.T(), (*config.CustomTokens)["def"].BlockTimeMilliseconds, int64(888))
 }
 
+func (s *ConfigTestSuite) TestSetConfiguration_ValuesFromEnv_TokenBucket() {
+	os.Setenv("RATE_LIMITER_IP_ALGORITHM", AlgorithmTokenBucket)
+	os.Setenv("RATE_LIMITER_IP_BUCKET_CAPACITY", "50")
+	os.Setenv("RATE_LIMITER_IP_REFILL_RATE", "5")
+	os.Setenv("RATE_LIMITER_TOKEN_ALGORITHM", AlgorithmTokenBucket)
+	os.Setenv("RATE_LIMITER_TOKEN_abc_BUCKET_CAPACITY", "70")
+	os.Setenv("RATE_LIMITER_TOKEN_abc_REFILL_RATE", "7")
+
+	config := setConfiguration(nil)
+	assert.NotNil(s.T(), config)
+	assert.Equal(s.T(), AlgorithmTokenBucket, config.IP.GetAlgorithm())
+	assert.Equal(s.T(), int64(50), config.IP.GetBucketCapacity())
+	assert.Equal(s.T(), int64(5), config.IP.GetRefillRatePerSecond())
+	assert.Equal(s.T(), AlgorithmTokenBucket, config.Token.GetAlgorithm())
+	assert.Equal(s.T(), config.Token.MaxRequestsPerSecond, config.Token.GetBucketCapacity())
+	assert.Equal(s.T(), config.Token.MaxRequestsPerSecond, config.Token.GetRefillRatePerSecond())
+	assert.Len(s.T(), *config.CustomTokens, 1)
+	assert.Contains(s.T(), *config.CustomTokens, "abc")
+	assert.Equal(s.T(), AlgorithmTokenBucket, (*config.CustomTokens)["abc"].GetAlgorithm())
+	assert.Equal(s.T(), int64(70), (*config.CustomTokens)["abc"].GetBucketCapacity())
+	assert.Equal(s.T(), int64(7), (*config.CustomTokens)["abc"].GetRefillRatePerSecond())
+}
+
+func (s *ConfigTestSuite) TestSetConfiguration_ValuesFromEnv_Window() {
+	os.Setenv("RATE_LIMITER_IP_WINDOW_TIME", "10000")
+	os.Setenv("RATE_LIMITER_TOKEN_WINDOW_TIME", "60000")
+	os.Setenv("RATE_LIMITER_TOKEN_abc_WINDOW_TIME", "3600000")
+
+	config := setConfiguration(nil)
+	assert.NotNil(s.T(), config)
+	assert.Equal(s.T(), int64(10000), config.IP.GetWindowMilliseconds())
+	assert.Equal(s.T(), int64(60000), config.Token.GetWindowMilliseconds())
+	assert.Len(s.T(), *config.CustomTokens, 1)
+	assert.Equal(s.T(), int64(3600000), (*config.CustomTokens)["abc"].GetWindowMilliseconds())
+}
+
+func (s *ConfigTestSuite) TestSetConfiguration_ValuesFromEnv_ExtraLimits() {
+	os.Setenv("RATE_LIMITER_IP_EXTRA_LIMITS", "minute:1000:60000:5000, day:50000:86400000:60000:gcra")
+	os.Setenv("RATE_LIMITER_TOKEN_abc_EXTRA_LIMITS", "hour:5000:3600000:10000")
+
+	config := setConfiguration(nil)
+	assert.NotNil(s.T(), config)
+	assert.Len(s.T(), config.IP.ExtraLimits, 2)
+	assert.Equal(s.T(), &RateLimiterRateConfig{Name: "minute", MaxRequestsPerSecond: 1000, WindowMilliseconds: 60000, BlockTimeMilliseconds: 5000}, config.IP.ExtraLimits[0])
+	assert.Equal(s.T(), &RateLimiterRateConfig{Name: "day", MaxRequestsPerSecond: 50000, WindowMilliseconds: 86400000, BlockTimeMilliseconds: 60000, Algorithm: AlgorithmGCRA}, config.IP.ExtraLimits[1])
+	assert.Empty(s.T(), config.Token.ExtraLimits)
+	assert.Len(s.T(), *config.CustomTokens, 1)
+	assert.Len(s.T(), (*config.CustomTokens)["abc"].ExtraLimits, 1)
+	assert.Equal(s.T(), "hour", (*config.CustomTokens)["abc"].ExtraLimits[0].GetName())
+}
+
+func (s *ConfigTestSuite) TestSetConfiguration_ValuesFromEnv_InvalidExtraLimits() {
+	os.Setenv("RATE_LIMITER_IP_EXTRA_LIMITS", "minute:abc:60000:5000")
+
+	config := setConfiguration(nil)
+	assert.NotNil(s.T(), config)
+	assert.Empty(s.T(), config.IP.ExtraLimits)
+}
+
+func (s *ConfigTestSuite) TestParseExtraLimits_Invalid() {
+	_, err := parseExtraLimits("minute:1000:60000")
+	assert.NotNil(s.T(), err)
+	_, err = parseExtraLimits("minute:1000:60000:5000,day")
+	assert.NotNil(s.T(), err)
+}
+
+func (s *ConfigTestSuite) TestGetLimits() {
+	minuteLimit := &RateLimiterRateConfig{MaxRequestsPerSecond: 1000, WindowMilliseconds: 60000}
+	rateConfig := &RateLimiterRateConfig{
+		MaxRequestsPerSecond: 20,
+		ExtraLimits:          []*RateLimiterRateConfig{minuteLimit, nil},
+	}
+	assert.Equal(s.T(), []*RateLimiterRateConfig{rateConfig, minuteLimit}, rateConfig.GetLimits())
+	assert.Equal(s.T(), "20-per-1000ms", rateConfig.GetName())
+	assert.Equal(s.T(), "1000-per-60000ms", minuteLimit.GetName())
+}
+
+func (s *ConfigTestSuite) TestGetWindowMilliseconds_DefaultsToOneSecond() {
+	rateConfig := &RateLimiterRateConfig{MaxRequestsPerSecond: 10}
+	assert.Equal(s.T(), int64(1000), rateConfig.GetWindowMilliseconds())
+}
+
+func (s *ConfigTestSuite) TestGetRefillRatePerSecond_SpreadOverWindow() {
+	rateConfig := &RateLimiterRateConfig{MaxRequestsPerSecond: 600, WindowMilliseconds: 60000}
+	assert.Equal(s.T(), int64(10), rateConfig.GetRefillRatePerSecond())
+}
+
+func (s *ConfigTestSuite) TestGetAlgorithm_DefaultsToSlidingWindow() {
+	rateConfig := &RateLimiterRateConfig{MaxRequestsPerSecond: 10}
+	assert.Equal(s.T(), AlgorithmSlidingWindow, rateConfig.GetAlgorithm())
+}
+
+func (s *ConfigTestSuite) TestGetQuota() {
+	rateConfig := &RateLimiterRateConfig{MaxRequestsPerSecond: 10}
+	assert.Equal(s.T(), int64(10), rateConfig.GetQuota())
+
+	rateConfig = &RateLimiterRateConfig{MaxRequestsPerSecond: 10, Algorithm: AlgorithmTokenBucket, BucketCapacity: 30}
+	assert.Equal(s.T(), int64(30), rateConfig.GetQuota())
+}
+
+func (s *ConfigTestSuite) TestSetConfiguration_LegacyHeadersFromEnv() {
+	os.Setenv(envLegacyHeaders, "true")
+
+	config := setConfiguration(nil)
+	assert.True(s.T(), config.LegacyHeaders)
+
+	config = setConfiguration(&RateLimiterConfig{DisableEnvs: true})
+	assert.False(s.T(), config.LegacyHeaders)
+}
+
+func (s *ConfigTestSuite) TestSetConfiguration_TokenSourcesFromEnv() {
+	os.Setenv(envTokenSources, "header:X-API-Key, bearer,query:api_key,cookie:api_key")
+
+	config := setConfiguration(nil)
+
+	request := httptest.NewRequest("GET", "http://testing/?api_key=query", nil)
+	request.AddCookie(&http.Cookie{Name: "api_key", Value: "cookie"})
+	assert.Equal(s.T(), "query", config.GetTokenExtractor().ExtractToken(request))
+
+	request.Header.Add("Authorization", "Bearer bearer")
+	assert.Equal(s.T(), "bearer", config.GetTokenExtractor().ExtractToken(request))
+
+	request.Header.Add("X-API-Key", "header")
+	assert.Equal(s.T(), "header", config.GetTokenExtractor().ExtractToken(request))
+
+	request.Header.Add("API_KEY", "default")
+	assert.Equal(s.T(), "header", config.GetTokenExtractor().ExtractToken(request))
+}
+
+func (s *ConfigTestSuite) TestSetConfiguration_InvalidTokenSourcesFromEnv() {
+	os.Setenv(envTokenSources, "header:X-API-Key,body:token")
+
+	config := setConfiguration(nil)
+
+	request := httptest.NewRequest("GET", "http://testing", nil)
+	request.Header.Add("API_KEY", "default")
+	assert.Equal(s.T(), "default", config.GetTokenExtractor().ExtractToken(request))
+}
+
+func (s *ConfigTestSuite) TestParseTokenSources_Invalid() {
+	for _, value := range []string{"body:token", "header", "query:", ""} {
+		_, err := parseTokenSources(value)
+		assert.NotNil(s.T(), err, value)
+	}
+}
+
+func (s *ConfigTestSuite) TestGetTokenExtractor_DefaultsToAPIKeyHeader() {
+	request := httptest.NewRequest("GET", "http://testing", nil)
+	request.Header.Add("API_KEY", "abc")
+
+	config := &RateLimiterConfig{}
+	assert.Equal(s.T(), "abc", config.GetTokenExtractor().ExtractToken(request))
+}
+
+func (s *ConfigTestSuite) TestSetConfiguration_MemoryAdapterOptions() {
+	os.Setenv(envMemoryCleanupInterval, "1000")
+	os.Setenv(envMemoryMaxKeys, "100")
+	os.Setenv(envMemoryShards, "4")
+
+	config := setConfiguration(nil)
+	assert.NotNil(s.T(), config)
+	assert.NotNil(s.T(), config.StorageAdapter)
+}
+
+func (s *ConfigTestSuite) TestSetConfiguration_MemoryAdapterOptionsNotUsedWithCustomAdapter() {
+	os.Setenv(envMemoryMaxKeys, "100")
+	storageAdapterMock := mocks.NewMockRateLimitStorageAdapter(s.controller)
+
+	config := setConfiguration(&RateLimiterConfig{StorageAdapter: storageAdapterMock})
+	assert.Equal(s.T(), storageAdapterMock, config.StorageAdapter)
+}
+
 func (s *ConfigTestSuite) TestSetConfiguration_RedisAdapter() {
 	os.Setenv(envUseRedis, "true")
 	os.Setenv(envRedisAddress, "localhost:6379")
@@ -223,6 +434,40 @@ func (s *ConfigTestSuite) TestSetConfiguration_RedisAdapter() {
 	assert.Equal(s.T(), false, config.Debug)
 }
 
+func (s *ConfigTestSuite) TestSetConfiguration_RedisAdapterSentinel() {
+	os.Setenv(envUseRedis, "true")
+	os.Setenv(envRedisAddress, "sentinel-1:26379,sentinel-2:26379")
+	os.Setenv(envRedisMasterName, "mymaster")
+	os.Setenv(envRedisSentinelPassword, "secret")
+
+	config := setConfiguration(nil)
+	assert.NotNil(s.T(), config)
+	assert.NotNil(s.T(), config.StorageAdapter)
+}
+
+func (s *ConfigTestSuite) TestSetConfiguration_RedisAdapterCluster() {
+	os.Setenv(envUseRedis, "true")
+	os.Setenv(envRedisAddress, "redis-1:6379")
+	os.Setenv(envRedisCluster, "true")
+
+	config := setConfiguration(nil)
+	assert.NotNil(s.T(), config)
+	assert.NotNil(s.T(), config.StorageAdapter)
+}
+
+func (s *ConfigTestSuite) TestSetConfiguration_RedisAdapterFromConfig() {
+	defaultStorageAdapter := getDefaultConfiguration().StorageAdapter
+
+	config := setConfiguration(&RateLimiterConfig{Redis: &RateLimiterRedisConfig{Addresses: []string{"localhost:6379"}}})
+	assert.IsType(s.T(), adapter.NewRateLimitRedisStorageAdapter("", "", 0), config.StorageAdapter)
+
+	config = setConfiguration(&RateLimiterConfig{
+		StorageAdapter: defaultStorageAdapter,
+		Redis:          &RateLimiterRedisConfig{Addresses: []string{"localhost:6379"}},
+	})
+	assert.Equal(s.T(), defaultStorageAdapter, config.StorageAdapter)
+}
+
 func (s *ConfigTestSuite) TestSetConfiguration_RedisAdapterErrMissingAddress() {
 	os.Setenv(envUseRedis, "true")
 	assert.Panics(s.T(), func() { setConfiguration(nil) }, "should panic")
@@ -251,3 +496,14 @@ func (s *ConfigTestSuite) TestGetRateLimiterRateConfigForToken() {
 	assert.Equal(s.T(), int64(444), zzzConfig.BlockTimeMilliseconds)
 	assert.Equal(s.T(), false, zzzIsCustom)
 }
+
+func (s *ConfigTestSuite) TestSetConfiguration_DisableEnvsKeepsRedisAndCustomTokens() {
+	os.Setenv(envUseRedis, "true")
+	os.Setenv(envRedisAddress, "localhost:6379")
+	os.Setenv("RATE_LIMITER_TOKEN_abc_MAX_REQUESTS", "555")
+
+	config := setConfiguration(&RateLimiterConfig{DisableEnvs: true})
+	assert.IsType(s.T(), adapter.NewRateLimitRedisStorageAdapter("localhost:6379", "", 0), config.StorageAdapter)
+	assert.Equal(s.T(), []string{"localhost:6379"}, config.Redis.Addresses)
+	assert.Equal(s.T(), int64(555), (*config.CustomTokens)["abc"].MaxRequestsPerSecond)
+}
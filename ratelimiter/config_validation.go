@@ -0,0 +1,173 @@
+package ratelimiter
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/arfurlaneto/goexpert-challenge-rate-limiter/ratelimiter/adapter"
+)
+
+// RateLimiterConfigError is a validation error of one configuration field.
+// Field is its path, with the JSON field names, e.g. "tokens.abc.windowMilliseconds".
+type RateLimiterConfigError struct {
+	Field   string
+	Message string
+}
+
+func (e *RateLimiterConfigError) Error() string {
+	return fmt.Sprintf("%s: %s", e.Field, e.Message)
+}
+
+// Validate checks the configuration. The returned error joins a
+// *RateLimiterConfigError for every invalid field. Fields left empty, which
+// get default values, are valid. Validate does not change the configuration,
+// so it can be called on one in use.
+func (c *RateLimiterConfig) Validate() error {
+	errs := []error{}
+	addError := func(field string, format string, a ...any) {
+		errs = append(errs, &RateLimiterConfigError{Field: field, Message: fmt.Sprintf(format, a...)})
+	}
+
+	validateRateConfig(c.IP, c.StorageAdapter, "ip", addError)
+	validateRateConfig(c.Token, c.StorageAdapter, "token", addError)
+	validateRateConfig(c.MaxTokensPerIP, c.StorageAdapter, "maxTokensPerIP", addError)
+
+	if c.CustomTokens != nil {
+		for _, token := range getSortedKeys(*c.CustomTokens) {
+			rateConfig := (*c.CustomTokens)[token]
+			if rateConfig != nil {
+				validateRateConfig(rateConfig, c.StorageAdapter, "tokens."+token, addError)
+			}
+		}
+	}
+
+	for _, plan := range getSortedKeys(c.Plans) {
+		if c.Plans[plan] == nil {
+			addError("plans."+plan, "must have limits")
+			continue
+		}
+		validateRateConfig(c.Plans[plan], c.StorageAdapter, "plans."+plan, addError)
+	}
+
+	// a plans file not loaded yet, as in LoadConfigFile, can still define
+	// the plans of the token plans
+	plansFileLoaded := c.PlansFile == "" || c.planCache != nil
+	if plansFileLoaded {
+		for _, token := range getSortedKeys(c.TokenPlans) {
+			if _, ok := c.Plans[c.TokenPlans[token]]; !ok {
+				addError("tokenPlans."+token, "plan \"%s\" does not exist", c.TokenPlans[token])
+			}
+		}
+	}
+
+	for i, rule := range c.Rules {
+		field := fmt.Sprintf("rules[%d]", i)
+		if rule == nil {
+			addError(field, "must not be empty")
+			continue
+		}
+		err := rule.validate()
+		if err != nil {
+			addError(field, "%s", err)
+		}
+		validateRateConfig(rule.IP, c.StorageAdapter, field+".ip", addError)
+		validateRateConfig(rule.Token, c.StorageAdapter, field+".token", addError)
+	}
+
+	validatePrefixes(c.TrustedProxies, "trustedProxies", addError)
+	if c.IPv4PrefixLength < 0 || c.IPv4PrefixLength > 32 {
+		addError("ipv4PrefixLength", "must be between 0 and 32, got %d", c.IPv4PrefixLength)
+	}
+	if c.IPv6PrefixLength < 0 || c.IPv6PrefixLength > 128 {
+		addError("ipv6PrefixLength", "must be between 0 and 128, got %d", c.IPv6PrefixLength)
+	}
+
+	validatePrefixes(c.AllowedIPs, "allowedIPs", addError)
+	validatePrefixes(c.DeniedIPs, "deniedIPs", addError)
+	if c.DeniedStatusCode != 0 && http.StatusText(c.DeniedStatusCode) == "" {
+		addError("deniedStatusCode", "must be an HTTP status code, got %d", c.DeniedStatusCode)
+	}
+
+	if c.UnknownTokens != "" && c.UnknownTokens != UnknownTokensAllow && c.UnknownTokens != UnknownTokensReject && c.UnknownTokens != UnknownTokensAsIP {
+		addError("unknownTokens", "must be %s, %s or %s, got \"%s\"", UnknownTokensAllow, UnknownTokensReject, UnknownTokensAsIP, c.UnknownTokens)
+	}
+
+	if c.Redis != nil && len(c.Redis.Addresses) == 0 {
+		addError("redis.addresses", "is required")
+	}
+	if c.Redis != nil && c.Redis.DB < 0 {
+		addError("redis.db", "must not be negative, got %d", c.Redis.DB)
+	}
+
+	return errors.Join(errs...)
+}
+
+func validateRateConfig(rateConfig *RateLimiterRateConfig, storageAdapter adapter.RateLimitStorageAdapter, field string, addError func(field string, format string, a ...any)) {
+	if rateConfig == nil {
+		return
+	}
+
+	switch rateConfig.GetAlgorithm() {
+	case AlgorithmSlidingWindow, AlgorithmGCRA:
+		if rateConfig.MaxRequestsPerSecond <= 0 {
+			addError(field+".maxRequestsPerSecond", "must be greater than 0, got %d", rateConfig.MaxRequestsPerSecond)
+		}
+		maxGCRARequests := rateConfig.GetWindowMilliseconds() * int64(time.Millisecond)
+		if rateConfig.GetAlgorithm() == AlgorithmGCRA && rateConfig.MaxRequestsPerSecond > maxGCRARequests {
+			addError(field+".maxRequestsPerSecond", "must be at most %d with the gcra algorithm (one request per nanosecond of the window), got %d", maxGCRARequests, rateConfig.MaxRequestsPerSecond)
+		}
+	case AlgorithmTokenBucket:
+		if rateConfig.GetBucketCapacity() <= 0 {
+			addError(field+".bucketCapacity", "must be greater than 0, got %d", rateConfig.GetBucketCapacity())
+		}
+		if rateConfig.RefillRatePerSecond < 0 {
+			addError(field+".refillRatePerSecond", "must not be negative, got %d", rateConfig.RefillRatePerSecond)
+		}
+	default:
+		addError(field+".algorithm", "must be %s, %s or %s, got \"%s\"", AlgorithmSlidingWindow, AlgorithmTokenBucket, AlgorithmGCRA, rateConfig.Algorithm)
+	}
+
+	if storageAdapter != nil && !isAlgorithmSupported(storageAdapter, rateConfig.GetAlgorithm()) {
+		addError(field+".algorithm", "%s", newUnsupportedAlgorithmError(rateConfig.GetAlgorithm()))
+	}
+	if storageAdapter != nil && !isWindowSupported(storageAdapter, rateConfig) {
+		addError(field+".windowMilliseconds", "%s", newUnsupportedWindowError(rateConfig.GetWindowMilliseconds()))
+	}
+
+	if strings.ContainsAny(rateConfig.Name, keyTypeSeparators) {
+		addError(field+".name", "must not contain \"@\" or \":\", got \"%s\"", rateConfig.Name)
+	}
+
+	if rateConfig.BlockTimeMilliseconds <= 0 {
+		addError(field+".blockTimeMilliseconds", "must be greater than 0, got %d", rateConfig.BlockTimeMilliseconds)
+	}
+	if rateConfig.WindowMilliseconds < 0 {
+		addError(field+".windowMilliseconds", "must not be negative, got %d", rateConfig.WindowMilliseconds)
+	}
+
+	for i, extraLimit := range rateConfig.ExtraLimits {
+		validateRateConfig(extraLimit, storageAdapter, fmt.Sprintf("%s.extraLimits[%d]", field, i), addError)
+	}
+}
+
+func validatePrefixes(values []string, field string, addError func(field string, format string, a ...any)) {
+	for i, value := range values {
+		_, err := parsePrefixes([]string{value})
+		if err != nil {
+			addError(fmt.Sprintf("%s[%d]", field, i), "%s", err)
+		}
+	}
+}
+
+func getSortedKeys[V any](values map[string]V) []string {
+	keys := make([]string, 0, len(values))
+	for key := range values {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
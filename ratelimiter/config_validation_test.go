@@ -0,0 +1,119 @@
+package ratelimiter
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/arfurlaneto/goexpert-challenge-rate-limiter/ratelimiter/adapter"
+	"github.com/arfurlaneto/goexpert-challenge-rate-limiter/ratelimiter/mocks"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/suite"
+	"go.uber.org/mock/gomock"
+)
+
+type ConfigValidationTestSuite struct {
+	suite.Suite
+}
+
+func TestConfigValidationTestSuite(t *testing.T) {
+	suite.Run(t, new(ConfigValidationTestSuite))
+}
+
+func (s *ConfigValidationTestSuite) TestValidate_Valid() {
+	assert.Nil(s.T(), (&RateLimiterConfig{}).Validate())
+	assert.Nil(s.T(), getDefaultConfiguration().Validate())
+}
+
+func (s *ConfigValidationTestSuite) TestValidate_EveryInvalidField() {
+	config := &RateLimiterConfig{
+		IP: &RateLimiterRateConfig{
+			MaxRequestsPerSecond:  10,
+			BlockTimeMilliseconds: 1000,
+			ExtraLimits: []*RateLimiterRateConfig{
+				{MaxRequestsPerSecond: 100, BlockTimeMilliseconds: 1000, WindowMilliseconds: -1},
+				{Name: "per:minute", MaxRequestsPerSecond: 100, BlockTimeMilliseconds: 1000, WindowMilliseconds: 60000},
+			},
+		},
+		Token:          &RateLimiterRateConfig{MaxRequestsPerSecond: 10, BlockTimeMilliseconds: 1000, Algorithm: "leaky_bucket"},
+		CustomTokens:   &map[string]*RateLimiterRateConfig{"abc": {Algorithm: AlgorithmTokenBucket, BlockTimeMilliseconds: 1000}},
+		Plans:          map[string]*RateLimiterRateConfig{"free": nil},
+		MaxTokensPerIP: &RateLimiterRateConfig{MaxRequestsPerSecond: 5},
+		Rules: []*RateLimiterRule{
+			{Path: "/login"},
+			{ID: "export", Path: "(", PathType: PathTypeRegex},
+			{ID: "login@v2", Path: "/v2/login"},
+		},
+		TrustedProxies:   []string{"10.0.0.0/33"},
+		IPv4PrefixLength: 33,
+		IPv6PrefixLength: -1,
+		DeniedIPs:        []string{"not-an-ip"},
+		DeniedStatusCode: 999,
+		UnknownTokens:    "drop",
+		Redis:            &RateLimiterRedisConfig{DB: -1},
+	}
+
+	err := config.Validate()
+
+	fields := []string{}
+	for _, err := range err.(interface{ Unwrap() []error }).Unwrap() {
+		configError := &RateLimiterConfigError{}
+		assert.True(s.T(), errors.As(err, &configError))
+		fields = append(fields, configError.Field)
+	}
+
+	assert.Equal(s.T(), []string{
+		"ip.extraLimits[0].windowMilliseconds",
+		"ip.extraLimits[1].name",
+		"token.algorithm",
+		"maxTokensPerIP.blockTimeMilliseconds",
+		"tokens.abc.bucketCapacity",
+		"plans.free",
+		"rules[0]",
+		"rules[1]",
+		"rules[2]",
+		"trustedProxies[0]",
+		"ipv4PrefixLength",
+		"ipv6PrefixLength",
+		"deniedIPs[0]",
+		"deniedStatusCode",
+		"unknownTokens",
+		"redis.addresses",
+		"redis.db",
+	}, fields)
+}
+
+func (s *ConfigValidationTestSuite) TestValidate_GCRALimit() {
+	config := &RateLimiterConfig{IP: &RateLimiterRateConfig{MaxRequestsPerSecond: 1000000000, BlockTimeMilliseconds: 1000, Algorithm: AlgorithmGCRA}}
+	assert.Nil(s.T(), config.Validate())
+
+	config.IP.MaxRequestsPerSecond = 1000000001
+	assert.EqualError(s.T(), config.Validate(), "ip.maxRequestsPerSecond: must be at most 1000000000 with the gcra algorithm (one request per nanosecond of the window), got 1000000001")
+
+	config.IP.Algorithm = AlgorithmSlidingWindow
+	assert.Nil(s.T(), config.Validate())
+}
+
+func (s *ConfigValidationTestSuite) TestValidate_StorageAdapterAlgorithms() {
+	config := &RateLimiterConfig{
+		IP:             &RateLimiterRateConfig{MaxRequestsPerSecond: 10, BlockTimeMilliseconds: 1000, WindowMilliseconds: 60000},
+		Token:          &RateLimiterRateConfig{MaxRequestsPerSecond: 10, BlockTimeMilliseconds: 1000, Algorithm: AlgorithmTokenBucket},
+		Plans:          map[string]*RateLimiterRateConfig{"pro": {MaxRequestsPerSecond: 10, BlockTimeMilliseconds: 1000, Algorithm: AlgorithmGCRA}},
+		StorageAdapter: mocks.NewMockRateLimitStorageAdapter(gomock.NewController(s.T())),
+	}
+	assert.EqualError(s.T(), config.Validate(), "ip.windowMilliseconds: the storage adapter does not support windows of 60000 milliseconds, only of 1000\ntoken.algorithm: the storage adapter does not support the token_bucket algorithm\nplans.pro.algorithm: the storage adapter does not support the gcra algorithm")
+
+	config.StorageAdapter = adapter.NewRateLimitMemoryStorageAdapter()
+	assert.Nil(s.T(), config.Validate())
+
+	config.StorageAdapter = mocks.NewMockRateLimitAtomicStorageAdapter(gomock.NewController(s.T()))
+	config.Token.Algorithm = AlgorithmSlidingWindow
+	config.Plans = nil
+	assert.Nil(s.T(), config.Validate())
+}
+
+func (s *ConfigValidationTestSuite) TestRedisConfig_MarshalJSONHidesPasswords() {
+	content, err := (&RateLimiterRedisConfig{Addresses: []string{"localhost:6379"}, Password: "secret", SentinelPassword: "secret"}).MarshalJSON()
+	assert.Nil(s.T(), err)
+	assert.NotContains(s.T(), string(content), "secret")
+	assert.Contains(s.T(), string(content), `"password":"***"`)
+}
@@ -0,0 +1,53 @@
+package ratelimiter
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+)
+
+const distinctTokensKeyType = "IP:tokens"
+const distinctTokenSeenKeyType = "IP:token"
+
+// checkDistinctTokens limits how many distinct tokens an IP may present per
+// window, using MaxTokensPerIP.MaxRequestsPerSecond as the number of tokens.
+// A token is counted the first time it is seen from the IP in the window,
+// which is tracked as a single access allowed per window on an IP and token
+// key.
+func checkDistinctTokens(ctx context.Context, ipKey string, token string, config *RateLimiterConfig) (*rateLimitDecision, error) {
+	limit := config.MaxTokensPerIP
+	windowMilliseconds := limit.GetWindowMilliseconds()
+
+	block, err := storageGetBlock(ctx, config, distinctTokensKeyType, ipKey)
+	if err != nil {
+		return nil, err
+	}
+	if block != nil {
+		return newBlockedDecision(block, limit), nil
+	}
+
+	firstTime, _, err := incrementAccesses(ctx, config, distinctTokenSeenKeyType, fmt.Sprintf("%s|%s", ipKey, token), 1, windowMilliseconds)
+	if err != nil {
+		return nil, err
+	}
+	if !firstTime {
+		return &rateLimitDecision{}, nil
+	}
+
+	success, count, err := incrementAccesses(ctx, config, distinctTokensKeyType, ipKey, limit.MaxRequestsPerSecond, windowMilliseconds)
+	if err != nil {
+		return nil, err
+	}
+	if success {
+		logKey(ctx, config, slog.LevelDebug, "distinct token counted", "IP", ipKey, "count", count, "max", limit.MaxRequestsPerSecond, "window_ms", windowMilliseconds)
+		return &rateLimitDecision{}, nil
+	}
+
+	logKey(ctx, config, slog.LevelDebug, "too many distinct tokens, adding a block", "IP", ipKey, "block_ms", limit.BlockTimeMilliseconds)
+	block, err = storageAddBlock(ctx, config, distinctTokensKeyType, ipKey, limit.BlockTimeMilliseconds)
+	if err != nil {
+		return nil, err
+	}
+
+	return newBlockedDecision(block, limit), nil
+}
@@ -0,0 +1,101 @@
+package ratelimiter
+
+import (
+	"context"
+	"errors"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/arfurlaneto/goexpert-challenge-rate-limiter/ratelimiter/adapter"
+	"github.com/arfurlaneto/goexpert-challenge-rate-limiter/ratelimiter/mocks"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/suite"
+	"go.uber.org/mock/gomock"
+)
+
+type DistinctTokensTestSuite struct {
+	suite.Suite
+	controller *gomock.Controller
+	context    context.Context
+}
+
+func TestDistinctTokensTestSuite(t *testing.T) {
+	suite.Run(t, new(DistinctTokensTestSuite))
+}
+
+func (s *DistinctTokensTestSuite) SetupTest() {
+	s.controller = gomock.NewController(s.T())
+	s.context = context.Background()
+	os.Unsetenv(envEnforceIPAndToken)
+	os.Unsetenv(envKeyMaxTokensPerIPPrefix)
+	os.Unsetenv(envKeyMaxTokensPerIPPrefix + envKeySuffixWindowTime)
+	os.Unsetenv(envKeyMaxTokensPerIPPrefix + envKeySuffixBlockTime)
+}
+
+func (s *DistinctTokensTestSuite) TearDownTest() {
+	s.SetupTest()
+}
+
+func (s *DistinctTokensTestSuite) TestCheckDistinctTokens() {
+	config := &RateLimiterConfig{
+		MaxTokensPerIP: &RateLimiterRateConfig{MaxRequestsPerSecond: 2, WindowMilliseconds: 60000, BlockTimeMilliseconds: 5000},
+		StorageAdapter: adapter.NewRateLimitMemoryStorageAdapter(),
+	}
+
+	for _, token := range []string{"a", "b", "a", "b", "a"} {
+		decision, err := checkDistinctTokens(s.context, "127.0.0.1", token, config)
+		assert.Nil(s.T(), err)
+		assert.Nil(s.T(), decision.block)
+	}
+
+	decision, err := checkDistinctTokens(s.context, "127.0.0.2", "c", config)
+	assert.Nil(s.T(), err)
+	assert.Nil(s.T(), decision.block)
+
+	decision, err = checkDistinctTokens(s.context, "127.0.0.1", "c", config)
+	assert.Nil(s.T(), err)
+	assert.NotNil(s.T(), decision.block)
+	assert.InDelta(s.T(), 5000, time.Until(*decision.block).Milliseconds(), 100)
+	assert.Equal(s.T(), config.MaxTokensPerIP, decision.limit)
+
+	decision, err = checkDistinctTokens(s.context, "127.0.0.1", "a", config)
+	assert.Nil(s.T(), err)
+	assert.NotNil(s.T(), decision.block)
+}
+
+func (s *DistinctTokensTestSuite) TestCheckDistinctTokens_Error() {
+	storageAdapterMock := mocks.NewMockRateLimitStorageAdapter(s.controller)
+	storageAdapterMock.EXPECT().GetBlock(gomock.Any(), distinctTokensKeyType, "127.0.0.1").Return(nil, nil)
+	storageAdapterMock.EXPECT().IncrementAccesses(gomock.Any(), distinctTokenSeenKeyType, "127.0.0.1|a", int64(1)).Return(false, int64(0), errors.New("error"))
+
+	config := &RateLimiterConfig{
+		MaxTokensPerIP: &RateLimiterRateConfig{MaxRequestsPerSecond: 2},
+		StorageAdapter: storageAdapterMock,
+	}
+
+	decision, err := checkDistinctTokens(s.context, "127.0.0.1", "a", config)
+	assert.NotNil(s.T(), err)
+	assert.Nil(s.T(), decision)
+}
+
+func (s *DistinctTokensTestSuite) TestConfigureTokenSpraying_FromEnv() {
+	os.Setenv(envEnforceIPAndToken, "true")
+	os.Setenv(envKeyMaxTokensPerIPPrefix, "3")
+	os.Setenv(envKeyMaxTokensPerIPPrefix+envKeySuffixWindowTime, "60000")
+	os.Setenv(envKeyMaxTokensPerIPPrefix+envKeySuffixBlockTime, "10000")
+
+	config := &RateLimiterConfig{}
+	configureTokenSpraying(config)
+
+	assert.True(s.T(), config.EnforceIPAndToken)
+	assert.Equal(s.T(), &RateLimiterRateConfig{MaxRequestsPerSecond: 3, WindowMilliseconds: 60000, BlockTimeMilliseconds: 10000}, config.MaxTokensPerIP)
+}
+
+func (s *DistinctTokensTestSuite) TestConfigureTokenSpraying_DisabledByDefault() {
+	config := &RateLimiterConfig{}
+	configureTokenSpraying(config)
+
+	assert.False(s.T(), config.EnforceIPAndToken)
+	assert.Nil(s.T(), config.MaxTokensPerIP)
+}
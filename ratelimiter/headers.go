@@ -0,0 +1,49 @@
+package ratelimiter
+
+import (
+	"math"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+const headerRateLimitLimit = "RateLimit-Limit"
+const headerRateLimitRemaining = "RateLimit-Remaining"
+const headerRateLimitReset = "RateLimit-Reset"
+const headerLegacyRateLimitLimit = "X-RateLimit-Limit"
+const headerLegacyRateLimitRemaining = "X-RateLimit-Remaining"
+const headerLegacyRateLimitReset = "X-RateLimit-Reset"
+const headerRetryAfter = "Retry-After"
+
+// writeRateLimitHeaders writes the quota of the decision limit. RateLimit-Reset
+// is the number of seconds until reset, while the legacy X-RateLimit-Reset is
+// a Unix timestamp. Blocked requests also get Retry-After.
+func writeRateLimitHeaders(w http.ResponseWriter, config *RateLimiterConfig, decision *rateLimitDecision) {
+	if decision.limit == nil {
+		return
+	}
+
+	limit := strconv.FormatInt(decision.limit.GetQuota(), 10)
+	remaining := strconv.FormatInt(decision.remaining, 10)
+	reset := strconv.FormatInt(getSecondsUntil(decision.reset), 10)
+
+	header := w.Header()
+	header.Set(headerRateLimitLimit, limit)
+	header.Set(headerRateLimitRemaining, remaining)
+	header.Set(headerRateLimitReset, reset)
+
+	if config.LegacyHeaders {
+		header.Set(headerLegacyRateLimitLimit, limit)
+		header.Set(headerLegacyRateLimitRemaining, remaining)
+		header.Set(headerLegacyRateLimitReset, strconv.FormatInt(int64(math.Ceil(float64(decision.reset.UnixMilli())/1000)), 10))
+	}
+
+	if decision.block != nil {
+		header.Set(headerRetryAfter, strconv.FormatInt(getSecondsUntil(*decision.block), 10))
+	}
+}
+
+// getSecondsUntil rounds up, so clients never retry before the time.
+func getSecondsUntil(t time.Time) int64 {
+	return max(0, int64(math.Ceil(time.Until(t).Seconds())))
+}
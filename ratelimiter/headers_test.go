@@ -0,0 +1,79 @@
+package ratelimiter
+
+import (
+	"net/http/httptest"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/suite"
+)
+
+type HeadersTestSuite struct {
+	suite.Suite
+}
+
+func TestHeadersTestSuite(t *testing.T) {
+	suite.Run(t, new(HeadersTestSuite))
+}
+
+func (s *HeadersTestSuite) TestWriteRateLimitHeaders_Allowed() {
+	recorder := httptest.NewRecorder()
+	decision := &rateLimitDecision{
+		limit:     &RateLimiterRateConfig{MaxRequestsPerSecond: 10},
+		remaining: 7,
+		reset:     time.Now().Add(1500 * time.Millisecond),
+	}
+
+	writeRateLimitHeaders(recorder, &RateLimiterConfig{}, decision)
+
+	assert.Equal(s.T(), "10", recorder.Header().Get("RateLimit-Limit"))
+	assert.Equal(s.T(), "7", recorder.Header().Get("RateLimit-Remaining"))
+	assert.Equal(s.T(), "2", recorder.Header().Get("RateLimit-Reset"))
+	assert.Empty(s.T(), recorder.Header().Get("Retry-After"))
+	assert.Empty(s.T(), recorder.Header().Get("X-RateLimit-Limit"))
+}
+
+func (s *HeadersTestSuite) TestWriteRateLimitHeaders_Blocked() {
+	recorder := httptest.NewRecorder()
+	block := time.Now().Add(2500 * time.Millisecond)
+
+	writeRateLimitHeaders(recorder, &RateLimiterConfig{}, newBlockedDecision(&block, &RateLimiterRateConfig{MaxRequestsPerSecond: 10}))
+
+	assert.Equal(s.T(), "10", recorder.Header().Get("RateLimit-Limit"))
+	assert.Equal(s.T(), "0", recorder.Header().Get("RateLimit-Remaining"))
+	assert.Equal(s.T(), "3", recorder.Header().Get("RateLimit-Reset"))
+	assert.Equal(s.T(), "3", recorder.Header().Get("Retry-After"))
+}
+
+func (s *HeadersTestSuite) TestWriteRateLimitHeaders_Legacy() {
+	recorder := httptest.NewRecorder()
+	reset := time.Now().Add(time.Minute)
+	decision := &rateLimitDecision{
+		limit:     &RateLimiterRateConfig{MaxRequestsPerSecond: 10},
+		remaining: 7,
+		reset:     reset,
+	}
+
+	writeRateLimitHeaders(recorder, &RateLimiterConfig{LegacyHeaders: true}, decision)
+
+	assert.Equal(s.T(), "10", recorder.Header().Get("X-RateLimit-Limit"))
+	assert.Equal(s.T(), "7", recorder.Header().Get("X-RateLimit-Remaining"))
+	resetUnix, err := strconv.ParseInt(recorder.Header().Get("X-RateLimit-Reset"), 10, 64)
+	assert.Nil(s.T(), err)
+	assert.InDelta(s.T(), reset.Unix(), resetUnix, 1)
+	assert.Equal(s.T(), "60", recorder.Header().Get("RateLimit-Reset"))
+}
+
+func (s *HeadersTestSuite) TestWriteRateLimitHeaders_NoLimit() {
+	recorder := httptest.NewRecorder()
+
+	writeRateLimitHeaders(recorder, &RateLimiterConfig{}, &rateLimitDecision{})
+
+	assert.Empty(s.T(), recorder.Header())
+}
+
+func (s *HeadersTestSuite) TestGetSecondsUntil_PastIsZero() {
+	assert.Equal(s.T(), int64(0), getSecondsUntil(time.Now().Add(-time.Second)))
+}
@@ -0,0 +1,90 @@
+package ratelimiter
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"log/slog"
+	"os"
+)
+
+// debugLogger is used when Debug is set without a Logger.
+var debugLogger = slog.New(slog.NewTextHandler(os.Stdout, &slog.HandlerOptions{Level: slog.LevelDebug}))
+
+// defaultLogger is used without Debug nor a Logger. It only keeps warnings and
+// errors, written to slog.Default().
+var defaultLogger = slog.New(&defaultLoggerHandler{level: slog.LevelWarn})
+
+// defaultLoggerHandler writes to the handler of slog.Default() at the time of
+// each record, so slog.SetDefault also applies to the rate limiter. The
+// attributes and groups added to it are replayed on that handler.
+type defaultLoggerHandler struct {
+	level slog.Level
+	with  []func(handler slog.Handler) slog.Handler
+}
+
+func (h *defaultLoggerHandler) getHandler() slog.Handler {
+	handler := slog.Default().Handler()
+	for _, with := range h.with {
+		handler = with(handler)
+	}
+	return handler
+}
+
+func (h *defaultLoggerHandler) Enabled(ctx context.Context, level slog.Level) bool {
+	return level >= h.level && h.getHandler().Enabled(ctx, level)
+}
+
+func (h *defaultLoggerHandler) Handle(ctx context.Context, record slog.Record) error {
+	return h.getHandler().Handle(ctx, record)
+}
+
+func (h *defaultLoggerHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	return h.withHandler(func(handler slog.Handler) slog.Handler {
+		return handler.WithAttrs(attrs)
+	})
+}
+
+func (h *defaultLoggerHandler) WithGroup(name string) slog.Handler {
+	return h.withHandler(func(handler slog.Handler) slog.Handler {
+		return handler.WithGroup(name)
+	})
+}
+
+func (h *defaultLoggerHandler) withHandler(with func(handler slog.Handler) slog.Handler) slog.Handler {
+	return &defaultLoggerHandler{level: h.level, with: append(append([]func(slog.Handler) slog.Handler{}, h.with...), with)}
+}
+
+// logKey logs a record about a key, with its key type, rule and key
+// attributes first.
+func logKey(ctx context.Context, config *RateLimiterConfig, level slog.Level, msg string, keyType string, key string, args ...any) {
+	logger := config.GetLogger()
+	if !logger.Enabled(ctx, level) {
+		return
+	}
+	logger.Log(ctx, level, msg, append(getLogKeyAttrs(config, keyType, key), args...)...)
+}
+
+// getLogKeyAttrs returns the attributes of a key, see splitKeyType. Tokens are
+// redacted with RedactTokens.
+func getLogKeyAttrs(config *RateLimiterConfig, keyType string, key string) []any {
+	keyType, ruleID := splitKeyType(keyType)
+	if keyType == "TOKEN" {
+		key = getLogToken(config, key)
+	}
+	return []any{"key_type", keyType, "rule", ruleID, "key", key}
+}
+
+// getLogToken returns the token, or the beginning of its SHA-256 hash with
+// RedactTokens, so the records of a token can still be matched.
+func getLogToken(config *RateLimiterConfig, token string) string {
+	if !config.RedactTokens {
+		return token
+	}
+	return redactToken(token)
+}
+
+func redactToken(token string) string {
+	hash := sha256.Sum256([]byte(token))
+	return "sha256:" + hex.EncodeToString(hash[:6])
+}
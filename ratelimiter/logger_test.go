@@ -0,0 +1,148 @@
+package ratelimiter
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/arfurlaneto/goexpert-challenge-rate-limiter/ratelimiter/adapter"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/suite"
+)
+
+type LoggerTestSuite struct {
+	suite.Suite
+	output *bytes.Buffer
+	logger *slog.Logger
+}
+
+func TestLoggerTestSuite(t *testing.T) {
+	suite.Run(t, new(LoggerTestSuite))
+}
+
+func (s *LoggerTestSuite) SetupTest() {
+	s.output = &bytes.Buffer{}
+	s.logger = slog.New(slog.NewJSONHandler(s.output, &slog.HandlerOptions{Level: slog.LevelDebug}))
+}
+
+// getRecords returns the records with the message.
+func (s *LoggerTestSuite) getRecords(msg string) []map[string]any {
+	records := []map[string]any{}
+	for _, line := range strings.Split(strings.TrimSpace(s.output.String()), "\n") {
+		record := map[string]any{}
+		if json.Unmarshal([]byte(line), &record) == nil && record["msg"] == msg {
+			records = append(records, record)
+		}
+	}
+	return records
+}
+
+func (s *LoggerTestSuite) serve(config *RateLimiterConfig, token string, count int) {
+	handler := rateLimiter(config, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(200)
+	}), checkRateLimit)
+
+	for i := 0; i < count; i++ {
+		request := httptest.NewRequest("GET", "http://testing/login", nil)
+		request.Header.Add("API_KEY", token)
+		handler.ServeHTTP(httptest.NewRecorder(), request)
+	}
+}
+
+func (s *LoggerTestSuite) getConfig() *RateLimiterConfig {
+	return setConfiguration(&RateLimiterConfig{
+		Token:          &RateLimiterRateConfig{MaxRequestsPerSecond: 1, WindowMilliseconds: 60000, BlockTimeMilliseconds: 60000},
+		Rules:          []*RateLimiterRule{{ID: "login", Path: "/login", Token: &RateLimiterRateConfig{Name: "login", MaxRequestsPerSecond: 1, WindowMilliseconds: 60000, BlockTimeMilliseconds: 60000}}},
+		StorageAdapter: adapter.NewRateLimitMemoryStorageAdapter(),
+		Logger:         s.logger,
+		DisableEnvs:    true,
+	})
+}
+
+func (s *LoggerTestSuite) TestStructuredRecords() {
+	s.serve(s.getConfig(), "abc", 2)
+
+	counted := s.getRecords("request counted")
+	assert.Len(s.T(), counted, 1)
+	assert.Equal(s.T(), "DEBUG", counted[0]["level"])
+	assert.Equal(s.T(), "TOKEN", counted[0]["key_type"])
+	assert.Equal(s.T(), "login", counted[0]["rule"])
+	assert.Equal(s.T(), "abc", counted[0]["key"])
+	assert.Equal(s.T(), float64(1), counted[0]["count"])
+	assert.Equal(s.T(), float64(1), counted[0]["max"])
+
+	blocked := s.getRecords("request blocked")
+	assert.Len(s.T(), blocked, 1)
+	assert.Equal(s.T(), "INFO", blocked[0]["level"])
+	assert.Equal(s.T(), "TOKEN", blocked[0]["key_type"])
+	assert.Equal(s.T(), "login", blocked[0]["rule"])
+	assert.Equal(s.T(), "abc", blocked[0]["key"])
+	assert.Equal(s.T(), "login", blocked[0]["limit"])
+	assert.InDelta(s.T(), 60000, blocked[0]["block_ms"], 100)
+}
+
+func (s *LoggerTestSuite) TestRedactTokens() {
+	config := s.getConfig()
+	config.CustomTokens = &map[string]*RateLimiterRateConfig{"secret": config.Token}
+	config.RedactTokens = true
+	s.output.Reset()
+	config = setConfiguration(config)
+
+	s.serve(config, "secret", 2)
+
+	blocked := s.getRecords("request blocked")
+	assert.Len(s.T(), blocked, 1)
+	assert.Equal(s.T(), getLogToken(config, "secret"), blocked[0]["key"])
+	assert.Regexp(s.T(), `^sha256:[0-9a-f]{12}$`, blocked[0]["key"])
+	assert.NotContains(s.T(), s.output.String(), "secret")
+	assert.Empty(s.T(), s.getRecords("using configuration"))
+}
+
+func (s *LoggerTestSuite) TestIgnoredValuesAreWarnings() {
+	setConfiguration(&RateLimiterConfig{TrustedProxies: []string{"invalid"}, Logger: s.logger, DisableEnvs: true})
+
+	records := s.getRecords("ignoring trusted proxies")
+	assert.Len(s.T(), records, 1)
+	assert.Equal(s.T(), "WARN", records[0]["level"])
+}
+
+func (s *LoggerTestSuite) TestGetLogger() {
+	assert.Equal(s.T(), s.logger, (&RateLimiterConfig{Logger: s.logger, Debug: true}).GetLogger())
+	assert.Equal(s.T(), debugLogger, (&RateLimiterConfig{Debug: true}).GetLogger())
+
+	logger := (&RateLimiterConfig{}).GetLogger()
+	assert.Equal(s.T(), defaultLogger, logger)
+	assert.False(s.T(), logger.Enabled(context.Background(), slog.LevelInfo))
+	assert.True(s.T(), logger.Enabled(context.Background(), slog.LevelWarn))
+}
+
+func (s *LoggerTestSuite) TestDefaultLoggerWritesToSlogDefault() {
+	previous := slog.Default()
+	defer slog.SetDefault(previous)
+	slog.SetDefault(s.logger)
+
+	defaultLogger.With("a", 1).WithGroup("g").Warn("warning", "b", 2)
+	defaultLogger.Info("information")
+
+	records := s.getRecords("warning")
+	assert.Len(s.T(), records, 1)
+	assert.Equal(s.T(), float64(1), records[0]["a"])
+	assert.Equal(s.T(), map[string]any{"b": float64(2)}, records[0]["g"])
+	assert.Empty(s.T(), s.getRecords("information"))
+}
+
+func (s *LoggerTestSuite) TestGetLogKeyAttrs() {
+	config := &RateLimiterConfig{}
+	assert.Equal(s.T(), []any{"key_type", "IP", "rule", "", "key", "127.0.0.1"}, getLogKeyAttrs(config, "IP", "127.0.0.1"))
+	assert.Equal(s.T(), []any{"key_type", "TOKEN", "rule", "login", "key", "abc"}, getLogKeyAttrs(config, "TOKEN@login:minute", "abc"))
+	assert.Equal(s.T(), []any{"key_type", "TOKEN", "rule", "", "key", "abc"}, getLogKeyAttrs(config, "TOKEN:minute", "abc"))
+
+	config.RedactTokens = true
+	assert.Equal(s.T(), []any{"key_type", "IP", "rule", "", "key", "127.0.0.1"}, getLogKeyAttrs(config, "IP", "127.0.0.1"))
+	assert.Equal(s.T(), []any{"key_type", "TOKEN", "rule", "", "key", getLogToken(config, "abc")}, getLogKeyAttrs(config, "TOKEN", "abc"))
+}
@@ -0,0 +1,21 @@
+package metrics
+
+import "time"
+
+// RateLimiterMetrics receives what the rate limiter does. Each key checked for
+// a request (its IP, its token, or both with EnforceIPAndToken) is reported
+// once as allowed, rejected or failed. KeyType is "IP" or "TOKEN" and ruleID is
+// the ID of the rule whose limits were applied, or empty.
+type RateLimiterMetrics interface {
+	RequestAllowed(keyType string, ruleID string)
+	// RequestRejected is called when the key is blocked, until blockedUntil.
+	// Requests rejected by the access list or as an unknown token have no
+	// block, so blockedUntil is zero. Tokens are redacted with RedactTokens.
+	RequestRejected(keyType string, ruleID string, key string, blockedUntil time.Time)
+	// StorageError is called when the storage adapter or token store failed,
+	// so the request was answered with an error.
+	StorageError(keyType string, ruleID string)
+	// StorageLatency is called after each storage adapter call, operation
+	// being the method name, like "IncrementAccesses".
+	StorageLatency(operation string, duration time.Duration)
+}
@@ -0,0 +1,19 @@
+package metrics
+
+import "time"
+
+type noopMetrics struct{}
+
+// NewNoopMetrics returns metrics that are discarded.
+func NewNoopMetrics() *noopMetrics {
+	return &noopMetrics{}
+}
+
+func (m *noopMetrics) RequestAllowed(keyType string, ruleID string) {}
+
+func (m *noopMetrics) RequestRejected(keyType string, ruleID string, key string, blockedUntil time.Time) {
+}
+
+func (m *noopMetrics) StorageError(keyType string, ruleID string) {}
+
+func (m *noopMetrics) StorageLatency(operation string, duration time.Duration) {}
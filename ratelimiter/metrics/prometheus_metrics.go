@@ -0,0 +1,154 @@
+package metrics
+
+import (
+	"sync"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+const prometheusNamespace = "rate_limiter"
+
+// minBlocksToRemoveExpired is how many blocks are tracked before the expired
+// ones are removed without waiting for a scrape.
+const minBlocksToRemoveExpired = 1024
+
+type activeBlock struct {
+	keyType string
+	ruleID  string
+	key     string
+}
+
+type prometheusMetrics struct {
+	allowed          *prometheus.CounterVec
+	rejected         *prometheus.CounterVec
+	storageErrors    *prometheus.CounterVec
+	storageLatency   *prometheus.HistogramVec
+	activeBlocksDesc *prometheus.Desc
+
+	blocksMutex           sync.Mutex
+	blocks                map[activeBlock]time.Time
+	blocksToRemoveExpired int
+}
+
+// NewPrometheusMetrics creates the metrics and registers them:
+//   - rate_limiter_requests_allowed_total{key_type, rule}
+//   - rate_limiter_requests_rejected_total{key_type, rule}
+//   - rate_limiter_storage_errors_total{key_type, rule}
+//   - rate_limiter_active_blocks{key_type, rule}
+//   - rate_limiter_storage_duration_seconds{operation}
+//
+// Active blocks are the blocks this instance rejected requests for that have
+// not ended yet.
+func NewPrometheusMetrics(registerer prometheus.Registerer) (*prometheusMetrics, error) {
+	labels := []string{"key_type", "rule"}
+
+	m := &prometheusMetrics{
+		allowed: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: prometheusNamespace,
+			Name:      "requests_allowed_total",
+			Help:      "Keys checked for a request that were allowed.",
+		}, labels),
+		rejected: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: prometheusNamespace,
+			Name:      "requests_rejected_total",
+			Help:      "Keys checked for a request that were blocked.",
+		}, labels),
+		storageErrors: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: prometheusNamespace,
+			Name:      "storage_errors_total",
+			Help:      "Requests answered with an error because the storage failed.",
+		}, labels),
+		storageLatency: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Namespace: prometheusNamespace,
+			Name:      "storage_duration_seconds",
+			Help:      "Duration of the storage adapter calls.",
+			Buckets:   prometheus.ExponentialBuckets(0.0001, 2, 16),
+		}, []string{"operation"}),
+		activeBlocksDesc: prometheus.NewDesc(
+			prometheus.BuildFQName(prometheusNamespace, "", "active_blocks"),
+			"Blocked keys whose block has not ended.",
+			labels, nil,
+		),
+		blocks:                map[activeBlock]time.Time{},
+		blocksToRemoveExpired: minBlocksToRemoveExpired,
+	}
+
+	err := registerer.Register(m)
+	if err != nil {
+		return nil, err
+	}
+
+	return m, nil
+}
+
+func (m *prometheusMetrics) RequestAllowed(keyType string, ruleID string) {
+	m.allowed.WithLabelValues(keyType, ruleID).Inc()
+}
+
+func (m *prometheusMetrics) RequestRejected(keyType string, ruleID string, key string, blockedUntil time.Time) {
+	m.rejected.WithLabelValues(keyType, ruleID).Inc()
+	if blockedUntil.IsZero() {
+		return
+	}
+
+	m.blocksMutex.Lock()
+	defer m.blocksMutex.Unlock()
+
+	m.blocks[activeBlock{keyType: keyType, ruleID: ruleID, key: key}] = blockedUntil
+
+	if len(m.blocks) >= m.blocksToRemoveExpired {
+		m.removeExpiredBlocks(time.Now())
+		m.blocksToRemoveExpired = max(minBlocksToRemoveExpired, 2*len(m.blocks))
+	}
+}
+
+func (m *prometheusMetrics) StorageError(keyType string, ruleID string) {
+	m.storageErrors.WithLabelValues(keyType, ruleID).Inc()
+}
+
+func (m *prometheusMetrics) StorageLatency(operation string, duration time.Duration) {
+	m.storageLatency.WithLabelValues(operation).Observe(duration.Seconds())
+}
+
+func (m *prometheusMetrics) Describe(ch chan<- *prometheus.Desc) {
+	m.allowed.Describe(ch)
+	m.rejected.Describe(ch)
+	m.storageErrors.Describe(ch)
+	m.storageLatency.Describe(ch)
+	ch <- m.activeBlocksDesc
+}
+
+func (m *prometheusMetrics) Collect(ch chan<- prometheus.Metric) {
+	m.allowed.Collect(ch)
+	m.rejected.Collect(ch)
+	m.storageErrors.Collect(ch)
+	m.storageLatency.Collect(ch)
+
+	for labels, count := range m.countActiveBlocks() {
+		ch <- prometheus.MustNewConstMetric(m.activeBlocksDesc, prometheus.GaugeValue, float64(count), labels.keyType, labels.ruleID)
+	}
+}
+
+// countActiveBlocks removes the expired blocks and counts the others by key
+// type and rule.
+func (m *prometheusMetrics) countActiveBlocks() map[activeBlock]int {
+	m.blocksMutex.Lock()
+	defer m.blocksMutex.Unlock()
+
+	m.removeExpiredBlocks(time.Now())
+
+	counts := map[activeBlock]int{}
+	for block := range m.blocks {
+		counts[activeBlock{keyType: block.keyType, ruleID: block.ruleID}]++
+	}
+	return counts
+}
+
+func (m *prometheusMetrics) removeExpiredBlocks(now time.Time) {
+	for block, blockedUntil := range m.blocks {
+		if !blockedUntil.After(now) {
+			delete(m.blocks, block)
+		}
+	}
+}
@@ -0,0 +1,106 @@
+package metrics
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/suite"
+)
+
+type PrometheusMetricsTestSuite struct {
+	suite.Suite
+	registry *prometheus.Registry
+}
+
+func TestPrometheusMetricsTestSuite(t *testing.T) {
+	suite.Run(t, new(PrometheusMetricsTestSuite))
+}
+
+func (s *PrometheusMetricsTestSuite) SetupTest() {
+	s.registry = prometheus.NewRegistry()
+}
+
+func (s *PrometheusMetricsTestSuite) TestCounters() {
+	m, err := NewPrometheusMetrics(s.registry)
+	assert.Nil(s.T(), err)
+
+	m.RequestAllowed("IP", "")
+	m.RequestAllowed("IP", "")
+	m.RequestAllowed("TOKEN", "login")
+	m.RequestRejected("IP", "", "127.0.0.1", time.Now().Add(time.Minute))
+	m.StorageError("TOKEN", "")
+
+	expected := `
+# HELP rate_limiter_requests_allowed_total Keys checked for a request that were allowed.
+# TYPE rate_limiter_requests_allowed_total counter
+rate_limiter_requests_allowed_total{key_type="IP",rule=""} 2
+rate_limiter_requests_allowed_total{key_type="TOKEN",rule="login"} 1
+# HELP rate_limiter_requests_rejected_total Keys checked for a request that were blocked.
+# TYPE rate_limiter_requests_rejected_total counter
+rate_limiter_requests_rejected_total{key_type="IP",rule=""} 1
+# HELP rate_limiter_storage_errors_total Requests answered with an error because the storage failed.
+# TYPE rate_limiter_storage_errors_total counter
+rate_limiter_storage_errors_total{key_type="TOKEN",rule=""} 1
+`
+	err = testutil.GatherAndCompare(s.registry, strings.NewReader(expected),
+		"rate_limiter_requests_allowed_total", "rate_limiter_requests_rejected_total", "rate_limiter_storage_errors_total")
+	assert.Nil(s.T(), err)
+}
+
+func (s *PrometheusMetricsTestSuite) TestActiveBlocks() {
+	m, err := NewPrometheusMetrics(s.registry)
+	assert.Nil(s.T(), err)
+
+	m.RequestRejected("IP", "", "127.0.0.1", time.Now().Add(time.Minute))
+	m.RequestRejected("IP", "", "127.0.0.1", time.Now().Add(time.Minute))
+	m.RequestRejected("IP", "", "127.0.0.2", time.Now().Add(time.Minute))
+	m.RequestRejected("TOKEN", "login", "abc", time.Now().Add(time.Minute))
+	m.RequestRejected("TOKEN", "", "def", time.Now().Add(-time.Second))
+	m.RequestRejected("TOKEN", "", "ghi", time.Time{})
+
+	expected := `
+# HELP rate_limiter_active_blocks Blocked keys whose block has not ended.
+# TYPE rate_limiter_active_blocks gauge
+rate_limiter_active_blocks{key_type="IP",rule=""} 2
+rate_limiter_active_blocks{key_type="TOKEN",rule="login"} 1
+`
+	err = testutil.GatherAndCompare(s.registry, strings.NewReader(expected), "rate_limiter_active_blocks")
+	assert.Nil(s.T(), err)
+	assert.Len(s.T(), m.blocks, 3)
+}
+
+func (s *PrometheusMetricsTestSuite) TestActiveBlocks_RemovesExpiredWithoutScrapes() {
+	m, err := NewPrometheusMetrics(s.registry)
+	assert.Nil(s.T(), err)
+
+	for i := 0; i < minBlocksToRemoveExpired; i++ {
+		m.RequestRejected("IP", "", string(rune(i)), time.Now().Add(-time.Second))
+	}
+
+	assert.Empty(s.T(), m.blocks)
+}
+
+func (s *PrometheusMetricsTestSuite) TestStorageLatency() {
+	m, err := NewPrometheusMetrics(s.registry)
+	assert.Nil(s.T(), err)
+
+	m.StorageLatency("GetBlock", time.Millisecond)
+	m.StorageLatency("GetBlock", 2*time.Millisecond)
+	m.StorageLatency("AddBlock", time.Millisecond)
+
+	count, err := testutil.GatherAndCount(s.registry, "rate_limiter_storage_duration_seconds")
+	assert.Nil(s.T(), err)
+	assert.Equal(s.T(), 2, count)
+}
+
+func (s *PrometheusMetricsTestSuite) TestNewPrometheusMetrics_AlreadyRegistered() {
+	_, err := NewPrometheusMetrics(s.registry)
+	assert.Nil(s.T(), err)
+
+	_, err = NewPrometheusMetrics(s.registry)
+	assert.NotNil(s.T(), err)
+}
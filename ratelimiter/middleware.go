@@ -2,48 +2,285 @@ package ratelimiter
 
 import (
 	"context"
-	"net"
+	"log/slog"
 	"net/http"
 	"time"
+
+	"github.com/arfurlaneto/goexpert-challenge-rate-limiter/ratelimiter/responsewriter"
 )
 
-type rateLimiterCheckFunction = func(ctx context.Context, keyType string, key string, config *RateLimiterConfig, rateConfig *RateLimiterRateConfig) (*time.Time, error)
+type rateLimiterCheckFunction = func(ctx context.Context, keyType string, key string, config *RateLimiterConfig, rateConfig *RateLimiterRateConfig) (*rateLimitDecision, error)
 
 func NewRateLimiter() func(next http.Handler) http.Handler {
 	return NewRateLimiterWithConfig(nil)
 }
 
 func NewRateLimiterWithConfig(config *RateLimiterConfig) func(next http.Handler) http.Handler {
-	config = setConfiguration(config)
-	return func(next http.Handler) http.Handler {
-		return rateLimiter(config, next, checkRateLimit)
-	}
+	return NewReloadableRateLimiter(config).Handler
+}
+
+// rateLimitTarget is a key checked for a request, with the limits that apply
+// to it. storageKeyType also carries the rule ID, if a rule matched.
+type rateLimitTarget struct {
+	keyType        string
+	storageKeyType string
+	key            string
+	ruleID         string
+	rateConfig     *RateLimiterRateConfig
 }
 
 func rateLimiter(config *RateLimiterConfig, next http.Handler, checkRateLimitFn rateLimiterCheckFunction) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		var block *time.Time
-		var err error
+		serveRateLimited(config, next, checkRateLimitFn, w, r)
+	})
+}
+
+func serveRateLimited(config *RateLimiterConfig, next http.Handler, checkRateLimitFn rateLimiterCheckFunction, w http.ResponseWriter, r *http.Request) {
+	ctx, span := startSpan(r.Context(), config, requestSpanName)
+	allowed := checkRequest(ctx, config, checkRateLimitFn, w, r)
+	span.End()
+
+	if allowed {
+		next.ServeHTTP(w, r)
+	}
+}
+
+// checkRequest checks a request against the access list and its limits,
+// writing the response when it is not allowed. ctx holds the request span,
+// the parent of the spans of the checks and storage calls.
+func checkRequest(ctx context.Context, config *RateLimiterConfig, checkRateLimitFn rateLimiterCheckFunction, w http.ResponseWriter, r *http.Request) bool {
+	clientIP, clientIPOk := resolveClientIP(config, r)
+	token := config.GetTokenExtractor().ExtractToken(r)
+
+	switch config.accessList.check(clientIP, clientIPOk, token) {
+	case accessListDenied:
+		keyType, key := config.accessList.getDeniedKey(clientIP, clientIPOk, token)
+		reportRejectedRequest(config, keyType, "", key, time.Time{})
+		config.GetLogger().Info("request denied by the access list", "remote_addr", r.RemoteAddr)
+		writeRejectedResponse(w, r, config, &responsewriter.RateLimiterDecision{
+			Reason:     responsewriter.ReasonDenied,
+			StatusCode: config.GetDeniedStatusCode(),
+			KeyType:    keyType,
+			Key:        key,
+		})
+		return false
+	case accessListAllowed:
+		return true
+	}
 
-		token := r.Header.Get("API_KEY")
-		if token != "" {
-			tokenConfig, _ := config.GetRateLimiterRateConfigForToken(token)
-			block, err = checkRateLimitFn(r.Context(), "TOKEN", token, config, tokenConfig)
-		} else {
-			host, _, _ := net.SplitHostPort(r.RemoteAddr)
-			block, err = checkRateLimitFn(r.Context(), "IP", host, config, config.IP)
+	var tokenRateConfig *RateLimiterRateConfig
+	if token != "" {
+		rateConfig, known, err := getTokenRateConfig(ctx, config, token)
+		if err != nil {
+			config.GetMetrics().StorageError("TOKEN", "")
+			writeErrorResponse(w, r, config, err)
+			return false
+		}
+
+		if !known && config.GetUnknownTokens() != UnknownTokensAllow {
+			known, err = isStoredToken(ctx, config, token)
+			if err != nil {
+				config.GetMetrics().StorageError("TOKEN", "")
+				writeErrorResponse(w, r, config, err)
+				return false
+			}
+			if !known && config.GetUnknownTokens() == UnknownTokensReject {
+				reportRejectedRequest(config, "TOKEN", "", token, time.Time{})
+				config.GetLogger().Info("request rejected: unknown token", "remote_addr", r.RemoteAddr, "key", getLogToken(config, token))
+				writeRejectedResponse(w, r, config, &responsewriter.RateLimiterDecision{
+					Reason:     responsewriter.ReasonUnknownToken,
+					StatusCode: http.StatusUnauthorized,
+					KeyType:    "TOKEN",
+					Key:        token,
+				})
+				return false
+			}
+			if !known {
+				token = ""
+			}
 		}
 
+		tokenRateConfig = rateConfig
+	}
+
+	ipKey := getClientIPKey(config, clientIP, clientIPOk)
+
+	if token != "" && config.MaxTokensPerIP != nil {
+		decision, err := checkDistinctTokens(ctx, ipKey, token, config)
 		if err != nil {
-			config.ResponseWriter.WriteError(&w, err)
-			return
+			config.GetMetrics().StorageError("IP", "")
+			writeErrorResponse(w, r, config, err)
+			return false
+		}
+		if decision.block != nil {
+			target := rateLimitTarget{keyType: "IP", key: ipKey}
+			reportRejectedRequest(config, target.keyType, target.ruleID, target.key, *decision.block)
+			logBlockedRequest(r, config, target, decision)
+			writeRateLimitHeaders(w, config, decision)
+			writeBlockedResponse(w, r, config, target, decision)
+			return false
 		}
+	}
 
-		if block != nil {
-			config.ResponseWriter.WriteResponse(&w)
-			return
+	// the request is only allowed once every target allows it, and the
+	// targets that allowed it give it back when a later one rejects it
+	var decision *rateLimitDecision
+	allowedTargets := []rateLimitTarget{}
+	for _, target := range getRateLimitTargets(config, r, ipKey, token, tokenRateConfig) {
+		targetDecision, err := checkRateLimitFn(ctx, target.storageKeyType, target.key, config, target.rateConfig)
+		if err != nil {
+			refundRateLimitTargets(ctx, config, allowedTargets)
+			config.GetMetrics().StorageError(target.keyType, target.ruleID)
+			writeErrorResponse(w, r, config, err)
+			return false
 		}
 
-		next.ServeHTTP(w, r)
-	})
+		if targetDecision.block != nil {
+			refundRateLimitTargets(ctx, config, allowedTargets)
+			reportRejectedRequest(config, target.keyType, target.ruleID, target.key, *targetDecision.block)
+			logBlockedRequest(r, config, target, targetDecision)
+			writeRateLimitHeaders(w, config, targetDecision)
+			writeBlockedResponse(w, r, config, target, targetDecision)
+			return false
+		}
+
+		allowedTargets = append(allowedTargets, target)
+		decision = getMostRestrictiveDecision(decision, targetDecision)
+	}
+
+	for _, target := range allowedTargets {
+		config.GetMetrics().RequestAllowed(target.keyType, target.ruleID)
+	}
+
+	writeRateLimitHeaders(w, config, decision)
+	return true
+}
+
+// getRateLimitTargets returns the token, or the IP when there is no token.
+// With EnforceIPAndToken, requests with a token are checked by IP too.
+func getRateLimitTargets(config *RateLimiterConfig, r *http.Request, ipKey string, token string, tokenRateConfig *RateLimiterRateConfig) []rateLimitTarget {
+	rule := getRule(config, r)
+	targets := []rateLimitTarget{}
+
+	if token == "" || config.EnforceIPAndToken {
+		target := rateLimitTarget{keyType: "IP", storageKeyType: "IP", key: ipKey, rateConfig: config.IP}
+		if rule != nil && rule.IP != nil {
+			target.storageKeyType = getRuleKeyType(target.keyType, rule)
+			target.ruleID = rule.ID
+			target.rateConfig = rule.IP
+		}
+		targets = append(targets, target)
+	}
+
+	if token != "" {
+		target := rateLimitTarget{keyType: "TOKEN", storageKeyType: "TOKEN", key: token, rateConfig: tokenRateConfig}
+		if rule != nil && rule.Token != nil {
+			target.storageKeyType = getRuleKeyType(target.keyType, rule)
+			target.ruleID = rule.ID
+			target.rateConfig = rule.Token
+		}
+		targets = append(targets, target)
+	}
+
+	return targets
+}
+
+// refundRateLimitTargets gives a rejected request back to the targets that
+// allowed it.
+func refundRateLimitTargets(ctx context.Context, config *RateLimiterConfig, targets []rateLimitTarget) {
+	for _, target := range targets {
+		refundRateLimit(ctx, target.storageKeyType, target.key, config, target.rateConfig)
+	}
+}
+
+// getMostRestrictiveDecision keeps the decision with the fewest requests left,
+// which is the one reported in the headers.
+func getMostRestrictiveDecision(current *rateLimitDecision, other *rateLimitDecision) *rateLimitDecision {
+	if current == nil || current.limit == nil {
+		return other
+	}
+	if other.limit != nil && other.remaining < current.remaining {
+		return other
+	}
+	return current
+}
+
+// reportRejectedRequest reports a rejected request to the metrics, with the
+// token redacted as in the logs.
+func reportRejectedRequest(config *RateLimiterConfig, keyType string, ruleID string, key string, blockedUntil time.Time) {
+	if keyType == "TOKEN" {
+		key = getLogToken(config, key)
+	}
+	config.GetMetrics().RequestRejected(keyType, ruleID, key, blockedUntil)
+}
+
+// logBlockedRequest logs a request rejected because one of its keys is
+// blocked.
+func logBlockedRequest(r *http.Request, config *RateLimiterConfig, target rateLimitTarget, decision *rateLimitDecision) {
+	logger := config.GetLogger()
+	if !logger.Enabled(r.Context(), slog.LevelInfo) {
+		return
+	}
+
+	key := target.key
+	if target.keyType == "TOKEN" {
+		key = getLogToken(config, key)
+	}
+
+	args := []any{"key_type", target.keyType, "rule", target.ruleID, "key", key, "block_ms", time.Until(*decision.block).Milliseconds()}
+	if decision.limit != nil {
+		args = append(args, "limit", decision.limit.GetName(), "max", decision.limit.GetQuota())
+	}
+	logger.InfoContext(r.Context(), "request blocked", args...)
+}
+
+func writeErrorResponse(w http.ResponseWriter, r *http.Request, config *RateLimiterConfig, err error) {
+	config.GetLogger().ErrorContext(r.Context(), "rate limiter error", "error", err)
+	decisionResponseWriter, ok := config.ResponseWriter.(responsewriter.RateLimiterDecisionResponseWriter)
+	if ok {
+		decisionResponseWriter.WriteRequestError(&w, r, err)
+	} else {
+		config.ResponseWriter.WriteError(&w, err)
+	}
+}
+
+func writeBlockedResponse(w http.ResponseWriter, r *http.Request, config *RateLimiterConfig, target rateLimitTarget, decision *rateLimitDecision) {
+	decisionResponseWriter, ok := config.ResponseWriter.(responsewriter.RateLimiterDecisionResponseWriter)
+	if ok {
+		decisionResponseWriter.WriteDecisionResponse(&w, r, newResponseWriterDecision(target.keyType, target.key, target.ruleID, decision))
+	} else {
+		config.ResponseWriter.WriteResponse(&w)
+	}
+}
+
+// writeRejectedResponse writes the response of a request rejected for another
+// reason than its limits. Response writers that do not handle decisions only
+// know how to answer rate limited requests, so the status code is written
+// as is for them.
+func writeRejectedResponse(w http.ResponseWriter, r *http.Request, config *RateLimiterConfig, decision *responsewriter.RateLimiterDecision) {
+	decisionResponseWriter, ok := config.ResponseWriter.(responsewriter.RateLimiterDecisionResponseWriter)
+	if ok {
+		decisionResponseWriter.WriteDecisionResponse(&w, r, decision)
+	} else {
+		w.WriteHeader(decision.StatusCode)
+		w.Write([]byte(http.StatusText(decision.StatusCode)))
+	}
+}
+
+func newResponseWriterDecision(keyType string, key string, ruleID string, decision *rateLimitDecision) *responsewriter.RateLimiterDecision {
+	responseWriterDecision := &responsewriter.RateLimiterDecision{
+		Reason:       responsewriter.ReasonRateLimited,
+		StatusCode:   http.StatusTooManyRequests,
+		KeyType:      keyType,
+		Key:          key,
+		RuleID:       ruleID,
+		Remaining:    decision.remaining,
+		Reset:        decision.reset,
+		BlockedUntil: decision.block,
+	}
+	if decision.limit != nil {
+		responseWriterDecision.LimitName = decision.limit.GetName()
+		responseWriterDecision.Limit = decision.limit.GetQuota()
+	}
+	return responseWriterDecision
 }
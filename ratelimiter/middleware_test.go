@@ -3,13 +3,22 @@ package ratelimiter
 import (
 	"context"
 	"errors"
+	"fmt"
 	"io/ioutil"
 	"net/http"
 	"net/http/httptest"
+	"strings"
 	"testing"
 	"time"
 
+	"github.com/arfurlaneto/goexpert-challenge-rate-limiter/ratelimiter/adapter"
+	"github.com/arfurlaneto/goexpert-challenge-rate-limiter/ratelimiter/metrics"
 	"github.com/arfurlaneto/goexpert-challenge-rate-limiter/ratelimiter/mocks"
+	"github.com/arfurlaneto/goexpert-challenge-rate-limiter/ratelimiter/responsewriter"
+	"github.com/arfurlaneto/goexpert-challenge-rate-limiter/ratelimiter/tokenextractor"
+	"github.com/arfurlaneto/goexpert-challenge-rate-limiter/ratelimiter/tokenstore"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/suite"
 	"go.uber.org/mock/gomock"
@@ -66,8 +75,8 @@ func (s *MiddlewareTestSuite) TestMiddleware_IPAllowed() {
 		w.Write([]byte("DONE"))
 	})
 
-	rateLimiterCheckFunction := func(ctx context.Context, keyType string, key string, config *RateLimiterConfig, rateConfig *RateLimiterRateConfig) (*time.Time, error) {
-		return nil, nil
+	rateLimiterCheckFunction := func(ctx context.Context, keyType string, key string, config *RateLimiterConfig, rateConfig *RateLimiterRateConfig) (*rateLimitDecision, error) {
+		return &rateLimitDecision{limit: rateConfig, remaining: 9, reset: time.Now().Add(time.Second)}, nil
 	}
 
 	request := httptest.NewRequest("GET", "http://testing", nil)
@@ -82,6 +91,10 @@ func (s *MiddlewareTestSuite) TestMiddleware_IPAllowed() {
 	assert.Nil(s.T(), err)
 	assert.Equal(s.T(), 200, responseStatus)
 	assert.Equal(s.T(), "DONE", string(responseBody))
+	assert.Equal(s.T(), "10", response.Header.Get("RateLimit-Limit"))
+	assert.Equal(s.T(), "9", response.Header.Get("RateLimit-Remaining"))
+	assert.Equal(s.T(), "1", response.Header.Get("RateLimit-Reset"))
+	assert.Empty(s.T(), response.Header.Get("Retry-After"))
 }
 
 func (s *MiddlewareTestSuite) TestMiddleware_IPNotAllowed() {
@@ -97,9 +110,9 @@ func (s *MiddlewareTestSuite) TestMiddleware_IPNotAllowed() {
 		w.Write([]byte("DONE"))
 	})
 
-	rateLimiterCheckFunction := func(ctx context.Context, keyType string, key string, config *RateLimiterConfig, rateConfig *RateLimiterRateConfig) (*time.Time, error) {
+	rateLimiterCheckFunction := func(ctx context.Context, keyType string, key string, config *RateLimiterConfig, rateConfig *RateLimiterRateConfig) (*rateLimitDecision, error) {
 		block := time.Now().Add(time.Millisecond * 100)
-		return &block, nil
+		return newBlockedDecision(&block, rateConfig), nil
 	}
 
 	request := httptest.NewRequest("GET", "http://testing", nil)
@@ -120,6 +133,9 @@ func (s *MiddlewareTestSuite) TestMiddleware_IPNotAllowed() {
 	assert.Nil(s.T(), err)
 	assert.Equal(s.T(), 429, responseStatus)
 	assert.Equal(s.T(), "you have reached the maximum number of requests or actions allowed within a certain time frame", string(responseBody))
+	assert.Equal(s.T(), "1", response.Header.Get("Retry-After"))
+	assert.Equal(s.T(), "10", response.Header.Get("RateLimit-Limit"))
+	assert.Equal(s.T(), "0", response.Header.Get("RateLimit-Remaining"))
 }
 
 func (s *MiddlewareTestSuite) TestMiddleware_IPError() {
@@ -135,7 +151,7 @@ func (s *MiddlewareTestSuite) TestMiddleware_IPError() {
 		w.Write([]byte("DONE"))
 	})
 
-	rateLimiterCheckFunction := func(ctx context.Context, keyType string, key string, config *RateLimiterConfig, rateConfig *RateLimiterRateConfig) (*time.Time, error) {
+	rateLimiterCheckFunction := func(ctx context.Context, keyType string, key string, config *RateLimiterConfig, rateConfig *RateLimiterRateConfig) (*rateLimitDecision, error) {
 		return nil, errors.New("error")
 	}
 
@@ -173,8 +189,8 @@ func (s *MiddlewareTestSuite) TestMiddleware_TokenAllowed() {
 		w.Write([]byte("DONE"))
 	})
 
-	rateLimiterCheckFunction := func(ctx context.Context, keyType string, key string, config *RateLimiterConfig, rateConfig *RateLimiterRateConfig) (*time.Time, error) {
-		return nil, nil
+	rateLimiterCheckFunction := func(ctx context.Context, keyType string, key string, config *RateLimiterConfig, rateConfig *RateLimiterRateConfig) (*rateLimitDecision, error) {
+		return &rateLimitDecision{}, nil
 	}
 
 	request := httptest.NewRequest("GET", "http://testing", nil)
@@ -191,3 +207,652 @@ func (s *MiddlewareTestSuite) TestMiddleware_TokenAllowed() {
 	assert.Equal(s.T(), 200, responseStatus)
 	assert.Equal(s.T(), "DONE", string(responseBody))
 }
+
+func (s *MiddlewareTestSuite) TestMiddleware_DecisionResponseWriterNotAllowed() {
+	limit := &RateLimiterRateConfig{
+		Name:                  "minute",
+		MaxRequestsPerSecond:  10,
+		BlockTimeMilliseconds: 100,
+	}
+	config := &RateLimiterConfig{
+		Token:        limit,
+		CustomTokens: &map[string]*RateLimiterRateConfig{},
+	}
+	block := time.Now().Add(time.Millisecond * 100)
+
+	nextHandler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(200)
+	})
+
+	rateLimiterCheckFunction := func(ctx context.Context, keyType string, key string, config *RateLimiterConfig, rateConfig *RateLimiterRateConfig) (*rateLimitDecision, error) {
+		return newBlockedDecision(&block, rateConfig), nil
+	}
+
+	request := httptest.NewRequest("GET", "http://testing", nil)
+	request.Header.Add("API_KEY", "123")
+	recorder := httptest.NewRecorder()
+
+	decisionResponseWriterMock := mocks.NewMockRateLimiterDecisionResponseWriter(s.controller)
+	decisionResponseWriterMock.EXPECT().WriteDecisionResponse(gomock.Any(), request, gomock.Any()).
+		Do(func(w *http.ResponseWriter, r *http.Request, decision *responsewriter.RateLimiterDecision) {
+			assert.Equal(s.T(), &responsewriter.RateLimiterDecision{
+				Reason:       responsewriter.ReasonRateLimited,
+				StatusCode:   429,
+				KeyType:      "TOKEN",
+				Key:          "123",
+				LimitName:    "minute",
+				Limit:        10,
+				Remaining:    0,
+				Reset:        block,
+				BlockedUntil: &block,
+			}, decision)
+			(*w).WriteHeader(429)
+			(*w).Write([]byte(`{"error":"rate_limited"}`))
+		})
+	config.ResponseWriter = decisionResponseWriterMock
+
+	rateLimiter(config, nextHandler, rateLimiterCheckFunction).ServeHTTP(recorder, request)
+
+	response := recorder.Result()
+	responseBody, err := ioutil.ReadAll(response.Body)
+
+	assert.Nil(s.T(), err)
+	assert.Equal(s.T(), 429, response.StatusCode)
+	assert.Equal(s.T(), `{"error":"rate_limited"}`, string(responseBody))
+}
+
+func (s *MiddlewareTestSuite) TestMiddleware_DecisionResponseWriterRejected() {
+	config := &RateLimiterConfig{
+		IP:               &RateLimiterRateConfig{MaxRequestsPerSecond: 10},
+		Token:            &RateLimiterRateConfig{MaxRequestsPerSecond: 20},
+		CustomTokens:     &map[string]*RateLimiterRateConfig{},
+		DeniedIPs:        []string{"192.0.2.0/24"},
+		DeniedTokens:     []string{"stolen"},
+		DeniedStatusCode: 451,
+		TokenStore:       tokenstore.NewMemoryTokenStore("abc"),
+		UnknownTokens:    UnknownTokensReject,
+	}
+	configureAccessList(config)
+
+	nextHandler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(200)
+	})
+
+	rateLimiterCheckFunction := func(ctx context.Context, keyType string, key string, config *RateLimiterConfig, rateConfig *RateLimiterRateConfig) (*rateLimitDecision, error) {
+		return &rateLimitDecision{}, nil
+	}
+
+	decisions := []*responsewriter.RateLimiterDecision{}
+	decisionResponseWriterMock := mocks.NewMockRateLimiterDecisionResponseWriter(s.controller)
+	decisionResponseWriterMock.EXPECT().WriteDecisionResponse(gomock.Any(), gomock.Any(), gomock.Any()).
+		Do(func(w *http.ResponseWriter, r *http.Request, decision *responsewriter.RateLimiterDecision) {
+			decisions = append(decisions, decision)
+			(*w).WriteHeader(decision.StatusCode)
+			(*w).Write([]byte(`{"error":"` + decision.Reason + `"}`))
+		}).Times(3)
+	config.ResponseWriter = decisionResponseWriterMock
+
+	bodies := []string{}
+	for _, request := range []struct {
+		remoteAddr string
+		token      string
+	}{
+		{remoteAddr: "192.0.2.1:1234"},
+		{remoteAddr: "198.51.100.1:1234", token: "stolen"},
+		{remoteAddr: "198.51.100.1:1234", token: "ghi"},
+	} {
+		httpRequest := httptest.NewRequest("GET", "http://testing", nil)
+		httpRequest.RemoteAddr = request.remoteAddr
+		if request.token != "" {
+			httpRequest.Header.Add("API_KEY", request.token)
+		}
+		recorder := httptest.NewRecorder()
+		rateLimiter(config, nextHandler, rateLimiterCheckFunction).ServeHTTP(recorder, httpRequest)
+		responseBody, _ := ioutil.ReadAll(recorder.Result().Body)
+		bodies = append(bodies, fmt.Sprintf("%d %s", recorder.Result().StatusCode, responseBody))
+	}
+
+	assert.Equal(s.T(), []string{`451 {"error":"denied"}`, `451 {"error":"denied"}`, `401 {"error":"unknown_token"}`}, bodies)
+	assert.Equal(s.T(), []*responsewriter.RateLimiterDecision{
+		{Reason: responsewriter.ReasonDenied, StatusCode: 451, KeyType: "IP", Key: "192.0.2.1"},
+		{Reason: responsewriter.ReasonDenied, StatusCode: 451, KeyType: "TOKEN", Key: "stolen"},
+		{Reason: responsewriter.ReasonUnknownToken, StatusCode: 401, KeyType: "TOKEN", Key: "ghi"},
+	}, decisions)
+}
+
+func (s *MiddlewareTestSuite) TestMiddleware_ResponseWriterRejected() {
+	config := &RateLimiterConfig{
+		IP:               &RateLimiterRateConfig{MaxRequestsPerSecond: 10},
+		Token:            &RateLimiterRateConfig{MaxRequestsPerSecond: 20},
+		CustomTokens:     &map[string]*RateLimiterRateConfig{},
+		DeniedIPs:        []string{"192.0.2.0/24"},
+		DeniedStatusCode: 451,
+	}
+	configureAccessList(config)
+
+	// response writers that do not handle decisions are not used for rejections
+	config.ResponseWriter = mocks.NewMockRateLimiterResponseWriter(s.controller)
+
+	nextHandler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(200)
+	})
+
+	request := httptest.NewRequest("GET", "http://testing", nil)
+	recorder := httptest.NewRecorder()
+	rateLimiter(config, nextHandler, checkRateLimit).ServeHTTP(recorder, request)
+
+	responseBody, _ := ioutil.ReadAll(recorder.Result().Body)
+	assert.Equal(s.T(), 451, recorder.Result().StatusCode)
+	assert.Equal(s.T(), http.StatusText(451), string(responseBody))
+}
+
+func (s *MiddlewareTestSuite) TestMiddleware_DecisionResponseWriterError() {
+	config := &RateLimiterConfig{
+		IP: &RateLimiterRateConfig{
+			MaxRequestsPerSecond:  10,
+			BlockTimeMilliseconds: 100,
+		},
+	}
+
+	nextHandler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(200)
+	})
+
+	rateLimiterCheckFunction := func(ctx context.Context, keyType string, key string, config *RateLimiterConfig, rateConfig *RateLimiterRateConfig) (*rateLimitDecision, error) {
+		return nil, errors.New("error")
+	}
+
+	request := httptest.NewRequest("GET", "http://testing", nil)
+	recorder := httptest.NewRecorder()
+
+	decisionResponseWriterMock := mocks.NewMockRateLimiterDecisionResponseWriter(s.controller)
+	decisionResponseWriterMock.EXPECT().WriteRequestError(gomock.Any(), request, errors.New("error")).
+		Do(func(w *http.ResponseWriter, r *http.Request, err error) {
+			(*w).WriteHeader(503)
+		})
+	config.ResponseWriter = decisionResponseWriterMock
+
+	rateLimiter(config, nextHandler, rateLimiterCheckFunction).ServeHTTP(recorder, request)
+
+	assert.Equal(s.T(), 503, recorder.Result().StatusCode)
+}
+
+func (s *MiddlewareTestSuite) TestMiddleware_CustomTokenExtractor() {
+	config := &RateLimiterConfig{
+		IP:             &RateLimiterRateConfig{MaxRequestsPerSecond: 10},
+		Token:          &RateLimiterRateConfig{MaxRequestsPerSecond: 20},
+		CustomTokens:   &map[string]*RateLimiterRateConfig{},
+		TokenExtractor: tokenextractor.NewQueryTokenExtractor("api_key"),
+	}
+
+	nextHandler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(200)
+	})
+
+	checkedKeys := []string{}
+	rateLimiterCheckFunction := func(ctx context.Context, keyType string, key string, config *RateLimiterConfig, rateConfig *RateLimiterRateConfig) (*rateLimitDecision, error) {
+		checkedKeys = append(checkedKeys, keyType+"="+key)
+		return &rateLimitDecision{}, nil
+	}
+
+	request := httptest.NewRequest("GET", "http://testing/?api_key=123", nil)
+	rateLimiter(config, nextHandler, rateLimiterCheckFunction).ServeHTTP(httptest.NewRecorder(), request)
+
+	request = httptest.NewRequest("GET", "http://testing", nil)
+	request.Header.Add("API_KEY", "456")
+	rateLimiter(config, nextHandler, rateLimiterCheckFunction).ServeHTTP(httptest.NewRecorder(), request)
+
+	assert.Equal(s.T(), []string{"TOKEN=123", "IP=192.0.2.1"}, checkedKeys)
+}
+
+func (s *MiddlewareTestSuite) TestMiddleware_AccessList() {
+	config := &RateLimiterConfig{
+		IP:               &RateLimiterRateConfig{MaxRequestsPerSecond: 10},
+		Token:            &RateLimiterRateConfig{MaxRequestsPerSecond: 20},
+		CustomTokens:     &map[string]*RateLimiterRateConfig{},
+		AllowedIPs:       []string{"10.0.0.0/8"},
+		DeniedIPs:        []string{"192.0.2.0/24"},
+		DeniedStatusCode: 451,
+	}
+	configureAccessList(config)
+
+	nextHandler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(200)
+	})
+
+	rateLimiterCheckFunction := func(ctx context.Context, keyType string, key string, config *RateLimiterConfig, rateConfig *RateLimiterRateConfig) (*rateLimitDecision, error) {
+		s.Fail("checkRateLimit must not be called for listed requests")
+		return &rateLimitDecision{}, nil
+	}
+
+	request := httptest.NewRequest("GET", "http://testing", nil)
+	request.RemoteAddr = "192.0.2.1:1234"
+	recorder := httptest.NewRecorder()
+	rateLimiter(config, nextHandler, rateLimiterCheckFunction).ServeHTTP(recorder, request)
+	assert.Equal(s.T(), 451, recorder.Result().StatusCode)
+
+	request = httptest.NewRequest("GET", "http://testing", nil)
+	request.RemoteAddr = "10.1.2.3:1234"
+	recorder = httptest.NewRecorder()
+	rateLimiter(config, nextHandler, rateLimiterCheckFunction).ServeHTTP(recorder, request)
+	assert.Equal(s.T(), 200, recorder.Result().StatusCode)
+	assert.Empty(s.T(), recorder.Result().Header.Get("RateLimit-Limit"))
+}
+
+func (s *MiddlewareTestSuite) TestMiddleware_Rules() {
+	loginLimit := &RateLimiterRateConfig{MaxRequestsPerSecond: 5}
+	config := &RateLimiterConfig{
+		IP:           &RateLimiterRateConfig{MaxRequestsPerSecond: 10},
+		Token:        &RateLimiterRateConfig{MaxRequestsPerSecond: 20},
+		CustomTokens: &map[string]*RateLimiterRateConfig{},
+		Rules: []*RateLimiterRule{
+			{ID: "login", Path: "/login", Methods: []string{"POST"}, IP: loginLimit},
+		},
+	}
+
+	nextHandler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(200)
+	})
+
+	checked := []string{}
+	rateLimiterCheckFunction := func(ctx context.Context, keyType string, key string, config *RateLimiterConfig, rateConfig *RateLimiterRateConfig) (*rateLimitDecision, error) {
+		checked = append(checked, fmt.Sprintf("%s=%d", keyType, rateConfig.MaxRequestsPerSecond))
+		return &rateLimitDecision{}, nil
+	}
+
+	handler := rateLimiter(config, nextHandler, rateLimiterCheckFunction)
+	handler.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("POST", "http://testing/login", nil))
+	handler.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", "http://testing/login", nil))
+
+	request := httptest.NewRequest("POST", "http://testing/login", nil)
+	request.Header.Add("API_KEY", "123")
+	handler.ServeHTTP(httptest.NewRecorder(), request)
+
+	assert.Equal(s.T(), []string{"IP@login=5", "IP=10", "TOKEN=20"}, checked)
+}
+
+func (s *MiddlewareTestSuite) TestMiddleware_EnforceIPAndToken() {
+	config := &RateLimiterConfig{
+		IP:                &RateLimiterRateConfig{MaxRequestsPerSecond: 10},
+		Token:             &RateLimiterRateConfig{MaxRequestsPerSecond: 20},
+		CustomTokens:      &map[string]*RateLimiterRateConfig{},
+		EnforceIPAndToken: true,
+	}
+
+	nextHandler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(200)
+	})
+
+	checked := []string{}
+	rateLimiterCheckFunction := func(ctx context.Context, keyType string, key string, config *RateLimiterConfig, rateConfig *RateLimiterRateConfig) (*rateLimitDecision, error) {
+		checked = append(checked, keyType+"="+key)
+		if keyType == "IP" {
+			return &rateLimitDecision{limit: rateConfig, remaining: 3, reset: time.Now().Add(time.Second)}, nil
+		}
+		return &rateLimitDecision{limit: rateConfig, remaining: 15, reset: time.Now().Add(time.Second)}, nil
+	}
+
+	request := httptest.NewRequest("GET", "http://testing", nil)
+	request.Header.Add("API_KEY", "123")
+	recorder := httptest.NewRecorder()
+	rateLimiter(config, nextHandler, rateLimiterCheckFunction).ServeHTTP(recorder, request)
+
+	assert.Equal(s.T(), []string{"IP=192.0.2.1", "TOKEN=123"}, checked)
+	assert.Equal(s.T(), 200, recorder.Result().StatusCode)
+	assert.Equal(s.T(), "10", recorder.Result().Header.Get("RateLimit-Limit"))
+	assert.Equal(s.T(), "3", recorder.Result().Header.Get("RateLimit-Remaining"))
+}
+
+func (s *MiddlewareTestSuite) TestMiddleware_EnforceIPAndTokenIPBlocked() {
+	config := &RateLimiterConfig{
+		IP:                &RateLimiterRateConfig{MaxRequestsPerSecond: 10},
+		Token:             &RateLimiterRateConfig{MaxRequestsPerSecond: 20},
+		CustomTokens:      &map[string]*RateLimiterRateConfig{},
+		EnforceIPAndToken: true,
+		ResponseWriter:    responsewriter.NewRateLimiterDefaultResponseWriter(),
+	}
+
+	nextHandler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(200)
+	})
+
+	rateLimiterCheckFunction := func(ctx context.Context, keyType string, key string, config *RateLimiterConfig, rateConfig *RateLimiterRateConfig) (*rateLimitDecision, error) {
+		if keyType == "TOKEN" {
+			s.Fail("token must not be checked when the IP is blocked")
+		}
+		block := time.Now().Add(time.Second)
+		return newBlockedDecision(&block, rateConfig), nil
+	}
+
+	request := httptest.NewRequest("GET", "http://testing", nil)
+	request.Header.Add("API_KEY", "123")
+	recorder := httptest.NewRecorder()
+	rateLimiter(config, nextHandler, rateLimiterCheckFunction).ServeHTTP(recorder, request)
+
+	assert.Equal(s.T(), 429, recorder.Result().StatusCode)
+}
+
+func (s *MiddlewareTestSuite) TestMiddleware_EnforceIPAndTokenTokenBlocked() {
+	metricsMock := mocks.NewMockRateLimiterMetrics(s.controller)
+	config := &RateLimiterConfig{
+		IP:                &RateLimiterRateConfig{MaxRequestsPerSecond: 2, BlockTimeMilliseconds: 1000},
+		Token:             &RateLimiterRateConfig{MaxRequestsPerSecond: 1, BlockTimeMilliseconds: 1000},
+		CustomTokens:      &map[string]*RateLimiterRateConfig{},
+		EnforceIPAndToken: true,
+		StorageAdapter:    adapter.NewRateLimitMemoryStorageAdapter(),
+		ResponseWriter:    responsewriter.NewRateLimiterDefaultResponseWriter(),
+		Metrics:           metricsMock,
+	}
+
+	nextHandler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(200)
+	})
+	handler := rateLimiter(config, nextHandler, checkRateLimit)
+
+	metricsMock.EXPECT().StorageLatency(gomock.Any(), gomock.Any()).AnyTimes()
+	metricsMock.EXPECT().RequestAllowed("IP", "")
+	metricsMock.EXPECT().RequestAllowed("TOKEN", "")
+	request := httptest.NewRequest("GET", "http://testing", nil)
+	request.Header.Add("API_KEY", "123")
+	recorder := httptest.NewRecorder()
+	handler.ServeHTTP(recorder, request)
+	assert.Equal(s.T(), 200, recorder.Result().StatusCode)
+
+	metricsMock.EXPECT().RequestRejected("TOKEN", "", "123", gomock.Any())
+	request = httptest.NewRequest("GET", "http://testing", nil)
+	request.Header.Add("API_KEY", "123")
+	recorder = httptest.NewRecorder()
+	handler.ServeHTTP(recorder, request)
+	assert.Equal(s.T(), 429, recorder.Result().StatusCode)
+
+	// the rejected request was given back to the IP, so it has a request left
+	metricsMock.EXPECT().RequestAllowed("IP", "")
+	recorder = httptest.NewRecorder()
+	handler.ServeHTTP(recorder, httptest.NewRequest("GET", "http://testing", nil))
+	assert.Equal(s.T(), 200, recorder.Result().StatusCode)
+	assert.Equal(s.T(), "0", recorder.Result().Header.Get("RateLimit-Remaining"))
+}
+
+func (s *MiddlewareTestSuite) TestMiddleware_MaxTokensPerIP() {
+	config := &RateLimiterConfig{
+		IP:             &RateLimiterRateConfig{MaxRequestsPerSecond: 10},
+		Token:          &RateLimiterRateConfig{MaxRequestsPerSecond: 20},
+		CustomTokens:   &map[string]*RateLimiterRateConfig{},
+		MaxTokensPerIP: &RateLimiterRateConfig{MaxRequestsPerSecond: 2, WindowMilliseconds: 60000, BlockTimeMilliseconds: 60000},
+		StorageAdapter: adapter.NewRateLimitMemoryStorageAdapter(),
+		ResponseWriter: responsewriter.NewRateLimiterDefaultResponseWriter(),
+	}
+
+	nextHandler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(200)
+	})
+	handler := rateLimiter(config, nextHandler, checkRateLimit)
+
+	statuses := []int{}
+	for _, token := range []string{"a", "b", "a", "c", "a"} {
+		request := httptest.NewRequest("GET", "http://testing", nil)
+		request.Header.Add("API_KEY", token)
+		recorder := httptest.NewRecorder()
+		handler.ServeHTTP(recorder, request)
+		statuses = append(statuses, recorder.Result().StatusCode)
+	}
+
+	assert.Equal(s.T(), []int{200, 200, 200, 429, 429}, statuses)
+}
+
+func (s *MiddlewareTestSuite) TestMiddleware_UnknownTokensReject() {
+	config := &RateLimiterConfig{
+		IP:            &RateLimiterRateConfig{MaxRequestsPerSecond: 10},
+		Token:         &RateLimiterRateConfig{MaxRequestsPerSecond: 20},
+		CustomTokens:  &map[string]*RateLimiterRateConfig{"abc": {MaxRequestsPerSecond: 30}},
+		TokenStore:    tokenstore.NewMemoryTokenStore("def"),
+		UnknownTokens: UnknownTokensReject,
+	}
+
+	nextHandler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(200)
+	})
+
+	checked := []string{}
+	rateLimiterCheckFunction := func(ctx context.Context, keyType string, key string, config *RateLimiterConfig, rateConfig *RateLimiterRateConfig) (*rateLimitDecision, error) {
+		checked = append(checked, keyType+"="+key)
+		return &rateLimitDecision{}, nil
+	}
+
+	statuses := []int{}
+	for _, token := range []string{"abc", "def", "ghi", ""} {
+		request := httptest.NewRequest("GET", "http://testing", nil)
+		if token != "" {
+			request.Header.Add("API_KEY", token)
+		}
+		recorder := httptest.NewRecorder()
+		rateLimiter(config, nextHandler, rateLimiterCheckFunction).ServeHTTP(recorder, request)
+		statuses = append(statuses, recorder.Result().StatusCode)
+	}
+
+	assert.Equal(s.T(), []int{200, 200, 401, 200}, statuses)
+	assert.Equal(s.T(), []string{"TOKEN=abc", "TOKEN=def", "IP=192.0.2.1"}, checked)
+}
+
+func (s *MiddlewareTestSuite) TestMiddleware_UnknownTokensAsIP() {
+	config := &RateLimiterConfig{
+		IP:            &RateLimiterRateConfig{MaxRequestsPerSecond: 10},
+		Token:         &RateLimiterRateConfig{MaxRequestsPerSecond: 20},
+		CustomTokens:  &map[string]*RateLimiterRateConfig{"abc": {MaxRequestsPerSecond: 30}},
+		UnknownTokens: UnknownTokensAsIP,
+	}
+
+	nextHandler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(200)
+	})
+
+	checked := []string{}
+	rateLimiterCheckFunction := func(ctx context.Context, keyType string, key string, config *RateLimiterConfig, rateConfig *RateLimiterRateConfig) (*rateLimitDecision, error) {
+		checked = append(checked, fmt.Sprintf("%s=%d", keyType, rateConfig.MaxRequestsPerSecond))
+		return &rateLimitDecision{}, nil
+	}
+
+	for _, token := range []string{"abc", "ghi"} {
+		request := httptest.NewRequest("GET", "http://testing", nil)
+		request.Header.Add("API_KEY", token)
+		recorder := httptest.NewRecorder()
+		rateLimiter(config, nextHandler, rateLimiterCheckFunction).ServeHTTP(recorder, request)
+		assert.Equal(s.T(), 200, recorder.Result().StatusCode)
+	}
+
+	assert.Equal(s.T(), []string{"TOKEN=30", "IP=10"}, checked)
+}
+
+func (s *MiddlewareTestSuite) TestMiddleware_UnknownTokensStoreError() {
+	tokenStoreMock := mocks.NewMockRateLimiterTokenStore(s.controller)
+	tokenStoreMock.EXPECT().HasToken(gomock.Any(), "ghi").Return(false, errors.New("store error"))
+
+	config := &RateLimiterConfig{
+		IP:             &RateLimiterRateConfig{MaxRequestsPerSecond: 10},
+		Token:          &RateLimiterRateConfig{MaxRequestsPerSecond: 20},
+		CustomTokens:   &map[string]*RateLimiterRateConfig{},
+		TokenStore:     tokenStoreMock,
+		UnknownTokens:  UnknownTokensReject,
+		ResponseWriter: s.responseWriterMock,
+	}
+
+	nextHandler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		s.Fail("next must not be called when the token store fails")
+	})
+
+	s.responseWriterMock.EXPECT().WriteError(gomock.Any(), gomock.Any()).Times(1)
+
+	request := httptest.NewRequest("GET", "http://testing", nil)
+	request.Header.Add("API_KEY", "ghi")
+	rateLimiter(config, nextHandler, checkRateLimit).ServeHTTP(httptest.NewRecorder(), request)
+}
+
+func (s *MiddlewareTestSuite) TestMiddleware_Plans() {
+	config := &RateLimiterConfig{
+		IP:            &RateLimiterRateConfig{MaxRequestsPerSecond: 10},
+		Token:         &RateLimiterRateConfig{MaxRequestsPerSecond: 20},
+		CustomTokens:  &map[string]*RateLimiterRateConfig{},
+		Plans:         map[string]*RateLimiterRateConfig{"pro": {MaxRequestsPerSecond: 100}},
+		TokenPlans:    map[string]string{"abc": "pro"},
+		UnknownTokens: UnknownTokensReject,
+	}
+
+	nextHandler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(200)
+	})
+
+	checked := []string{}
+	rateLimiterCheckFunction := func(ctx context.Context, keyType string, key string, config *RateLimiterConfig, rateConfig *RateLimiterRateConfig) (*rateLimitDecision, error) {
+		checked = append(checked, fmt.Sprintf("%s=%d", keyType, rateConfig.MaxRequestsPerSecond))
+		return &rateLimitDecision{}, nil
+	}
+
+	statuses := []int{}
+	for _, token := range []string{"abc", "def"} {
+		request := httptest.NewRequest("GET", "http://testing", nil)
+		request.Header.Add("API_KEY", token)
+		recorder := httptest.NewRecorder()
+		rateLimiter(config, nextHandler, rateLimiterCheckFunction).ServeHTTP(recorder, request)
+		statuses = append(statuses, recorder.Result().StatusCode)
+	}
+
+	assert.Equal(s.T(), []int{200, 401}, statuses)
+	assert.Equal(s.T(), []string{"TOKEN=100"}, checked)
+}
+
+func (s *MiddlewareTestSuite) TestMiddleware_Metrics() {
+	metricsMock := mocks.NewMockRateLimiterMetrics(s.controller)
+	config := &RateLimiterConfig{
+		IP:             &RateLimiterRateConfig{MaxRequestsPerSecond: 10},
+		Token:          &RateLimiterRateConfig{MaxRequestsPerSecond: 20},
+		CustomTokens:   &map[string]*RateLimiterRateConfig{},
+		Rules:          []*RateLimiterRule{{ID: "login", Path: "/login", IP: &RateLimiterRateConfig{MaxRequestsPerSecond: 5}}},
+		ResponseWriter: responsewriter.NewRateLimiterDefaultResponseWriter(),
+		Metrics:        metricsMock,
+	}
+
+	nextHandler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(200)
+	})
+
+	block := time.Now().Add(time.Second)
+	rateLimiterCheckFunction := func(ctx context.Context, keyType string, key string, config *RateLimiterConfig, rateConfig *RateLimiterRateConfig) (*rateLimitDecision, error) {
+		switch key {
+		case "blocked":
+			return newBlockedDecision(&block, rateConfig), nil
+		case "failing":
+			return nil, errors.New("error")
+		}
+		return &rateLimitDecision{}, nil
+	}
+	handler := rateLimiter(config, nextHandler, rateLimiterCheckFunction)
+
+	metricsMock.EXPECT().RequestAllowed("IP", "login")
+	handler.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", "http://testing/login", nil))
+
+	metricsMock.EXPECT().RequestRejected("TOKEN", "", "blocked", block)
+	request := httptest.NewRequest("GET", "http://testing", nil)
+	request.Header.Add("API_KEY", "blocked")
+	handler.ServeHTTP(httptest.NewRecorder(), request)
+
+	metricsMock.EXPECT().StorageError("TOKEN", "")
+	request = httptest.NewRequest("GET", "http://testing", nil)
+	request.Header.Add("API_KEY", "failing")
+	handler.ServeHTTP(httptest.NewRecorder(), request)
+
+	config.UnknownTokens = UnknownTokensReject
+	config.TokenStore = tokenstore.NewMemoryTokenStore()
+	metricsMock.EXPECT().RequestRejected("TOKEN", "", "unknown", time.Time{})
+	request = httptest.NewRequest("GET", "http://testing", nil)
+	request.Header.Add("API_KEY", "unknown")
+	handler.ServeHTTP(httptest.NewRecorder(), request)
+}
+
+func (s *MiddlewareTestSuite) TestMiddleware_MetricsRedactTokens() {
+	metricsMock := mocks.NewMockRateLimiterMetrics(s.controller)
+	config := &RateLimiterConfig{
+		IP:             &RateLimiterRateConfig{MaxRequestsPerSecond: 10},
+		Token:          &RateLimiterRateConfig{MaxRequestsPerSecond: 20},
+		CustomTokens:   &map[string]*RateLimiterRateConfig{},
+		ResponseWriter: responsewriter.NewRateLimiterDefaultResponseWriter(),
+		Metrics:        metricsMock,
+		RedactTokens:   true,
+	}
+
+	nextHandler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(200)
+	})
+
+	block := time.Now().Add(time.Second)
+	rateLimiterCheckFunction := func(ctx context.Context, keyType string, key string, config *RateLimiterConfig, rateConfig *RateLimiterRateConfig) (*rateLimitDecision, error) {
+		return newBlockedDecision(&block, rateConfig), nil
+	}
+	handler := rateLimiter(config, nextHandler, rateLimiterCheckFunction)
+
+	metricsMock.EXPECT().RequestRejected("TOKEN", "", redactToken("blocked"), block)
+	request := httptest.NewRequest("GET", "http://testing", nil)
+	request.Header.Add("API_KEY", "blocked")
+	handler.ServeHTTP(httptest.NewRecorder(), request)
+
+	config.UnknownTokens = UnknownTokensReject
+	config.TokenStore = tokenstore.NewMemoryTokenStore()
+	metricsMock.EXPECT().RequestRejected("TOKEN", "", redactToken("unknown"), time.Time{})
+	request = httptest.NewRequest("GET", "http://testing", nil)
+	request.Header.Add("API_KEY", "unknown")
+	handler.ServeHTTP(httptest.NewRecorder(), request)
+
+	config.UnknownTokens = ""
+	config.DeniedTokens = []string{"denied"}
+	configureAccessList(config)
+	metricsMock.EXPECT().RequestRejected("TOKEN", "", redactToken("denied"), time.Time{})
+	request = httptest.NewRequest("GET", "http://testing", nil)
+	request.Header.Add("API_KEY", "denied")
+	handler.ServeHTTP(httptest.NewRecorder(), request)
+
+	metricsMock.EXPECT().RequestRejected("IP", "", "192.0.2.1", block)
+	handler.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", "http://testing", nil))
+}
+
+func (s *MiddlewareTestSuite) TestMiddleware_MetricsAccessList() {
+	registry := prometheus.NewRegistry()
+	rateLimiterMetrics, err := metrics.NewPrometheusMetrics(registry)
+	assert.Nil(s.T(), err)
+
+	config := &RateLimiterConfig{
+		IP:           &RateLimiterRateConfig{MaxRequestsPerSecond: 10},
+		Token:        &RateLimiterRateConfig{MaxRequestsPerSecond: 20},
+		CustomTokens: &map[string]*RateLimiterRateConfig{},
+		DeniedIPs:    []string{"192.0.2.0/24"},
+		DeniedTokens: []string{"abc"},
+		Metrics:      rateLimiterMetrics,
+	}
+	configureAccessList(config)
+
+	nextHandler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(200)
+	})
+	handler := rateLimiter(config, nextHandler, checkRateLimit)
+
+	for i := 0; i < 2; i++ {
+		request := httptest.NewRequest("GET", "http://testing", nil)
+		request.RemoteAddr = "192.0.2.1:1234"
+		handler.ServeHTTP(httptest.NewRecorder(), request)
+	}
+	request := httptest.NewRequest("GET", "http://testing", nil)
+	request.RemoteAddr = "198.51.100.1:1234"
+	request.Header.Add("API_KEY", "abc")
+	handler.ServeHTTP(httptest.NewRecorder(), request)
+
+	expected := `
+# HELP rate_limiter_requests_rejected_total Keys checked for a request that were blocked.
+# TYPE rate_limiter_requests_rejected_total counter
+rate_limiter_requests_rejected_total{key_type="IP",rule=""} 2
+rate_limiter_requests_rejected_total{key_type="TOKEN",rule=""} 1
+`
+	err = testutil.GatherAndCompare(registry, strings.NewReader(expected), "rate_limiter_requests_rejected_total")
+	assert.Nil(s.T(), err)
+
+	count, err := testutil.GatherAndCount(registry, "rate_limiter_active_blocks")
+	assert.Nil(s.T(), err)
+	assert.Equal(s.T(), 0, count)
+}
@@ -0,0 +1,88 @@
+// Code generated by MockGen. DO NOT EDIT.
+// Source: ./ratelimiter/metrics/metrics.go
+//
+// Generated by this command:
+//
+//	mockgen -source=./ratelimiter/metrics/metrics.go -destination ./ratelimiter/mocks/metrics.go -package mocks
+//
+
+// Package mocks is a generated GoMock package.
+package mocks
+
+import (
+	reflect "reflect"
+	time "time"
+
+	gomock "go.uber.org/mock/gomock"
+)
+
+// MockRateLimiterMetrics is a mock of RateLimiterMetrics interface.
+type MockRateLimiterMetrics struct {
+	ctrl     *gomock.Controller
+	recorder *MockRateLimiterMetricsMockRecorder
+}
+
+// MockRateLimiterMetricsMockRecorder is the mock recorder for MockRateLimiterMetrics.
+type MockRateLimiterMetricsMockRecorder struct {
+	mock *MockRateLimiterMetrics
+}
+
+// NewMockRateLimiterMetrics creates a new mock instance.
+func NewMockRateLimiterMetrics(ctrl *gomock.Controller) *MockRateLimiterMetrics {
+	mock := &MockRateLimiterMetrics{ctrl: ctrl}
+	mock.recorder = &MockRateLimiterMetricsMockRecorder{mock}
+	return mock
+}
+
+// EXPECT returns an object that allows the caller to indicate expected use.
+func (m *MockRateLimiterMetrics) EXPECT() *MockRateLimiterMetricsMockRecorder {
+	return m.recorder
+}
+
+// RequestAllowed mocks base method.
+func (m *MockRateLimiterMetrics) RequestAllowed(keyType, ruleID string) {
+	m.ctrl.T.Helper()
+	m.ctrl.Call(m, "RequestAllowed", keyType, ruleID)
+}
+
+// RequestAllowed indicates an expected call of RequestAllowed.
+func (mr *MockRateLimiterMetricsMockRecorder) RequestAllowed(keyType, ruleID any) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "RequestAllowed", reflect.TypeOf((*MockRateLimiterMetrics)(nil).RequestAllowed), keyType, ruleID)
+}
+
+// RequestRejected mocks base method.
+func (m *MockRateLimiterMetrics) RequestRejected(keyType, ruleID, key string, blockedUntil time.Time) {
+	m.ctrl.T.Helper()
+	m.ctrl.Call(m, "RequestRejected", keyType, ruleID, key, blockedUntil)
+}
+
+// RequestRejected indicates an expected call of RequestRejected.
+func (mr *MockRateLimiterMetricsMockRecorder) RequestRejected(keyType, ruleID, key, blockedUntil any) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "RequestRejected", reflect.TypeOf((*MockRateLimiterMetrics)(nil).RequestRejected), keyType, ruleID, key, blockedUntil)
+}
+
+// StorageError mocks base method.
+func (m *MockRateLimiterMetrics) StorageError(keyType, ruleID string) {
+	m.ctrl.T.Helper()
+	m.ctrl.Call(m, "StorageError", keyType, ruleID)
+}
+
+// StorageError indicates an expected call of StorageError.
+func (mr *MockRateLimiterMetricsMockRecorder) StorageError(keyType, ruleID any) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "StorageError", reflect.TypeOf((*MockRateLimiterMetrics)(nil).StorageError), keyType, ruleID)
+}
+
+// StorageLatency mocks base method.
+func (m *MockRateLimiterMetrics) StorageLatency(operation string, duration time.Duration) {
+	m.ctrl.T.Helper()
+	m.ctrl.Call(m, "StorageLatency", operation, duration)
+}
+
+// StorageLatency indicates an expected call of StorageLatency.
+func (mr *MockRateLimiterMetricsMockRecorder) StorageLatency(operation, duration any) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "StorageLatency", reflect.TypeOf((*MockRateLimiterMetrics)(nil).StorageLatency), operation, duration)
+}
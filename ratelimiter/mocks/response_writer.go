@@ -13,6 +13,7 @@ import (
 	http "net/http"
 	reflect "reflect"
 
+	responsewriter "github.com/arfurlaneto/goexpert-challenge-rate-limiter/ratelimiter/responsewriter"
 	gomock "go.uber.org/mock/gomock"
 )
 
@@ -66,3 +67,82 @@ func (mr *MockRateLimiterResponseWriterMockRecorder) WriteResponse(w any) *gomoc
 	mr.mock.ctrl.T.Helper()
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "WriteResponse", reflect.TypeOf((*MockRateLimiterResponseWriter)(nil).WriteResponse), w)
 }
+
+// MockRateLimiterDecisionResponseWriter is a mock of RateLimiterDecisionResponseWriter interface.
+type MockRateLimiterDecisionResponseWriter struct {
+	ctrl     *gomock.Controller
+	recorder *MockRateLimiterDecisionResponseWriterMockRecorder
+}
+
+// MockRateLimiterDecisionResponseWriterMockRecorder is the mock recorder for MockRateLimiterDecisionResponseWriter.
+type MockRateLimiterDecisionResponseWriterMockRecorder struct {
+	mock *MockRateLimiterDecisionResponseWriter
+}
+
+// NewMockRateLimiterDecisionResponseWriter creates a new mock instance.
+func NewMockRateLimiterDecisionResponseWriter(ctrl *gomock.Controller) *MockRateLimiterDecisionResponseWriter {
+	mock := &MockRateLimiterDecisionResponseWriter{ctrl: ctrl}
+	mock.recorder = &MockRateLimiterDecisionResponseWriterMockRecorder{mock}
+	return mock
+}
+
+// EXPECT returns an object that allows the caller to indicate expected use.
+func (m *MockRateLimiterDecisionResponseWriter) EXPECT() *MockRateLimiterDecisionResponseWriterMockRecorder {
+	return m.recorder
+}
+
+// WriteDecisionResponse mocks base method.
+func (m *MockRateLimiterDecisionResponseWriter) WriteDecisionResponse(w *http.ResponseWriter, r *http.Request, decision *responsewriter.RateLimiterDecision) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "WriteDecisionResponse", w, r, decision)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// WriteDecisionResponse indicates an expected call of WriteDecisionResponse.
+func (mr *MockRateLimiterDecisionResponseWriterMockRecorder) WriteDecisionResponse(w, r, decision any) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "WriteDecisionResponse", reflect.TypeOf((*MockRateLimiterDecisionResponseWriter)(nil).WriteDecisionResponse), w, r, decision)
+}
+
+// WriteError mocks base method.
+func (m *MockRateLimiterDecisionResponseWriter) WriteError(w *http.ResponseWriter, err error) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "WriteError", w, err)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// WriteError indicates an expected call of WriteError.
+func (mr *MockRateLimiterDecisionResponseWriterMockRecorder) WriteError(w, err any) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "WriteError", reflect.TypeOf((*MockRateLimiterDecisionResponseWriter)(nil).WriteError), w, err)
+}
+
+// WriteRequestError mocks base method.
+func (m *MockRateLimiterDecisionResponseWriter) WriteRequestError(w *http.ResponseWriter, r *http.Request, err error) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "WriteRequestError", w, r, err)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// WriteRequestError indicates an expected call of WriteRequestError.
+func (mr *MockRateLimiterDecisionResponseWriterMockRecorder) WriteRequestError(w, r, err any) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "WriteRequestError", reflect.TypeOf((*MockRateLimiterDecisionResponseWriter)(nil).WriteRequestError), w, r, err)
+}
+
+// WriteResponse mocks base method.
+func (m *MockRateLimiterDecisionResponseWriter) WriteResponse(w *http.ResponseWriter) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "WriteResponse", w)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// WriteResponse indicates an expected call of WriteResponse.
+func (mr *MockRateLimiterDecisionResponseWriterMockRecorder) WriteResponse(w any) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "WriteResponse", reflect.TypeOf((*MockRateLimiterDecisionResponseWriter)(nil).WriteResponse), w)
+}
@@ -14,6 +14,7 @@ import (
 	reflect "reflect"
 	time "time"
 
+	adapter "github.com/arfurlaneto/goexpert-challenge-rate-limiter/ratelimiter/adapter"
 	gomock "go.uber.org/mock/gomock"
 )
 
@@ -85,3 +86,537 @@ func (mr *MockRateLimitStorageAdapterMockRecorder) IncrementAccesses(ctx, keyTyp
 	mr.mock.ctrl.T.Helper()
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "IncrementAccesses", reflect.TypeOf((*MockRateLimitStorageAdapter)(nil).IncrementAccesses), ctx, keyType, key, maxAccesses)
 }
+
+// MockRateLimitWindowStorageAdapter is a mock of RateLimitWindowStorageAdapter interface.
+type MockRateLimitWindowStorageAdapter struct {
+	ctrl     *gomock.Controller
+	recorder *MockRateLimitWindowStorageAdapterMockRecorder
+}
+
+// MockRateLimitWindowStorageAdapterMockRecorder is the mock recorder for MockRateLimitWindowStorageAdapter.
+type MockRateLimitWindowStorageAdapterMockRecorder struct {
+	mock *MockRateLimitWindowStorageAdapter
+}
+
+// NewMockRateLimitWindowStorageAdapter creates a new mock instance.
+func NewMockRateLimitWindowStorageAdapter(ctrl *gomock.Controller) *MockRateLimitWindowStorageAdapter {
+	mock := &MockRateLimitWindowStorageAdapter{ctrl: ctrl}
+	mock.recorder = &MockRateLimitWindowStorageAdapterMockRecorder{mock}
+	return mock
+}
+
+// EXPECT returns an object that allows the caller to indicate expected use.
+func (m *MockRateLimitWindowStorageAdapter) EXPECT() *MockRateLimitWindowStorageAdapterMockRecorder {
+	return m.recorder
+}
+
+// AddBlock mocks base method.
+func (m *MockRateLimitWindowStorageAdapter) AddBlock(ctx context.Context, keyType, key string, milliseconds int64) (*time.Time, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "AddBlock", ctx, keyType, key, milliseconds)
+	ret0, _ := ret[0].(*time.Time)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// AddBlock indicates an expected call of AddBlock.
+func (mr *MockRateLimitWindowStorageAdapterMockRecorder) AddBlock(ctx, keyType, key, milliseconds any) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "AddBlock", reflect.TypeOf((*MockRateLimitWindowStorageAdapter)(nil).AddBlock), ctx, keyType, key, milliseconds)
+}
+
+// GetBlock mocks base method.
+func (m *MockRateLimitWindowStorageAdapter) GetBlock(ctx context.Context, keyType, key string) (*time.Time, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "GetBlock", ctx, keyType, key)
+	ret0, _ := ret[0].(*time.Time)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// GetBlock indicates an expected call of GetBlock.
+func (mr *MockRateLimitWindowStorageAdapterMockRecorder) GetBlock(ctx, keyType, key any) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetBlock", reflect.TypeOf((*MockRateLimitWindowStorageAdapter)(nil).GetBlock), ctx, keyType, key)
+}
+
+// IncrementAccesses mocks base method.
+func (m *MockRateLimitWindowStorageAdapter) IncrementAccesses(ctx context.Context, keyType, key string, maxAccesses int64) (bool, int64, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "IncrementAccesses", ctx, keyType, key, maxAccesses)
+	ret0, _ := ret[0].(bool)
+	ret1, _ := ret[1].(int64)
+	ret2, _ := ret[2].(error)
+	return ret0, ret1, ret2
+}
+
+// IncrementAccesses indicates an expected call of IncrementAccesses.
+func (mr *MockRateLimitWindowStorageAdapterMockRecorder) IncrementAccesses(ctx, keyType, key, maxAccesses any) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "IncrementAccesses", reflect.TypeOf((*MockRateLimitWindowStorageAdapter)(nil).IncrementAccesses), ctx, keyType, key, maxAccesses)
+}
+
+// IncrementWindowAccesses mocks base method.
+func (m *MockRateLimitWindowStorageAdapter) IncrementWindowAccesses(ctx context.Context, keyType, key string, maxAccesses, windowMilliseconds int64) (bool, int64, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "IncrementWindowAccesses", ctx, keyType, key, maxAccesses, windowMilliseconds)
+	ret0, _ := ret[0].(bool)
+	ret1, _ := ret[1].(int64)
+	ret2, _ := ret[2].(error)
+	return ret0, ret1, ret2
+}
+
+// IncrementWindowAccesses indicates an expected call of IncrementWindowAccesses.
+func (mr *MockRateLimitWindowStorageAdapterMockRecorder) IncrementWindowAccesses(ctx, keyType, key, maxAccesses, windowMilliseconds any) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "IncrementWindowAccesses", reflect.TypeOf((*MockRateLimitWindowStorageAdapter)(nil).IncrementWindowAccesses), ctx, keyType, key, maxAccesses, windowMilliseconds)
+}
+
+// MockRateLimitBucketStorageAdapter is a mock of RateLimitBucketStorageAdapter interface.
+type MockRateLimitBucketStorageAdapter struct {
+	ctrl     *gomock.Controller
+	recorder *MockRateLimitBucketStorageAdapterMockRecorder
+}
+
+// MockRateLimitBucketStorageAdapterMockRecorder is the mock recorder for MockRateLimitBucketStorageAdapter.
+type MockRateLimitBucketStorageAdapterMockRecorder struct {
+	mock *MockRateLimitBucketStorageAdapter
+}
+
+// NewMockRateLimitBucketStorageAdapter creates a new mock instance.
+func NewMockRateLimitBucketStorageAdapter(ctrl *gomock.Controller) *MockRateLimitBucketStorageAdapter {
+	mock := &MockRateLimitBucketStorageAdapter{ctrl: ctrl}
+	mock.recorder = &MockRateLimitBucketStorageAdapterMockRecorder{mock}
+	return mock
+}
+
+// EXPECT returns an object that allows the caller to indicate expected use.
+func (m *MockRateLimitBucketStorageAdapter) EXPECT() *MockRateLimitBucketStorageAdapterMockRecorder {
+	return m.recorder
+}
+
+// AddBlock mocks base method.
+func (m *MockRateLimitBucketStorageAdapter) AddBlock(ctx context.Context, keyType, key string, milliseconds int64) (*time.Time, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "AddBlock", ctx, keyType, key, milliseconds)
+	ret0, _ := ret[0].(*time.Time)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// AddBlock indicates an expected call of AddBlock.
+func (mr *MockRateLimitBucketStorageAdapterMockRecorder) AddBlock(ctx, keyType, key, milliseconds any) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "AddBlock", reflect.TypeOf((*MockRateLimitBucketStorageAdapter)(nil).AddBlock), ctx, keyType, key, milliseconds)
+}
+
+// ConsumeBucketToken mocks base method.
+func (m *MockRateLimitBucketStorageAdapter) ConsumeBucketToken(ctx context.Context, keyType, key string, capacity, refillRatePerSecond int64) (bool, int64, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "ConsumeBucketToken", ctx, keyType, key, capacity, refillRatePerSecond)
+	ret0, _ := ret[0].(bool)
+	ret1, _ := ret[1].(int64)
+	ret2, _ := ret[2].(error)
+	return ret0, ret1, ret2
+}
+
+// ConsumeBucketToken indicates an expected call of ConsumeBucketToken.
+func (mr *MockRateLimitBucketStorageAdapterMockRecorder) ConsumeBucketToken(ctx, keyType, key, capacity, refillRatePerSecond any) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "ConsumeBucketToken", reflect.TypeOf((*MockRateLimitBucketStorageAdapter)(nil).ConsumeBucketToken), ctx, keyType, key, capacity, refillRatePerSecond)
+}
+
+// GetBlock mocks base method.
+func (m *MockRateLimitBucketStorageAdapter) GetBlock(ctx context.Context, keyType, key string) (*time.Time, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "GetBlock", ctx, keyType, key)
+	ret0, _ := ret[0].(*time.Time)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// GetBlock indicates an expected call of GetBlock.
+func (mr *MockRateLimitBucketStorageAdapterMockRecorder) GetBlock(ctx, keyType, key any) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetBlock", reflect.TypeOf((*MockRateLimitBucketStorageAdapter)(nil).GetBlock), ctx, keyType, key)
+}
+
+// IncrementAccesses mocks base method.
+func (m *MockRateLimitBucketStorageAdapter) IncrementAccesses(ctx context.Context, keyType, key string, maxAccesses int64) (bool, int64, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "IncrementAccesses", ctx, keyType, key, maxAccesses)
+	ret0, _ := ret[0].(bool)
+	ret1, _ := ret[1].(int64)
+	ret2, _ := ret[2].(error)
+	return ret0, ret1, ret2
+}
+
+// IncrementAccesses indicates an expected call of IncrementAccesses.
+func (mr *MockRateLimitBucketStorageAdapterMockRecorder) IncrementAccesses(ctx, keyType, key, maxAccesses any) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "IncrementAccesses", reflect.TypeOf((*MockRateLimitBucketStorageAdapter)(nil).IncrementAccesses), ctx, keyType, key, maxAccesses)
+}
+
+// MockRateLimitGCRAStorageAdapter is a mock of RateLimitGCRAStorageAdapter interface.
+type MockRateLimitGCRAStorageAdapter struct {
+	ctrl     *gomock.Controller
+	recorder *MockRateLimitGCRAStorageAdapterMockRecorder
+}
+
+// MockRateLimitGCRAStorageAdapterMockRecorder is the mock recorder for MockRateLimitGCRAStorageAdapter.
+type MockRateLimitGCRAStorageAdapterMockRecorder struct {
+	mock *MockRateLimitGCRAStorageAdapter
+}
+
+// NewMockRateLimitGCRAStorageAdapter creates a new mock instance.
+func NewMockRateLimitGCRAStorageAdapter(ctrl *gomock.Controller) *MockRateLimitGCRAStorageAdapter {
+	mock := &MockRateLimitGCRAStorageAdapter{ctrl: ctrl}
+	mock.recorder = &MockRateLimitGCRAStorageAdapterMockRecorder{mock}
+	return mock
+}
+
+// EXPECT returns an object that allows the caller to indicate expected use.
+func (m *MockRateLimitGCRAStorageAdapter) EXPECT() *MockRateLimitGCRAStorageAdapterMockRecorder {
+	return m.recorder
+}
+
+// AddBlock mocks base method.
+func (m *MockRateLimitGCRAStorageAdapter) AddBlock(ctx context.Context, keyType, key string, milliseconds int64) (*time.Time, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "AddBlock", ctx, keyType, key, milliseconds)
+	ret0, _ := ret[0].(*time.Time)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// AddBlock indicates an expected call of AddBlock.
+func (mr *MockRateLimitGCRAStorageAdapterMockRecorder) AddBlock(ctx, keyType, key, milliseconds any) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "AddBlock", reflect.TypeOf((*MockRateLimitGCRAStorageAdapter)(nil).AddBlock), ctx, keyType, key, milliseconds)
+}
+
+// ConsumeGCRA mocks base method.
+func (m *MockRateLimitGCRAStorageAdapter) ConsumeGCRA(ctx context.Context, keyType, key string, maxRequests, periodMilliseconds int64) (bool, int64, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "ConsumeGCRA", ctx, keyType, key, maxRequests, periodMilliseconds)
+	ret0, _ := ret[0].(bool)
+	ret1, _ := ret[1].(int64)
+	ret2, _ := ret[2].(error)
+	return ret0, ret1, ret2
+}
+
+// ConsumeGCRA indicates an expected call of ConsumeGCRA.
+func (mr *MockRateLimitGCRAStorageAdapterMockRecorder) ConsumeGCRA(ctx, keyType, key, maxRequests, periodMilliseconds any) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "ConsumeGCRA", reflect.TypeOf((*MockRateLimitGCRAStorageAdapter)(nil).ConsumeGCRA), ctx, keyType, key, maxRequests, periodMilliseconds)
+}
+
+// GetBlock mocks base method.
+func (m *MockRateLimitGCRAStorageAdapter) GetBlock(ctx context.Context, keyType, key string) (*time.Time, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "GetBlock", ctx, keyType, key)
+	ret0, _ := ret[0].(*time.Time)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// GetBlock indicates an expected call of GetBlock.
+func (mr *MockRateLimitGCRAStorageAdapterMockRecorder) GetBlock(ctx, keyType, key any) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetBlock", reflect.TypeOf((*MockRateLimitGCRAStorageAdapter)(nil).GetBlock), ctx, keyType, key)
+}
+
+// IncrementAccesses mocks base method.
+func (m *MockRateLimitGCRAStorageAdapter) IncrementAccesses(ctx context.Context, keyType, key string, maxAccesses int64) (bool, int64, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "IncrementAccesses", ctx, keyType, key, maxAccesses)
+	ret0, _ := ret[0].(bool)
+	ret1, _ := ret[1].(int64)
+	ret2, _ := ret[2].(error)
+	return ret0, ret1, ret2
+}
+
+// IncrementAccesses indicates an expected call of IncrementAccesses.
+func (mr *MockRateLimitGCRAStorageAdapterMockRecorder) IncrementAccesses(ctx, keyType, key, maxAccesses any) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "IncrementAccesses", reflect.TypeOf((*MockRateLimitGCRAStorageAdapter)(nil).IncrementAccesses), ctx, keyType, key, maxAccesses)
+}
+
+// MockRateLimitRefundStorageAdapter is a mock of RateLimitRefundStorageAdapter interface.
+type MockRateLimitRefundStorageAdapter struct {
+	ctrl     *gomock.Controller
+	recorder *MockRateLimitRefundStorageAdapterMockRecorder
+}
+
+// MockRateLimitRefundStorageAdapterMockRecorder is the mock recorder for MockRateLimitRefundStorageAdapter.
+type MockRateLimitRefundStorageAdapterMockRecorder struct {
+	mock *MockRateLimitRefundStorageAdapter
+}
+
+// NewMockRateLimitRefundStorageAdapter creates a new mock instance.
+func NewMockRateLimitRefundStorageAdapter(ctrl *gomock.Controller) *MockRateLimitRefundStorageAdapter {
+	mock := &MockRateLimitRefundStorageAdapter{ctrl: ctrl}
+	mock.recorder = &MockRateLimitRefundStorageAdapterMockRecorder{mock}
+	return mock
+}
+
+// EXPECT returns an object that allows the caller to indicate expected use.
+func (m *MockRateLimitRefundStorageAdapter) EXPECT() *MockRateLimitRefundStorageAdapterMockRecorder {
+	return m.recorder
+}
+
+// AddBlock mocks base method.
+func (m *MockRateLimitRefundStorageAdapter) AddBlock(ctx context.Context, keyType, key string, milliseconds int64) (*time.Time, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "AddBlock", ctx, keyType, key, milliseconds)
+	ret0, _ := ret[0].(*time.Time)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// AddBlock indicates an expected call of AddBlock.
+func (mr *MockRateLimitRefundStorageAdapterMockRecorder) AddBlock(ctx, keyType, key, milliseconds any) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "AddBlock", reflect.TypeOf((*MockRateLimitRefundStorageAdapter)(nil).AddBlock), ctx, keyType, key, milliseconds)
+}
+
+// GetBlock mocks base method.
+func (m *MockRateLimitRefundStorageAdapter) GetBlock(ctx context.Context, keyType, key string) (*time.Time, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "GetBlock", ctx, keyType, key)
+	ret0, _ := ret[0].(*time.Time)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// GetBlock indicates an expected call of GetBlock.
+func (mr *MockRateLimitRefundStorageAdapterMockRecorder) GetBlock(ctx, keyType, key any) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetBlock", reflect.TypeOf((*MockRateLimitRefundStorageAdapter)(nil).GetBlock), ctx, keyType, key)
+}
+
+// IncrementAccesses mocks base method.
+func (m *MockRateLimitRefundStorageAdapter) IncrementAccesses(ctx context.Context, keyType, key string, maxAccesses int64) (bool, int64, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "IncrementAccesses", ctx, keyType, key, maxAccesses)
+	ret0, _ := ret[0].(bool)
+	ret1, _ := ret[1].(int64)
+	ret2, _ := ret[2].(error)
+	return ret0, ret1, ret2
+}
+
+// IncrementAccesses indicates an expected call of IncrementAccesses.
+func (mr *MockRateLimitRefundStorageAdapterMockRecorder) IncrementAccesses(ctx, keyType, key, maxAccesses any) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "IncrementAccesses", reflect.TypeOf((*MockRateLimitRefundStorageAdapter)(nil).IncrementAccesses), ctx, keyType, key, maxAccesses)
+}
+
+// RefundAccess mocks base method.
+func (m *MockRateLimitRefundStorageAdapter) RefundAccess(ctx context.Context, keyType, key string) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "RefundAccess", ctx, keyType, key)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// RefundAccess indicates an expected call of RefundAccess.
+func (mr *MockRateLimitRefundStorageAdapterMockRecorder) RefundAccess(ctx, keyType, key any) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "RefundAccess", reflect.TypeOf((*MockRateLimitRefundStorageAdapter)(nil).RefundAccess), ctx, keyType, key)
+}
+
+// RefundBucketToken mocks base method.
+func (m *MockRateLimitRefundStorageAdapter) RefundBucketToken(ctx context.Context, keyType, key string, capacity int64) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "RefundBucketToken", ctx, keyType, key, capacity)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// RefundBucketToken indicates an expected call of RefundBucketToken.
+func (mr *MockRateLimitRefundStorageAdapterMockRecorder) RefundBucketToken(ctx, keyType, key, capacity any) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "RefundBucketToken", reflect.TypeOf((*MockRateLimitRefundStorageAdapter)(nil).RefundBucketToken), ctx, keyType, key, capacity)
+}
+
+// RefundGCRA mocks base method.
+func (m *MockRateLimitRefundStorageAdapter) RefundGCRA(ctx context.Context, keyType, key string, maxRequests, periodMilliseconds int64) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "RefundGCRA", ctx, keyType, key, maxRequests, periodMilliseconds)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// RefundGCRA indicates an expected call of RefundGCRA.
+func (mr *MockRateLimitRefundStorageAdapterMockRecorder) RefundGCRA(ctx, keyType, key, maxRequests, periodMilliseconds any) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "RefundGCRA", reflect.TypeOf((*MockRateLimitRefundStorageAdapter)(nil).RefundGCRA), ctx, keyType, key, maxRequests, periodMilliseconds)
+}
+
+// MockRateLimitAtomicStorageAdapter is a mock of RateLimitAtomicStorageAdapter interface.
+type MockRateLimitAtomicStorageAdapter struct {
+	ctrl     *gomock.Controller
+	recorder *MockRateLimitAtomicStorageAdapterMockRecorder
+}
+
+// MockRateLimitAtomicStorageAdapterMockRecorder is the mock recorder for MockRateLimitAtomicStorageAdapter.
+type MockRateLimitAtomicStorageAdapterMockRecorder struct {
+	mock *MockRateLimitAtomicStorageAdapter
+}
+
+// NewMockRateLimitAtomicStorageAdapter creates a new mock instance.
+func NewMockRateLimitAtomicStorageAdapter(ctrl *gomock.Controller) *MockRateLimitAtomicStorageAdapter {
+	mock := &MockRateLimitAtomicStorageAdapter{ctrl: ctrl}
+	mock.recorder = &MockRateLimitAtomicStorageAdapterMockRecorder{mock}
+	return mock
+}
+
+// EXPECT returns an object that allows the caller to indicate expected use.
+func (m *MockRateLimitAtomicStorageAdapter) EXPECT() *MockRateLimitAtomicStorageAdapterMockRecorder {
+	return m.recorder
+}
+
+// AddBlock mocks base method.
+func (m *MockRateLimitAtomicStorageAdapter) AddBlock(ctx context.Context, keyType, key string, milliseconds int64) (*time.Time, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "AddBlock", ctx, keyType, key, milliseconds)
+	ret0, _ := ret[0].(*time.Time)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// AddBlock indicates an expected call of AddBlock.
+func (mr *MockRateLimitAtomicStorageAdapterMockRecorder) AddBlock(ctx, keyType, key, milliseconds any) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "AddBlock", reflect.TypeOf((*MockRateLimitAtomicStorageAdapter)(nil).AddBlock), ctx, keyType, key, milliseconds)
+}
+
+// CheckAccesses mocks base method.
+func (m *MockRateLimitAtomicStorageAdapter) CheckAccesses(ctx context.Context, key string, limits []adapter.AccessLimit) (*adapter.AccessCheckResult, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "CheckAccesses", ctx, key, limits)
+	ret0, _ := ret[0].(*adapter.AccessCheckResult)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// CheckAccesses indicates an expected call of CheckAccesses.
+func (mr *MockRateLimitAtomicStorageAdapterMockRecorder) CheckAccesses(ctx, key, limits any) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "CheckAccesses", reflect.TypeOf((*MockRateLimitAtomicStorageAdapter)(nil).CheckAccesses), ctx, key, limits)
+}
+
+// GetBlock mocks base method.
+func (m *MockRateLimitAtomicStorageAdapter) GetBlock(ctx context.Context, keyType, key string) (*time.Time, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "GetBlock", ctx, keyType, key)
+	ret0, _ := ret[0].(*time.Time)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// GetBlock indicates an expected call of GetBlock.
+func (mr *MockRateLimitAtomicStorageAdapterMockRecorder) GetBlock(ctx, keyType, key any) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetBlock", reflect.TypeOf((*MockRateLimitAtomicStorageAdapter)(nil).GetBlock), ctx, keyType, key)
+}
+
+// IncrementAccesses mocks base method.
+func (m *MockRateLimitAtomicStorageAdapter) IncrementAccesses(ctx context.Context, keyType, key string, maxAccesses int64) (bool, int64, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "IncrementAccesses", ctx, keyType, key, maxAccesses)
+	ret0, _ := ret[0].(bool)
+	ret1, _ := ret[1].(int64)
+	ret2, _ := ret[2].(error)
+	return ret0, ret1, ret2
+}
+
+// IncrementAccesses indicates an expected call of IncrementAccesses.
+func (mr *MockRateLimitAtomicStorageAdapterMockRecorder) IncrementAccesses(ctx, keyType, key, maxAccesses any) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "IncrementAccesses", reflect.TypeOf((*MockRateLimitAtomicStorageAdapter)(nil).IncrementAccesses), ctx, keyType, key, maxAccesses)
+}
+
+// MockRateLimitPlanStorageAdapter is a mock of RateLimitPlanStorageAdapter interface.
+type MockRateLimitPlanStorageAdapter struct {
+	ctrl     *gomock.Controller
+	recorder *MockRateLimitPlanStorageAdapterMockRecorder
+}
+
+// MockRateLimitPlanStorageAdapterMockRecorder is the mock recorder for MockRateLimitPlanStorageAdapter.
+type MockRateLimitPlanStorageAdapterMockRecorder struct {
+	mock *MockRateLimitPlanStorageAdapter
+}
+
+// NewMockRateLimitPlanStorageAdapter creates a new mock instance.
+func NewMockRateLimitPlanStorageAdapter(ctrl *gomock.Controller) *MockRateLimitPlanStorageAdapter {
+	mock := &MockRateLimitPlanStorageAdapter{ctrl: ctrl}
+	mock.recorder = &MockRateLimitPlanStorageAdapterMockRecorder{mock}
+	return mock
+}
+
+// EXPECT returns an object that allows the caller to indicate expected use.
+func (m *MockRateLimitPlanStorageAdapter) EXPECT() *MockRateLimitPlanStorageAdapterMockRecorder {
+	return m.recorder
+}
+
+// AddBlock mocks base method.
+func (m *MockRateLimitPlanStorageAdapter) AddBlock(ctx context.Context, keyType, key string, milliseconds int64) (*time.Time, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "AddBlock", ctx, keyType, key, milliseconds)
+	ret0, _ := ret[0].(*time.Time)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// AddBlock indicates an expected call of AddBlock.
+func (mr *MockRateLimitPlanStorageAdapterMockRecorder) AddBlock(ctx, keyType, key, milliseconds any) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "AddBlock", reflect.TypeOf((*MockRateLimitPlanStorageAdapter)(nil).AddBlock), ctx, keyType, key, milliseconds)
+}
+
+// GetBlock mocks base method.
+func (m *MockRateLimitPlanStorageAdapter) GetBlock(ctx context.Context, keyType, key string) (*time.Time, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "GetBlock", ctx, keyType, key)
+	ret0, _ := ret[0].(*time.Time)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// GetBlock indicates an expected call of GetBlock.
+func (mr *MockRateLimitPlanStorageAdapterMockRecorder) GetBlock(ctx, keyType, key any) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetBlock", reflect.TypeOf((*MockRateLimitPlanStorageAdapter)(nil).GetBlock), ctx, keyType, key)
+}
+
+// GetTokenPlan mocks base method.
+func (m *MockRateLimitPlanStorageAdapter) GetTokenPlan(ctx context.Context, token string) (*adapter.TokenPlan, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "GetTokenPlan", ctx, token)
+	ret0, _ := ret[0].(*adapter.TokenPlan)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// GetTokenPlan indicates an expected call of GetTokenPlan.
+func (mr *MockRateLimitPlanStorageAdapterMockRecorder) GetTokenPlan(ctx, token any) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetTokenPlan", reflect.TypeOf((*MockRateLimitPlanStorageAdapter)(nil).GetTokenPlan), ctx, token)
+}
+
+// IncrementAccesses mocks base method.
+func (m *MockRateLimitPlanStorageAdapter) IncrementAccesses(ctx context.Context, keyType, key string, maxAccesses int64) (bool, int64, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "IncrementAccesses", ctx, keyType, key, maxAccesses)
+	ret0, _ := ret[0].(bool)
+	ret1, _ := ret[1].(int64)
+	ret2, _ := ret[2].(error)
+	return ret0, ret1, ret2
+}
+
+// IncrementAccesses indicates an expected call of IncrementAccesses.
+func (mr *MockRateLimitPlanStorageAdapterMockRecorder) IncrementAccesses(ctx, keyType, key, maxAccesses any) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "IncrementAccesses", reflect.TypeOf((*MockRateLimitPlanStorageAdapter)(nil).IncrementAccesses), ctx, keyType, key, maxAccesses)
+}
@@ -0,0 +1,55 @@
+// Code generated by MockGen. DO NOT EDIT.
+// Source: ./ratelimiter/tokenstore/token_store.go
+//
+// Generated by this command:
+//
+//	mockgen -source=./ratelimiter/tokenstore/token_store.go -destination ./ratelimiter/mocks/token_store.go -package mocks
+//
+
+// Package mocks is a generated GoMock package.
+package mocks
+
+import (
+	context "context"
+	reflect "reflect"
+
+	gomock "go.uber.org/mock/gomock"
+)
+
+// MockRateLimiterTokenStore is a mock of RateLimiterTokenStore interface.
+type MockRateLimiterTokenStore struct {
+	ctrl     *gomock.Controller
+	recorder *MockRateLimiterTokenStoreMockRecorder
+}
+
+// MockRateLimiterTokenStoreMockRecorder is the mock recorder for MockRateLimiterTokenStore.
+type MockRateLimiterTokenStoreMockRecorder struct {
+	mock *MockRateLimiterTokenStore
+}
+
+// NewMockRateLimiterTokenStore creates a new mock instance.
+func NewMockRateLimiterTokenStore(ctrl *gomock.Controller) *MockRateLimiterTokenStore {
+	mock := &MockRateLimiterTokenStore{ctrl: ctrl}
+	mock.recorder = &MockRateLimiterTokenStoreMockRecorder{mock}
+	return mock
+}
+
+// EXPECT returns an object that allows the caller to indicate expected use.
+func (m *MockRateLimiterTokenStore) EXPECT() *MockRateLimiterTokenStoreMockRecorder {
+	return m.recorder
+}
+
+// HasToken mocks base method.
+func (m *MockRateLimiterTokenStore) HasToken(ctx context.Context, token string) (bool, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "HasToken", ctx, token)
+	ret0, _ := ret[0].(bool)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// HasToken indicates an expected call of HasToken.
+func (mr *MockRateLimiterTokenStoreMockRecorder) HasToken(ctx, token any) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "HasToken", reflect.TypeOf((*MockRateLimiterTokenStore)(nil).HasToken), ctx, token)
+}
@@ -0,0 +1,262 @@
+package ratelimiter
+
+import (
+	"context"
+	"log/slog"
+	"net/http"
+	"time"
+
+	"github.com/arfurlaneto/goexpert-challenge-rate-limiter/ratelimiter/adapter"
+	"github.com/arfurlaneto/goexpert-challenge-rate-limiter/ratelimiter/metrics"
+	"github.com/arfurlaneto/goexpert-challenge-rate-limiter/ratelimiter/responsewriter"
+	"github.com/arfurlaneto/goexpert-challenge-rate-limiter/ratelimiter/tokenextractor"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// defaultStartupTimeout bounds the storage adapter and token store checks of
+// New, unless WithContext is used.
+const defaultStartupTimeout = 5 * time.Second
+
+// RateLimiterOption configures a rate limiter created with New.
+type RateLimiterOption func(*rateLimiterOptions)
+
+type rateLimiterOptions struct {
+	ctx        context.Context
+	configFile string
+	withoutEnv bool
+	apply      []func(config *RateLimiterConfig)
+}
+
+func (o *rateLimiterOptions) add(fn func(config *RateLimiterConfig)) {
+	o.apply = append(o.apply, fn)
+}
+
+// New creates a reloadable rate limiter from options, checking it like
+// NewValidatedReloadableRateLimiter. The sources are applied in this order,
+// each one overriding the previous: the defaults, the WithConfigFile file,
+// the options and the envs. WithoutEnv (or disableEnvs in the file) ignores
+// the envs.
+func New(opts ...RateLimiterOption) (*RateLimiter, error) {
+	options := &rateLimiterOptions{}
+	for _, opt := range opts {
+		opt(options)
+	}
+
+	config := &RateLimiterConfig{}
+	if options.configFile != "" {
+		fileConfig, err := LoadConfigFile(options.configFile)
+		if err != nil {
+			return nil, err
+		}
+		config = fileConfig
+	}
+
+	for _, apply := range options.apply {
+		apply(config)
+	}
+
+	if options.withoutEnv {
+		config.DisableEnvs = true
+	}
+	config.ignoreAllEnvs = config.DisableEnvs
+
+	ctx := options.ctx
+	if ctx == nil {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(context.Background(), defaultStartupTimeout)
+		defer cancel()
+	}
+
+	return NewValidatedReloadableRateLimiter(ctx, config)
+}
+
+// WithContext bounds the storage adapter and token store checks of New.
+// Defaults to 5 seconds.
+func WithContext(ctx context.Context) RateLimiterOption {
+	return func(o *rateLimiterOptions) {
+		o.ctx = ctx
+	}
+}
+
+// WithConfigFile loads a JSON or YAML file, see LoadConfigFile. The other
+// options override it.
+func WithConfigFile(path string) RateLimiterOption {
+	return func(o *rateLimiterOptions) {
+		o.configFile = path
+	}
+}
+
+// WithoutEnv ignores the envs, as DisableEnvs.
+func WithoutEnv() RateLimiterOption {
+	return func(o *rateLimiterOptions) {
+		o.withoutEnv = true
+	}
+}
+
+// WithIPLimit limits requests without a token by IP.
+func WithIPLimit(limit RateLimiterRateConfig) RateLimiterOption {
+	return func(o *rateLimiterOptions) {
+		o.add(func(config *RateLimiterConfig) {
+			limit := limit
+			config.IP = &limit
+		})
+	}
+}
+
+// WithTokenLimit limits requests with a token that is not a custom token.
+func WithTokenLimit(limit RateLimiterRateConfig) RateLimiterOption {
+	return func(o *rateLimiterOptions) {
+		o.add(func(config *RateLimiterConfig) {
+			limit := limit
+			config.Token = &limit
+		})
+	}
+}
+
+// WithCustomTokenLimit gives a token its own limit.
+func WithCustomTokenLimit(token string, limit RateLimiterRateConfig) RateLimiterOption {
+	return func(o *rateLimiterOptions) {
+		o.add(func(config *RateLimiterConfig) {
+			if config.CustomTokens == nil {
+				config.CustomTokens = &map[string]*RateLimiterRateConfig{}
+			}
+			limit := limit
+			(*config.CustomTokens)[token] = &limit
+		})
+	}
+}
+
+// WithPlan adds a plan, whose tokens are set with WithTokenPlan.
+func WithPlan(name string, limit RateLimiterRateConfig) RateLimiterOption {
+	return func(o *rateLimiterOptions) {
+		o.add(func(config *RateLimiterConfig) {
+			if config.Plans == nil {
+				config.Plans = map[string]*RateLimiterRateConfig{}
+			}
+			limit := limit
+			config.Plans[name] = &limit
+		})
+	}
+}
+
+// WithTokenPlan puts a token on a plan.
+func WithTokenPlan(token string, plan string) RateLimiterOption {
+	return func(o *rateLimiterOptions) {
+		o.add(func(config *RateLimiterConfig) {
+			if config.TokenPlans == nil {
+				config.TokenPlans = map[string]string{}
+			}
+			config.TokenPlans[token] = plan
+		})
+	}
+}
+
+// WithRule adds a rule, after the ones of the file.
+func WithRule(rule RateLimiterRule) RateLimiterOption {
+	return func(o *rateLimiterOptions) {
+		o.add(func(config *RateLimiterConfig) {
+			rule := rule
+			config.Rules = append(config.Rules, &rule)
+		})
+	}
+}
+
+// WithRedis uses the Redis Storage Adapter.
+func WithRedis(redis RateLimiterRedisConfig) RateLimiterOption {
+	return func(o *rateLimiterOptions) {
+		o.add(func(config *RateLimiterConfig) {
+			redis := redis
+			config.Redis = &redis
+		})
+	}
+}
+
+// WithStorageAdapter uses a custom storage adapter. It wins over WithRedis.
+func WithStorageAdapter(storageAdapter adapter.RateLimitStorageAdapter) RateLimiterOption {
+	return func(o *rateLimiterOptions) {
+		o.add(func(config *RateLimiterConfig) {
+			config.StorageAdapter = storageAdapter
+		})
+	}
+}
+
+// WithResponseWriter uses a custom response writer.
+func WithResponseWriter(responseWriter responsewriter.RateLimiterResponseWriter) RateLimiterOption {
+	return func(o *rateLimiterOptions) {
+		o.add(func(config *RateLimiterConfig) {
+			config.ResponseWriter = responseWriter
+		})
+	}
+}
+
+// WithTokenExtractor reads the token of requests with a token extractor.
+func WithTokenExtractor(tokenExtractor tokenextractor.RateLimiterTokenExtractor) RateLimiterOption {
+	return func(o *rateLimiterOptions) {
+		o.add(func(config *RateLimiterConfig) {
+			config.TokenExtractor = tokenExtractor
+		})
+	}
+}
+
+// WithKeyFunc reads the token of requests with a function. Requests for which
+// it returns an empty string are limited by IP.
+func WithKeyFunc(fn func(r *http.Request) string) RateLimiterOption {
+	return WithTokenExtractor(tokenextractor.RateLimiterTokenExtractorFunc(fn))
+}
+
+// WithMetrics reports the allowed, rejected and failed keys to metrics, like
+// metrics.NewPrometheusMetrics.
+func WithMetrics(rateLimiterMetrics metrics.RateLimiterMetrics) RateLimiterOption {
+	return func(o *rateLimiterOptions) {
+		o.add(func(config *RateLimiterConfig) {
+			config.Metrics = rateLimiterMetrics
+		})
+	}
+}
+
+// WithTracerProvider traces the rate limit checks and the storage adapter
+// calls, see TracerProvider.
+func WithTracerProvider(tracerProvider trace.TracerProvider) RateLimiterOption {
+	return func(o *rateLimiterOptions) {
+		o.add(func(config *RateLimiterConfig) {
+			config.TracerProvider = tracerProvider
+		})
+	}
+}
+
+// WithTrustedProxies reads the client IP from the forwarding headers of
+// these proxies, as TrustedProxies.
+func WithTrustedProxies(proxies ...string) RateLimiterOption {
+	return func(o *rateLimiterOptions) {
+		o.add(func(config *RateLimiterConfig) {
+			config.TrustedProxies = proxies
+		})
+	}
+}
+
+// WithLogger logs structured records to logger, see Logger.
+func WithLogger(logger *slog.Logger) RateLimiterOption {
+	return func(o *rateLimiterOptions) {
+		o.add(func(config *RateLimiterConfig) {
+			config.Logger = logger
+		})
+	}
+}
+
+// WithRedactTokens logs a hash of the tokens instead of the tokens.
+func WithRedactTokens() RateLimiterOption {
+	return func(o *rateLimiterOptions) {
+		o.add(func(config *RateLimiterConfig) {
+			config.RedactTokens = true
+		})
+	}
+}
+
+// WithDebug logs every record to stdout, unless WithLogger is used.
+func WithDebug() RateLimiterOption {
+	return func(o *rateLimiterOptions) {
+		o.add(func(config *RateLimiterConfig) {
+			config.Debug = true
+		})
+	}
+}
@@ -0,0 +1,197 @@
+package ratelimiter
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/arfurlaneto/goexpert-challenge-rate-limiter/ratelimiter/adapter"
+	"github.com/arfurlaneto/goexpert-challenge-rate-limiter/ratelimiter/metrics"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/suite"
+	"go.opentelemetry.io/otel/trace/noop"
+)
+
+type OptionsTestSuite struct {
+	suite.Suite
+}
+
+func TestOptionsTestSuite(t *testing.T) {
+	suite.Run(t, new(OptionsTestSuite))
+}
+
+func (s *OptionsTestSuite) SetupTest() {
+	os.Unsetenv(envKeyIPMaxRequestsPerSecond)
+	os.Unsetenv(envKeyTokenMaxRequestsPerSecond)
+	os.Unsetenv(envUseRedis)
+	os.Unsetenv(envRedisAddress)
+}
+
+func (s *OptionsTestSuite) TearDownTest() {
+	s.SetupTest()
+}
+
+func (s *OptionsTestSuite) writeFile(name string, content string) string {
+	path := filepath.Join(s.T().TempDir(), name)
+	os.WriteFile(path, []byte(content), 0644)
+	return path
+}
+
+func (s *OptionsTestSuite) TestNew_Defaults() {
+	limiter, err := New(WithoutEnv())
+	assert.Nil(s.T(), err)
+	assert.Equal(s.T(), getDefaultConfiguration().IP, limiter.GetConfig().IP)
+	assert.Equal(s.T(), getDefaultConfiguration().Token, limiter.GetConfig().Token)
+	assert.True(s.T(), limiter.GetConfig().DisableEnvs)
+}
+
+func (s *OptionsTestSuite) TestNew_Options() {
+	rateLimiterMetrics := metrics.NewNoopMetrics()
+	tracerProvider := noop.NewTracerProvider()
+	limiter, err := New(
+		WithIPLimit(RateLimiterRateConfig{MaxRequestsPerSecond: 10, BlockTimeMilliseconds: 1000}),
+		WithTokenLimit(RateLimiterRateConfig{MaxRequestsPerSecond: 20, BlockTimeMilliseconds: 500}),
+		WithCustomTokenLimit("abc", RateLimiterRateConfig{MaxRequestsPerSecond: 30, BlockTimeMilliseconds: 100}),
+		WithPlan("pro", RateLimiterRateConfig{MaxRequestsPerSecond: 40, BlockTimeMilliseconds: 100}),
+		WithTokenPlan("def", "pro"),
+		WithRule(RateLimiterRule{ID: "login", Path: "/login", IP: &RateLimiterRateConfig{MaxRequestsPerSecond: 5, BlockTimeMilliseconds: 60000}}),
+		WithTrustedProxies("10.0.0.0/8"),
+		WithMetrics(rateLimiterMetrics),
+		WithTracerProvider(tracerProvider),
+		WithoutEnv(),
+	)
+	assert.Nil(s.T(), err)
+
+	config := limiter.GetConfig()
+	assert.Equal(s.T(), &RateLimiterRateConfig{MaxRequestsPerSecond: 10, BlockTimeMilliseconds: 1000}, config.IP)
+	assert.Equal(s.T(), &RateLimiterRateConfig{MaxRequestsPerSecond: 20, BlockTimeMilliseconds: 500}, config.Token)
+	assert.Equal(s.T(), int64(30), (*config.CustomTokens)["abc"].MaxRequestsPerSecond)
+	assert.Equal(s.T(), int64(40), config.Plans["pro"].MaxRequestsPerSecond)
+	assert.Equal(s.T(), "pro", config.TokenPlans["def"])
+	assert.Len(s.T(), config.Rules, 1)
+	assert.Equal(s.T(), []string{"10.0.0.0/8"}, config.TrustedProxies)
+	assert.Equal(s.T(), rateLimiterMetrics, config.Metrics)
+	assert.Equal(s.T(), tracerProvider, config.TracerProvider)
+}
+
+func (s *OptionsTestSuite) TestNew_KeyFunc() {
+	limiter, err := New(
+		WithTokenLimit(RateLimiterRateConfig{MaxRequestsPerSecond: 1, WindowMilliseconds: 60000, BlockTimeMilliseconds: 60000}),
+		WithKeyFunc(func(r *http.Request) string {
+			return r.URL.Query().Get("tenant")
+		}),
+		WithoutEnv(),
+	)
+	assert.Nil(s.T(), err)
+
+	handler := limiter.Handler(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(200)
+	}))
+
+	statuses := []int{}
+	for _, url := range []string{"http://testing/?tenant=a", "http://testing/?tenant=b", "http://testing/?tenant=a"} {
+		recorder := httptest.NewRecorder()
+		handler.ServeHTTP(recorder, httptest.NewRequest("GET", url, nil))
+		statuses = append(statuses, recorder.Result().StatusCode)
+	}
+	assert.Equal(s.T(), []int{200, 200, 429}, statuses)
+}
+
+func (s *OptionsTestSuite) TestNew_Precedence() {
+	path := s.writeFile("config.yaml", `
+ip: {maxRequestsPerSecond: 10, blockTimeMilliseconds: 1000}
+token: {maxRequestsPerSecond: 20, blockTimeMilliseconds: 500}
+`)
+	os.Setenv(envKeyTokenMaxRequestsPerSecond, "40")
+
+	// the file overrides the defaults, the options override the file and the envs override the options
+	limiter, err := New(
+		WithConfigFile(path),
+		WithIPLimit(RateLimiterRateConfig{MaxRequestsPerSecond: 30, BlockTimeMilliseconds: 1000}),
+		WithTokenLimit(RateLimiterRateConfig{MaxRequestsPerSecond: 30, BlockTimeMilliseconds: 500}),
+	)
+	assert.Nil(s.T(), err)
+	assert.Equal(s.T(), int64(30), limiter.GetConfig().IP.MaxRequestsPerSecond)
+	assert.Equal(s.T(), int64(40), limiter.GetConfig().Token.MaxRequestsPerSecond)
+
+	limiter, err = New(WithConfigFile(path))
+	assert.Nil(s.T(), err)
+	assert.Equal(s.T(), int64(10), limiter.GetConfig().IP.MaxRequestsPerSecond)
+	assert.Equal(s.T(), int64(40), limiter.GetConfig().Token.MaxRequestsPerSecond)
+
+	limiter, err = New(WithConfigFile(path), WithoutEnv())
+	assert.Nil(s.T(), err)
+	assert.Equal(s.T(), int64(20), limiter.GetConfig().Token.MaxRequestsPerSecond)
+
+	path = s.writeFile("config.json", `{"disableEnvs": true}`)
+	limiter, err = New(WithConfigFile(path))
+	assert.Nil(s.T(), err)
+	assert.Equal(s.T(), getDefaultConfiguration().Token, limiter.GetConfig().Token)
+}
+
+func (s *OptionsTestSuite) TestNew_OptionsAreNotShared() {
+	options := []RateLimiterOption{WithIPLimit(RateLimiterRateConfig{MaxRequestsPerSecond: 10, BlockTimeMilliseconds: 1000})}
+
+	first, err := New(options...)
+	assert.Nil(s.T(), err)
+
+	os.Setenv(envKeyIPMaxRequestsPerSecond, "20")
+	second, err := New(options...)
+	assert.Nil(s.T(), err)
+
+	assert.Equal(s.T(), int64(10), first.GetConfig().IP.MaxRequestsPerSecond)
+	assert.Equal(s.T(), int64(20), second.GetConfig().IP.MaxRequestsPerSecond)
+}
+
+func (s *OptionsTestSuite) TestNew_Redis() {
+	server := miniredis.RunT(s.T())
+
+	limiter, err := New(WithRedis(RateLimiterRedisConfig{Addresses: []string{server.Addr()}}), WithoutEnv())
+	assert.Nil(s.T(), err)
+	assert.IsType(s.T(), adapter.NewRateLimitRedisStorageAdapter("", "", 0), limiter.GetConfig().StorageAdapter)
+
+	storageAdapter := adapter.NewRateLimitMemoryStorageAdapter()
+	limiter, err = New(
+		WithRedis(RateLimiterRedisConfig{Addresses: []string{server.Addr()}}),
+		WithStorageAdapter(storageAdapter),
+		WithoutEnv(),
+	)
+	assert.Nil(s.T(), err)
+	assert.Equal(s.T(), storageAdapter, limiter.GetConfig().StorageAdapter)
+
+	address := server.Addr()
+	server.Close()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	_, err = New(WithRedis(RateLimiterRedisConfig{Addresses: []string{address}}), WithContext(ctx), WithoutEnv())
+	assert.ErrorContains(s.T(), err, "storage adapter is unreachable")
+}
+
+func (s *OptionsTestSuite) TestNew_WithoutEnvIgnoresUseRedisAndCustomTokens() {
+	os.Setenv(envUseRedis, "true")
+	os.Setenv(envRedisAddress, "localhost:1")
+	os.Setenv("RATE_LIMITER_TOKEN_abc_MAX_REQUESTS", "555")
+	defer os.Unsetenv("RATE_LIMITER_TOKEN_abc_MAX_REQUESTS")
+
+	limiter, err := New(WithoutEnv())
+	assert.Nil(s.T(), err)
+	assert.IsType(s.T(), adapter.NewRateLimitMemoryStorageAdapter(), limiter.GetConfig().StorageAdapter)
+	assert.Empty(s.T(), *limiter.GetConfig().CustomTokens)
+
+	_, err = limiter.Reload(&RateLimiterConfig{DisableEnvs: true})
+	assert.Nil(s.T(), err)
+	assert.Empty(s.T(), *limiter.GetConfig().CustomTokens)
+}
+
+func (s *OptionsTestSuite) TestNew_Invalid() {
+	_, err := New(WithIPLimit(RateLimiterRateConfig{MaxRequestsPerSecond: 10}), WithoutEnv())
+	assert.ErrorContains(s.T(), err, "ip.blockTimeMilliseconds: must be greater than 0, got 0")
+
+	_, err = New(WithConfigFile("/missing/config.yaml"))
+	assert.NotNil(s.T(), err)
+}
@@ -0,0 +1,204 @@
+package ratelimiter
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"sync"
+
+	"github.com/arfurlaneto/goexpert-challenge-rate-limiter/ratelimiter/adapter"
+)
+
+// rateLimiterPlansFile is the format of PlansFile.
+type rateLimiterPlansFile struct {
+	Plans      map[string]*RateLimiterRateConfig `json:"plans"`
+	TokenPlans map[string]string                 `json:"tokenPlans"`
+}
+
+// getTokenRateConfig returns the limits of a token: its custom token limits,
+// the limits of its plan or, for unknown tokens, the Token limits. Plans of
+// the storage adapter are used when StoragePlans is enabled.
+func getTokenRateConfig(ctx context.Context, config *RateLimiterConfig, token string) (*RateLimiterRateConfig, bool, error) {
+	customTokenConfig, ok := (*config.CustomTokens)[token]
+	if ok {
+		return customTokenConfig, true, nil
+	}
+
+	plan, ok := config.TokenPlans[token]
+	if ok {
+		return getPlanRateConfig(config, plan), true, nil
+	}
+
+	if !config.StoragePlans {
+		return config.Token, false, nil
+	}
+
+	planStorageAdapter, ok := config.StorageAdapter.(adapter.RateLimitPlanStorageAdapter)
+	if !ok {
+		return config.Token, false, nil
+	}
+
+	tokenPlan, err := storageGetTokenPlan(ctx, config, planStorageAdapter, token)
+	if err != nil {
+		return nil, false, err
+	}
+	if tokenPlan == nil {
+		return config.Token, false, nil
+	}
+
+	if tokenPlan.Limits == "" {
+		return getPlanRateConfig(config, tokenPlan.Name), true, nil
+	}
+
+	planConfig, err := config.planCache.decode(tokenPlan.Limits)
+	if err != nil {
+		return nil, false, fmt.Errorf("invalid limits of plan \"%s\": %w", tokenPlan.Name, err)
+	}
+	return planConfig, true, nil
+}
+
+// getPlanRateConfig returns the limits of a plan, falling back to the Token
+// limits when the plan does not exist. A missing plan, named by the token
+// plans of the configuration or by the storage adapter, is warned about once.
+// Token plans naming a missing plan, from any source, are also reported by
+// Validate once the configuration is set: the validated rate limiters fail,
+// the others only warn.
+func getPlanRateConfig(config *RateLimiterConfig, plan string) *RateLimiterRateConfig {
+	planConfig, ok := config.Plans[plan]
+	if !ok {
+		if config.planCache.isFirstMissing(plan) {
+			config.GetLogger().Warn("plan not found, using the token limits", "plan", plan)
+		}
+		return config.Token
+	}
+	return planConfig
+}
+
+// maxCachedPlans bounds the plans decoded from the storage adapter that are
+// kept. The cache is emptied when it is reached.
+const maxCachedPlans = 1024
+
+// planCache keeps the plans of the storage adapter decoded, by their JSON
+// limits, so they are not decoded on every request, and the missing plans
+// already warned about. A nil cache decodes every time.
+type planCache struct {
+	mutex   sync.RWMutex
+	decoded map[string]*RateLimiterRateConfig
+	missing map[string]bool
+}
+
+func newPlanCache() *planCache {
+	return &planCache{decoded: map[string]*RateLimiterRateConfig{}, missing: map[string]bool{}}
+}
+
+// decode returns the plan of JSON limits. The returned plan is shared and
+// must not be changed.
+func (c *planCache) decode(limits string) (*RateLimiterRateConfig, error) {
+	if c != nil {
+		c.mutex.RLock()
+		planConfig, ok := c.decoded[limits]
+		c.mutex.RUnlock()
+		if ok {
+			return planConfig, nil
+		}
+	}
+
+	planConfig := &RateLimiterRateConfig{}
+	err := json.Unmarshal([]byte(limits), planConfig)
+	if err != nil {
+		return nil, err
+	}
+
+	if c != nil {
+		c.mutex.Lock()
+		if len(c.decoded) >= maxCachedPlans {
+			c.decoded = map[string]*RateLimiterRateConfig{}
+		}
+		c.decoded[limits] = planConfig
+		c.mutex.Unlock()
+	}
+	return planConfig, nil
+}
+
+// isFirstMissing returns whether the missing plan is seen for the first time.
+func (c *planCache) isFirstMissing(plan string) bool {
+	if c == nil {
+		return true
+	}
+
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	if c.missing[plan] || len(c.missing) >= maxCachedPlans {
+		return false
+	}
+	c.missing[plan] = true
+	return true
+}
+
+func configurePlans(config *RateLimiterConfig) {
+	if !config.DisableEnvs {
+		plansFile, ok := getStringEnv(envPlansFile)
+		if ok {
+			config.PlansFile = plansFile
+			config.GetLogger().Debug("using env", "env", envPlansFile)
+		}
+
+		storagePlans, ok := getBoolEnv(envStoragePlans)
+		if ok {
+			config.StoragePlans = storagePlans
+			config.GetLogger().Debug("using env", "env", envStoragePlans)
+		}
+	}
+
+	plans := map[string]*RateLimiterRateConfig{}
+	tokenPlans := map[string]string{}
+
+	if config.PlansFile != "" {
+		plansFile, err := loadPlansFile(config.PlansFile)
+		if err != nil {
+			addConfigurationProblem(config, "plans file: %s", err)
+		} else {
+			for plan, planConfig := range plansFile.Plans {
+				plans[plan] = planConfig
+			}
+			for token, plan := range plansFile.TokenPlans {
+				tokenPlans[token] = plan
+			}
+		}
+	}
+
+	for plan, planConfig := range config.Plans {
+		plans[plan] = planConfig
+	}
+	for token, plan := range config.TokenPlans {
+		tokenPlans[token] = plan
+	}
+
+	for plan, planConfig := range plans {
+		if planConfig == nil {
+			addConfigurationProblem(config, "plan \"%s\": no limits", plan)
+			delete(plans, plan)
+		}
+	}
+
+	config.Plans = plans
+	config.TokenPlans = tokenPlans
+	config.planCache = newPlanCache()
+}
+
+// loadPlansFile reads a JSON file with plans and token plans, like
+// {"plans": {"free": {"maxRequestsPerSecond": 10}}, "tokenPlans": {"abc": "free"}}.
+func loadPlansFile(path string) (*rateLimiterPlansFile, error) {
+	content, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	plansFile := &rateLimiterPlansFile{}
+	err = json.Unmarshal(content, plansFile)
+	if err != nil {
+		return nil, fmt.Errorf("invalid plans file \"%s\": %w", path, err)
+	}
+	return plansFile, nil
+}
@@ -0,0 +1,260 @@
+package ratelimiter
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/arfurlaneto/goexpert-challenge-rate-limiter/ratelimiter/adapter"
+	"github.com/arfurlaneto/goexpert-challenge-rate-limiter/ratelimiter/mocks"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/suite"
+	"go.uber.org/mock/gomock"
+)
+
+type PlansTestSuite struct {
+	suite.Suite
+	controller *gomock.Controller
+	context    context.Context
+}
+
+func TestPlansTestSuite(t *testing.T) {
+	suite.Run(t, new(PlansTestSuite))
+}
+
+func (s *PlansTestSuite) SetupTest() {
+	s.controller = gomock.NewController(s.T())
+	s.context = context.Background()
+	os.Unsetenv(envPlansFile)
+	os.Unsetenv(envStoragePlans)
+}
+
+func (s *PlansTestSuite) TearDownTest() {
+	s.SetupTest()
+}
+
+func (s *PlansTestSuite) getConfig() *RateLimiterConfig {
+	return &RateLimiterConfig{
+		Token:        &RateLimiterRateConfig{MaxRequestsPerSecond: 20},
+		CustomTokens: &map[string]*RateLimiterRateConfig{"abc": {MaxRequestsPerSecond: 30}},
+		Plans:        map[string]*RateLimiterRateConfig{"pro": {MaxRequestsPerSecond: 100}},
+		TokenPlans:   map[string]string{"abc": "pro", "def": "pro", "ghi": "gone"},
+	}
+}
+
+func (s *PlansTestSuite) TestGetTokenRateConfig() {
+	config := s.getConfig()
+
+	for token, expected := range map[string]int64{"abc": 30, "def": 100, "ghi": 20} {
+		rateConfig, known, err := getTokenRateConfig(s.context, config, token)
+		assert.Nil(s.T(), err)
+		assert.True(s.T(), known, token)
+		assert.Equal(s.T(), expected, rateConfig.MaxRequestsPerSecond, token)
+	}
+
+	rateConfig, known, err := getTokenRateConfig(s.context, config, "zzz")
+	assert.Nil(s.T(), err)
+	assert.False(s.T(), known)
+	assert.Equal(s.T(), config.Token, rateConfig)
+}
+
+func (s *PlansTestSuite) TestGetTokenRateConfig_PlanChangesAllTokens() {
+	config := s.getConfig()
+	config.Plans["pro"].MaxRequestsPerSecond = 200
+
+	rateConfig, _, _ := getTokenRateConfig(s.context, config, "def")
+	assert.Equal(s.T(), int64(200), rateConfig.MaxRequestsPerSecond)
+}
+
+func (s *PlansTestSuite) TestGetTokenRateConfig_StoragePlans() {
+	storageAdapter := adapter.NewRateLimitMemoryStorageAdapter()
+	storageAdapter.SetTokenPlan("jkl", "pro")
+	storageAdapter.SetTokenPlan("mno", "enterprise")
+	storageAdapter.SetPlan("enterprise", `{"maxRequestsPerSecond":1000,"windowMilliseconds":60000}`)
+
+	config := s.getConfig()
+	config.StorageAdapter = storageAdapter
+
+	rateConfig, known, err := getTokenRateConfig(s.context, config, "jkl")
+	assert.Nil(s.T(), err)
+	assert.False(s.T(), known)
+	assert.Equal(s.T(), config.Token, rateConfig)
+
+	config.StoragePlans = true
+
+	rateConfig, known, err = getTokenRateConfig(s.context, config, "jkl")
+	assert.Nil(s.T(), err)
+	assert.True(s.T(), known)
+	assert.Equal(s.T(), int64(100), rateConfig.MaxRequestsPerSecond)
+
+	rateConfig, known, err = getTokenRateConfig(s.context, config, "mno")
+	assert.Nil(s.T(), err)
+	assert.True(s.T(), known)
+	assert.Equal(s.T(), &RateLimiterRateConfig{MaxRequestsPerSecond: 1000, WindowMilliseconds: 60000}, rateConfig)
+
+	rateConfig, known, err = getTokenRateConfig(s.context, config, "zzz")
+	assert.Nil(s.T(), err)
+	assert.False(s.T(), known)
+	assert.Equal(s.T(), config.Token, rateConfig)
+
+	storageAdapter.SetPlan("enterprise", "{")
+	_, _, err = getTokenRateConfig(s.context, config, "mno")
+	assert.NotNil(s.T(), err)
+}
+
+func (s *PlansTestSuite) TestGetTokenRateConfig_StoragePlansError() {
+	storageAdapterMock := mocks.NewMockRateLimitPlanStorageAdapter(s.controller)
+	storageAdapterMock.EXPECT().GetTokenPlan(gomock.Any(), "zzz").Return(nil, errors.New("storage error"))
+
+	config := s.getConfig()
+	config.StorageAdapter = storageAdapterMock
+	config.StoragePlans = true
+
+	_, _, err := getTokenRateConfig(s.context, config, "zzz")
+	assert.NotNil(s.T(), err)
+}
+
+func (s *PlansTestSuite) TestGetTokenRateConfig_StoragePlansAreDecodedOnce() {
+	storageAdapter := adapter.NewRateLimitMemoryStorageAdapter()
+	storageAdapter.SetTokenPlan("mno", "enterprise")
+	storageAdapter.SetTokenPlan("pqr", "enterprise")
+	storageAdapter.SetPlan("enterprise", `{"maxRequestsPerSecond":1000}`)
+
+	config := s.getConfig()
+	config.StorageAdapter = storageAdapter
+	config.StoragePlans = true
+	configurePlans(config)
+
+	first, _, err := getTokenRateConfig(s.context, config, "mno")
+	assert.Nil(s.T(), err)
+	second, _, err := getTokenRateConfig(s.context, config, "pqr")
+	assert.Nil(s.T(), err)
+	assert.Same(s.T(), first, second)
+
+	storageAdapter.SetPlan("enterprise", `{"maxRequestsPerSecond":2000}`)
+	changed, _, err := getTokenRateConfig(s.context, config, "mno")
+	assert.Nil(s.T(), err)
+	assert.Equal(s.T(), int64(2000), changed.MaxRequestsPerSecond)
+}
+
+func (s *PlansTestSuite) TestGetTokenRateConfig_MissingPlanIsWarnedOnce() {
+	output := &bytes.Buffer{}
+	storageAdapter := adapter.NewRateLimitMemoryStorageAdapter()
+	storageAdapter.SetTokenPlan("mno", "gone")
+
+	config := &RateLimiterConfig{
+		Token:          &RateLimiterRateConfig{MaxRequestsPerSecond: 20, BlockTimeMilliseconds: 1000},
+		StorageAdapter: storageAdapter,
+		StoragePlans:   true,
+		Logger:         slog.New(slog.NewTextHandler(output, nil)),
+		DisableEnvs:    true,
+	}
+	config = setConfiguration(config)
+
+	for i := 0; i < 3; i++ {
+		rateConfig, _, err := getTokenRateConfig(s.context, config, "mno")
+		assert.Nil(s.T(), err)
+		assert.Equal(s.T(), config.Token, rateConfig)
+	}
+	assert.Equal(s.T(), 1, strings.Count(output.String(), "plan not found"))
+}
+
+func (s *PlansTestSuite) TestValidate_MissingTokenPlan() {
+	config := s.getConfig()
+	config.Token.BlockTimeMilliseconds = 1000
+	(*config.CustomTokens)["abc"].BlockTimeMilliseconds = 1000
+	config.Plans["pro"].BlockTimeMilliseconds = 1000
+
+	assert.EqualError(s.T(), config.Validate(), `tokenPlans.ghi: plan "gone" does not exist`)
+
+	delete(config.TokenPlans, "ghi")
+	assert.Nil(s.T(), config.Validate())
+}
+
+func (s *PlansTestSuite) TestValidate_MissingTokenPlanWithPlansFile() {
+	path := filepath.Join(s.T().TempDir(), "plans.json")
+	os.WriteFile(path, []byte(`{"plans": {"gone": {"maxRequestsPerSecond": 10, "blockTimeMilliseconds": 1000}}}`), 0644)
+
+	config := s.getConfig()
+	config.Token.BlockTimeMilliseconds = 1000
+	(*config.CustomTokens)["abc"].BlockTimeMilliseconds = 1000
+	config.Plans["pro"].BlockTimeMilliseconds = 1000
+	config.PlansFile = path
+	assert.Nil(s.T(), config.Validate())
+
+	configurePlans(config)
+	assert.Nil(s.T(), config.Validate())
+
+	os.WriteFile(path, []byte(`{"plans": {}}`), 0644)
+	config = s.getConfig()
+	config.Token.BlockTimeMilliseconds = 1000
+	(*config.CustomTokens)["abc"].BlockTimeMilliseconds = 1000
+	config.Plans["pro"].BlockTimeMilliseconds = 1000
+	config.PlansFile = path
+	configurePlans(config)
+	assert.EqualError(s.T(), config.Validate(), `tokenPlans.ghi: plan "gone" does not exist`)
+}
+
+func (s *PlansTestSuite) TestSetConfiguration_MissingTokenPlanFromPlansFile() {
+	path := filepath.Join(s.T().TempDir(), "plans.json")
+	os.WriteFile(path, []byte(`{"tokenPlans": {"xyz": "gone"}}`), 0644)
+	output := &bytes.Buffer{}
+
+	config := &RateLimiterConfig{
+		PlansFile:   path,
+		Logger:      slog.New(slog.NewTextHandler(output, nil)),
+		DisableEnvs: true,
+	}
+	config = setConfiguration(config)
+	assert.EqualError(s.T(), config.Validate(), `tokenPlans.xyz: plan "gone" does not exist`)
+	assert.Contains(s.T(), output.String(), `tokenPlans.xyz: plan \"gone\" does not exist`)
+
+	_, err := NewValidatedRateLimiter(s.context, &RateLimiterConfig{PlansFile: path, DisableEnvs: true})
+	assert.ErrorContains(s.T(), err, `tokenPlans.xyz: plan "gone" does not exist`)
+}
+
+func (s *PlansTestSuite) TestConfigurePlans() {
+	path := filepath.Join(s.T().TempDir(), "plans.json")
+	os.WriteFile(path, []byte(`{
+		"plans": {"free": {"maxRequestsPerSecond": 10}, "pro": {"maxRequestsPerSecond": 50}, "empty": null},
+		"tokenPlans": {"abc": "free", "def": "free"}
+	}`), 0644)
+
+	os.Setenv(envPlansFile, path)
+	os.Setenv(envStoragePlans, "true")
+
+	config := s.getConfig()
+	configurePlans(config)
+
+	assert.True(s.T(), config.StoragePlans)
+	assert.Equal(s.T(), int64(10), config.Plans["free"].MaxRequestsPerSecond)
+	assert.Equal(s.T(), int64(100), config.Plans["pro"].MaxRequestsPerSecond)
+	assert.NotContains(s.T(), config.Plans, "empty")
+	assert.Equal(s.T(), map[string]string{"abc": "pro", "def": "pro", "ghi": "gone"}, config.TokenPlans)
+}
+
+func (s *PlansTestSuite) TestConfigurePlans_InvalidFile() {
+	path := filepath.Join(s.T().TempDir(), "plans.json")
+	os.WriteFile(path, []byte(`{"plans": [`), 0644)
+
+	config := s.getConfig()
+	config.PlansFile = path
+	configurePlans(config)
+	assert.Len(s.T(), config.Plans, 1)
+
+	config.PlansFile = filepath.Join(s.T().TempDir(), "missing.json")
+	configurePlans(config)
+	assert.Len(s.T(), config.Plans, 1)
+}
+
+func (s *PlansTestSuite) TestConfigurePlans_Empty() {
+	config := &RateLimiterConfig{}
+	configurePlans(config)
+	assert.NotNil(s.T(), config.Plans)
+	assert.NotNil(s.T(), config.TokenPlans)
+}
@@ -0,0 +1,67 @@
+package ratelimiter
+
+import "net/netip"
+
+// prefixTrie is a binary trie of IPv4 and IPv6 prefixes. Checking an address
+// walks at most one node per bit, no matter how many prefixes it holds.
+type prefixTrie struct {
+	ipv4 *prefixTrieNode
+	ipv6 *prefixTrieNode
+}
+
+type prefixTrieNode struct {
+	children [2]*prefixTrieNode
+	terminal bool
+}
+
+func newPrefixTrie() *prefixTrie {
+	return &prefixTrie{ipv4: &prefixTrieNode{}, ipv6: &prefixTrieNode{}}
+}
+
+func (t *prefixTrie) insert(prefix netip.Prefix) {
+	address := prefix.Addr().Unmap()
+	bits := prefix.Bits()
+	if prefix.Addr().Is4In6() {
+		bits = max(0, bits-96)
+	}
+
+	node := t.root(address)
+	bytes := address.AsSlice()
+	for i := 0; i < bits; i++ {
+		bit := getBit(bytes, i)
+		if node.children[bit] == nil {
+			node.children[bit] = &prefixTrieNode{}
+		}
+		node = node.children[bit]
+	}
+	node.terminal = true
+}
+
+// contains tells whether any prefix of the trie contains the address.
+func (t *prefixTrie) contains(address netip.Addr) bool {
+	address = address.Unmap()
+
+	node := t.root(address)
+	bytes := address.AsSlice()
+	for i := 0; node != nil; i++ {
+		if node.terminal {
+			return true
+		}
+		if i == len(bytes)*8 {
+			return false
+		}
+		node = node.children[getBit(bytes, i)]
+	}
+	return false
+}
+
+func (t *prefixTrie) root(address netip.Addr) *prefixTrieNode {
+	if address.Is4() {
+		return t.ipv4
+	}
+	return t.ipv6
+}
+
+func getBit(bytes []byte, i int) int {
+	return int(bytes[i/8]>>(7-i%8)) & 1
+}
@@ -0,0 +1,55 @@
+package ratelimiter
+
+import (
+	"net/netip"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/suite"
+)
+
+type PrefixTrieTestSuite struct {
+	suite.Suite
+}
+
+func TestPrefixTrieTestSuite(t *testing.T) {
+	suite.Run(t, new(PrefixTrieTestSuite))
+}
+
+func (s *PrefixTrieTestSuite) TestContains() {
+	trie := newPrefixTrie()
+	trie.insert(netip.MustParsePrefix("10.0.0.0/8"))
+	trie.insert(netip.MustParsePrefix("192.168.1.7/32"))
+	trie.insert(netip.MustParsePrefix("2001:db8::/32"))
+
+	assert.True(s.T(), trie.contains(netip.MustParseAddr("10.20.30.40")))
+	assert.True(s.T(), trie.contains(netip.MustParseAddr("192.168.1.7")))
+	assert.True(s.T(), trie.contains(netip.MustParseAddr("::ffff:10.0.0.1")))
+	assert.True(s.T(), trie.contains(netip.MustParseAddr("2001:db8:1::1")))
+	assert.False(s.T(), trie.contains(netip.MustParseAddr("11.0.0.1")))
+	assert.False(s.T(), trie.contains(netip.MustParseAddr("192.168.1.8")))
+	assert.False(s.T(), trie.contains(netip.MustParseAddr("2001:db9::1")))
+}
+
+func (s *PrefixTrieTestSuite) TestContains_FamiliesAreSeparated() {
+	trie := newPrefixTrie()
+	trie.insert(netip.MustParsePrefix("0.0.0.0/0"))
+
+	assert.True(s.T(), trie.contains(netip.MustParseAddr("203.0.113.7")))
+	assert.False(s.T(), trie.contains(netip.MustParseAddr("2001:db8::1")))
+}
+
+func (s *PrefixTrieTestSuite) TestContains_IPv4MappedPrefix() {
+	trie := newPrefixTrie()
+	trie.insert(netip.MustParsePrefix("::ffff:10.0.0.0/104"))
+
+	assert.True(s.T(), trie.contains(netip.MustParseAddr("10.1.2.3")))
+	assert.False(s.T(), trie.contains(netip.MustParseAddr("11.1.2.3")))
+}
+
+func (s *PrefixTrieTestSuite) TestContains_Empty() {
+	trie := newPrefixTrie()
+
+	assert.False(s.T(), trie.contains(netip.MustParseAddr("203.0.113.7")))
+	assert.False(s.T(), trie.contains(netip.Addr{}))
+}
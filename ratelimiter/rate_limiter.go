@@ -2,40 +2,287 @@ package ratelimiter
 
 import (
 	"context"
+	"fmt"
+	"log/slog"
 	"time"
+
+	"github.com/arfurlaneto/goexpert-challenge-rate-limiter/ratelimiter/adapter"
 )
 
-func checkRateLimit(ctx context.Context, keyType string, key string, config *RateLimiterConfig, rateConfig *RateLimiterRateConfig) (*time.Time, error) {
+// rateLimitDecision is the outcome of checkRateLimit. When the request is
+// blocked, limit is the limit that tripped. Otherwise it is the limit with the
+// fewest requests left, with remaining requests until reset.
+type rateLimitDecision struct {
+	block     *time.Time
+	limit     *RateLimiterRateConfig
+	remaining int64
+	reset     time.Time
+}
+
+func checkRateLimit(ctx context.Context, keyType string, key string, config *RateLimiterConfig, rateConfig *RateLimiterRateConfig) (*rateLimitDecision, error) {
 	if key == "" {
-		return nil, nil
+		return &rateLimitDecision{}, nil
 	}
 
-	block, err := config.StorageAdapter.GetBlock(ctx, keyType, key)
-	if err != nil {
-		return nil, err
+	ctx, span := startCheckSpan(ctx, config, keyType)
+	decision, err := checkRateLimitLimits(ctx, keyType, key, config, rateConfig)
+	endCheckSpan(span, decision, err)
+	return decision, err
+}
+
+// checkRateLimitLimits checks all the limits of a key, stopping at the first
+// one that blocks it. The limits that allowed the request before are given
+// back the request, if the storage adapter supports it, so a rejected request
+// uses no quota.
+func checkRateLimitLimits(ctx context.Context, keyType string, key string, config *RateLimiterConfig, rateConfig *RateLimiterRateConfig) (*rateLimitDecision, error) {
+	limits := rateConfig.GetLimits()
+
+	atomicStorageAdapter, ok := config.StorageAdapter.(adapter.RateLimitAtomicStorageAdapter)
+	if ok && isSlidingWindowOnly(limits) {
+		return checkRateLimitAtomically(ctx, keyType, key, config, rateConfig, atomicStorageAdapter)
 	}
 
-	if block == nil {
-		success, count, err := config.StorageAdapter.IncrementAccesses(ctx, keyType, key, rateConfig.MaxRequestsPerSecond)
+	for _, limit := range limits {
+		limitKeyType := getLimitKeyType(keyType, rateConfig, limit)
+
+		block, err := storageGetBlock(ctx, config, limitKeyType, key)
 		if err != nil {
 			return nil, err
 		}
 
-		if success {
-			DebugPrintf(config, "%d of %d (%dms if blocked)", keyType, key, count, rateConfig.MaxRequestsPerSecond, rateConfig.BlockTimeMilliseconds)
-		} else {
-			DebugPrintf(config, "adding a block of %dms", keyType, key, rateConfig.BlockTimeMilliseconds)
-			block, err = config.StorageAdapter.AddBlock(ctx, keyType, key, rateConfig.BlockTimeMilliseconds)
+		if block != nil {
+			return newBlockedDecision(block, limit), nil
+		}
+	}
+
+	decision := &rateLimitDecision{}
+	for i, limit := range limits {
+		limitKeyType := getLimitKeyType(keyType, rateConfig, limit)
+
+		success, remaining, resetAfter, err := consumeRateLimit(ctx, limitKeyType, key, config, limit)
+		if err != nil {
+			refundRateLimits(ctx, keyType, key, config, rateConfig, limits[:i])
+			return nil, err
+		}
+
+		if !success {
+			refundRateLimits(ctx, keyType, key, config, rateConfig, limits[:i])
+			logKey(ctx, config, slog.LevelDebug, "limit reached, adding a block", keyType, key, "limit", limit.GetName(), "block_ms", limit.BlockTimeMilliseconds)
+			block, err := storageAddBlock(ctx, config, limitKeyType, key, limit.BlockTimeMilliseconds)
 			if err != nil {
 				return nil, err
 			}
+
+			return newBlockedDecision(block, limit), nil
 		}
+
+		decision.update(limit, remaining, resetAfter)
 	}
 
-	if block != nil {
-		DebugPrintf(config, "block time %.2f seconds", keyType, key, GetRemainingBlockTime(block))
-		return block, nil
+	return decision, nil
+}
+
+// refundRateLimit gives a request allowed by checkRateLimit back to all the
+// limits of a key.
+func refundRateLimit(ctx context.Context, keyType string, key string, config *RateLimiterConfig, rateConfig *RateLimiterRateConfig) {
+	if key == "" {
+		return
+	}
+	refundRateLimits(ctx, keyType, key, config, rateConfig, rateConfig.GetLimits())
+}
+
+// refundRateLimits gives the request back to limits that allowed it, when
+// the storage adapter supports it. Failures are only logged, as the request
+// is rejected anyway.
+func refundRateLimits(ctx context.Context, keyType string, key string, config *RateLimiterConfig, rateConfig *RateLimiterRateConfig, limits []*RateLimiterRateConfig) {
+	refundStorageAdapter, ok := config.StorageAdapter.(adapter.RateLimitRefundStorageAdapter)
+	if !ok {
+		return
+	}
+
+	for _, limit := range limits {
+		limitKeyType := getLimitKeyType(keyType, rateConfig, limit)
+
+		var err error
+		switch limit.GetAlgorithm() {
+		case AlgorithmTokenBucket:
+			err = storageRefundBucketToken(ctx, config, refundStorageAdapter, limitKeyType, key, limit.GetBucketCapacity())
+		case AlgorithmGCRA:
+			err = storageRefundGCRA(ctx, config, refundStorageAdapter, limitKeyType, key, limit.MaxRequestsPerSecond, limit.GetWindowMilliseconds())
+		default:
+			err = storageRefundAccess(ctx, config, refundStorageAdapter, limitKeyType, key)
+		}
+		if err != nil {
+			logKey(ctx, config, slog.LevelWarn, "could not give the request back to a limit", keyType, key, "limit", limit.GetName(), "error", err)
+		}
+	}
+}
+
+func newBlockedDecision(block *time.Time, limit *RateLimiterRateConfig) *rateLimitDecision {
+	return &rateLimitDecision{block: block, limit: limit, remaining: 0, reset: *block}
+}
+
+// update keeps the limit with the fewest requests left.
+func (d *rateLimitDecision) update(limit *RateLimiterRateConfig, remaining int64, resetAfter time.Duration) {
+	if d.limit == nil || remaining < d.remaining {
+		d.limit = limit
+		d.remaining = max(0, remaining)
+		d.reset = time.Now().Add(resetAfter)
+	}
+}
+
+// checkRateLimitAtomically lets the storage adapter take the whole decision in
+// a single operation, so limits are exact even with concurrent instances.
+func checkRateLimitAtomically(ctx context.Context, keyType string, key string, config *RateLimiterConfig, rateConfig *RateLimiterRateConfig, atomicStorageAdapter adapter.RateLimitAtomicStorageAdapter) (*rateLimitDecision, error) {
+	limits := rateConfig.GetLimits()
+
+	accessLimits := []adapter.AccessLimit{}
+	for _, limit := range limits {
+		accessLimits = append(accessLimits, adapter.AccessLimit{
+			KeyType:            getLimitKeyType(keyType, rateConfig, limit),
+			MaxAccesses:        limit.MaxRequestsPerSecond,
+			WindowMilliseconds: limit.GetWindowMilliseconds(),
+			BlockMilliseconds:  limit.BlockTimeMilliseconds,
+		})
+	}
+
+	result, err := storageCheckAccesses(ctx, config, atomicStorageAdapter, key, accessLimits)
+	if err != nil {
+		return nil, err
 	}
 
-	return nil, nil
+	if result.BlockedLimit >= 0 {
+		return newBlockedDecision(result.Block, limits[result.BlockedLimit]), nil
+	}
+
+	decision := &rateLimitDecision{}
+	for i, limit := range limits {
+		logKey(ctx, config, slog.LevelDebug, "request counted", keyType, key, "limit", limit.GetName(), "count", result.Counts[i], "max", limit.MaxRequestsPerSecond, "window_ms", limit.GetWindowMilliseconds(), "block_ms", limit.BlockTimeMilliseconds)
+		decision.update(limit, limit.MaxRequestsPerSecond-result.Counts[i], time.Duration(limit.GetWindowMilliseconds())*time.Millisecond)
+	}
+
+	return decision, nil
+}
+
+func isSlidingWindowOnly(limits []*RateLimiterRateConfig) bool {
+	for _, limit := range limits {
+		if limit.GetAlgorithm() != AlgorithmSlidingWindow {
+			return false
+		}
+	}
+	return true
+}
+
+// getLimitKeyType keeps the key type of the main limit and appends the limit
+// name for extra limits, so that each limit has its own counters and blocks.
+func getLimitKeyType(keyType string, rateConfig *RateLimiterRateConfig, limit *RateLimiterRateConfig) string {
+	if limit == rateConfig {
+		return keyType
+	}
+	return fmt.Sprintf("%s:%s", keyType, limit.GetName())
+}
+
+// consumeRateLimit returns whether the request is allowed, how many requests
+// are left and how long until the limit is fully available again.
+func consumeRateLimit(ctx context.Context, keyType string, key string, config *RateLimiterConfig, rateConfig *RateLimiterRateConfig) (bool, int64, time.Duration, error) {
+	switch rateConfig.GetAlgorithm() {
+	case AlgorithmSlidingWindow:
+		windowMilliseconds := rateConfig.GetWindowMilliseconds()
+		success, count, err := incrementAccesses(ctx, config, keyType, key, rateConfig.MaxRequestsPerSecond, windowMilliseconds)
+		if err != nil {
+			return false, 0, 0, err
+		}
+		if success {
+			logKey(ctx, config, slog.LevelDebug, "request counted", keyType, key, "limit", rateConfig.GetName(), "count", count, "max", rateConfig.MaxRequestsPerSecond, "window_ms", windowMilliseconds, "block_ms", rateConfig.BlockTimeMilliseconds)
+		}
+		return success, rateConfig.MaxRequestsPerSecond - count, time.Duration(windowMilliseconds) * time.Millisecond, nil
+	case AlgorithmTokenBucket:
+		bucketStorageAdapter, ok := config.StorageAdapter.(adapter.RateLimitBucketStorageAdapter)
+		if !ok {
+			return false, 0, 0, newUnsupportedAlgorithmError(AlgorithmTokenBucket)
+		}
+		capacity := rateConfig.GetBucketCapacity()
+		refillRatePerSecond := rateConfig.GetRefillRatePerSecond()
+		success, remaining, err := storageConsumeBucketToken(ctx, config, bucketStorageAdapter, keyType, key, capacity, refillRatePerSecond)
+		if err != nil {
+			return false, 0, 0, err
+		}
+		if success {
+			logKey(ctx, config, slog.LevelDebug, "request counted", keyType, key, "limit", rateConfig.GetName(), "remaining", remaining, "capacity", capacity, "block_ms", rateConfig.BlockTimeMilliseconds)
+		}
+		return success, remaining, time.Duration(capacity-remaining) * time.Second / time.Duration(refillRatePerSecond), nil
+	case AlgorithmGCRA:
+		gcraStorageAdapter, ok := config.StorageAdapter.(adapter.RateLimitGCRAStorageAdapter)
+		if !ok {
+			return false, 0, 0, newUnsupportedAlgorithmError(AlgorithmGCRA)
+		}
+		windowMilliseconds := rateConfig.GetWindowMilliseconds()
+		success, remaining, err := storageConsumeGCRA(ctx, config, gcraStorageAdapter, keyType, key, rateConfig.MaxRequestsPerSecond, windowMilliseconds)
+		if err != nil {
+			return false, 0, 0, err
+		}
+		if success {
+			logKey(ctx, config, slog.LevelDebug, "request counted", keyType, key, "limit", rateConfig.GetName(), "remaining", remaining, "max", rateConfig.MaxRequestsPerSecond, "window_ms", windowMilliseconds, "block_ms", rateConfig.BlockTimeMilliseconds)
+		}
+		return success, remaining, time.Duration(float64(rateConfig.MaxRequestsPerSecond-remaining) * float64(time.Duration(windowMilliseconds)*time.Millisecond) / float64(max(1, rateConfig.MaxRequestsPerSecond))), nil
+	default:
+		return false, 0, 0, fmt.Errorf("unknown rate limiter algorithm \"%s\"", rateConfig.Algorithm)
+	}
+}
+
+// incrementAccesses counts a sliding window access. Windows other than the
+// default one need a storage adapter implementing
+// adapter.RateLimitWindowStorageAdapter.
+func incrementAccesses(ctx context.Context, config *RateLimiterConfig, keyType string, key string, maxAccesses int64, windowMilliseconds int64) (bool, int64, error) {
+	if windowMilliseconds == defaultWindowMilliseconds {
+		return storageIncrementAccesses(ctx, config, keyType, key, maxAccesses)
+	}
+
+	windowStorageAdapter, ok := config.StorageAdapter.(adapter.RateLimitWindowStorageAdapter)
+	if !ok {
+		return false, 0, newUnsupportedWindowError(windowMilliseconds)
+	}
+	return storageIncrementWindowAccesses(ctx, config, windowStorageAdapter, keyType, key, maxAccesses, windowMilliseconds)
+}
+
+// newUnsupportedWindowError is returned for sliding windows other than the
+// default one when the storage adapter does not support them.
+func newUnsupportedWindowError(windowMilliseconds int64) error {
+	return fmt.Errorf("the storage adapter does not support windows of %d milliseconds, only of %d", windowMilliseconds, defaultWindowMilliseconds)
+}
+
+// isWindowSupported returns whether the storage adapter can count the
+// accesses of a sliding window limit. Atomic storage adapters take the window
+// of each limit.
+func isWindowSupported(storageAdapter adapter.RateLimitStorageAdapter, limit *RateLimiterRateConfig) bool {
+	if limit.GetAlgorithm() != AlgorithmSlidingWindow || limit.GetWindowMilliseconds() == defaultWindowMilliseconds {
+		return true
+	}
+	switch storageAdapter.(type) {
+	case adapter.RateLimitWindowStorageAdapter, adapter.RateLimitAtomicStorageAdapter:
+		return true
+	default:
+		return false
+	}
+}
+
+// newUnsupportedAlgorithmError is returned for limits whose algorithm needs an
+// optional interface the storage adapter does not implement.
+func newUnsupportedAlgorithmError(algorithm string) error {
+	return fmt.Errorf("the storage adapter does not support the %s algorithm", algorithm)
+}
+
+// isAlgorithmSupported returns whether the storage adapter implements the
+// optional interface the algorithm needs.
+func isAlgorithmSupported(storageAdapter adapter.RateLimitStorageAdapter, algorithm string) bool {
+	switch algorithm {
+	case AlgorithmTokenBucket:
+		_, ok := storageAdapter.(adapter.RateLimitBucketStorageAdapter)
+		return ok
+	case AlgorithmGCRA:
+		_, ok := storageAdapter.(adapter.RateLimitGCRAStorageAdapter)
+		return ok
+	default:
+		return true
+	}
 }
@@ -6,6 +6,7 @@ import (
 	"testing"
 	"time"
 
+	"github.com/arfurlaneto/goexpert-challenge-rate-limiter/ratelimiter/adapter"
 	"github.com/arfurlaneto/goexpert-challenge-rate-limiter/ratelimiter/mocks"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/suite"
@@ -41,16 +42,16 @@ func (s *RateLimiterTestSuite) TestCheckRateLimit_AccessAllowed() {
 	}
 
 	s.storageAdapterMock.EXPECT().
-		GetBlock(context, keyType, key).Return(nil, nil).Times(1)
+		GetBlock(gomock.Any(), keyType, key).Return(nil, nil).Times(1)
 
 	s.storageAdapterMock.EXPECT().
-		IncrementAccesses(context, keyType, key, gomock.Any()).Return(true, int64(1), nil).Times(1)
+		IncrementAccesses(gomock.Any(), keyType, key, gomock.Any()).Return(true, int64(1), nil).Times(1)
 
 	config.StorageAdapter = s.storageAdapterMock
 
-	returnedBlock, err := checkRateLimit(context, keyType, key, config, config.IP)
+	decision, err := checkRateLimit(context, keyType, key, config, config.IP)
 	assert.Nil(s.T(), err)
-	assert.Nil(s.T(), returnedBlock)
+	assert.Nil(s.T(), decision.block)
 }
 
 func (s *RateLimiterTestSuite) TestCheckRateLimit_AccessDenied() {
@@ -66,19 +67,19 @@ func (s *RateLimiterTestSuite) TestCheckRateLimit_AccessDenied() {
 	block := time.Now().Add(time.Millisecond * 100)
 
 	s.storageAdapterMock.EXPECT().
-		GetBlock(context, keyType, key).Return(nil, nil).Times(1)
+		GetBlock(gomock.Any(), keyType, key).Return(nil, nil).Times(1)
 
 	s.storageAdapterMock.EXPECT().
-		IncrementAccesses(context, keyType, key, gomock.Any()).Return(false, int64(10), nil).Times(1)
+		IncrementAccesses(gomock.Any(), keyType, key, gomock.Any()).Return(false, int64(10), nil).Times(1)
 
 	s.storageAdapterMock.EXPECT().
-		AddBlock(context, keyType, key, config.IP.BlockTimeMilliseconds).Return(&block, nil).Times(1)
+		AddBlock(gomock.Any(), keyType, key, config.IP.BlockTimeMilliseconds).Return(&block, nil).Times(1)
 
 	config.StorageAdapter = s.storageAdapterMock
 
-	returnedBlock, err := checkRateLimit(context, keyType, key, config, config.IP)
+	decision, err := checkRateLimit(context, keyType, key, config, config.IP)
 	assert.Nil(s.T(), err)
-	assert.Equal(s.T(), block, *returnedBlock)
+	assert.Equal(s.T(), block, *decision.block)
 }
 
 func (s *RateLimiterTestSuite) TestCheckRateLimit_AlreadyBlocked() {
@@ -94,13 +95,13 @@ func (s *RateLimiterTestSuite) TestCheckRateLimit_AlreadyBlocked() {
 	block := time.Now().Add(time.Millisecond * 100)
 
 	s.storageAdapterMock.EXPECT().
-		GetBlock(context, keyType, key).Return(&block, nil).Times(1)
+		GetBlock(gomock.Any(), keyType, key).Return(&block, nil).Times(1)
 
 	config.StorageAdapter = s.storageAdapterMock
 
-	returnedBlock, err := checkRateLimit(context, keyType, key, config, config.IP)
+	decision, err := checkRateLimit(context, keyType, key, config, config.IP)
 	assert.Nil(s.T(), err)
-	assert.Equal(s.T(), block, *returnedBlock)
+	assert.Equal(s.T(), block, *decision.block)
 }
 
 func (s *RateLimiterTestSuite) TestCheckRateLimit_EmptyKey() {
@@ -116,9 +117,9 @@ func (s *RateLimiterTestSuite) TestCheckRateLimit_EmptyKey() {
 
 	config.StorageAdapter = s.storageAdapterMock
 
-	returnedBlock, err := checkRateLimit(context, keyType, key, config, config.IP)
+	decision, err := checkRateLimit(context, keyType, key, config, config.IP)
 	assert.Nil(s.T(), err)
-	assert.Nil(s.T(), returnedBlock)
+	assert.Nil(s.T(), decision.block)
 }
 
 func (s *RateLimiterTestSuite) TestCheckRateLimit_GetBlockError() {
@@ -133,13 +134,13 @@ func (s *RateLimiterTestSuite) TestCheckRateLimit_GetBlockError() {
 	}
 
 	s.storageAdapterMock.EXPECT().
-		GetBlock(context, keyType, key).Return(nil, errors.New("error")).Times(1)
+		GetBlock(gomock.Any(), keyType, key).Return(nil, errors.New("error")).Times(1)
 
 	config.StorageAdapter = s.storageAdapterMock
 
-	returnedBlock, err := checkRateLimit(context, keyType, key, config, config.IP)
+	decision, err := checkRateLimit(context, keyType, key, config, config.IP)
 	assert.NotNil(s.T(), err)
-	assert.Nil(s.T(), returnedBlock)
+	assert.Nil(s.T(), decision)
 }
 
 func (s *RateLimiterTestSuite) TestCheckRateLimit_IncrementAccessesError() {
@@ -154,16 +155,16 @@ func (s *RateLimiterTestSuite) TestCheckRateLimit_IncrementAccessesError() {
 	}
 
 	s.storageAdapterMock.EXPECT().
-		GetBlock(context, keyType, key).Return(nil, nil).Times(1)
+		GetBlock(gomock.Any(), keyType, key).Return(nil, nil).Times(1)
 
 	s.storageAdapterMock.EXPECT().
-		IncrementAccesses(context, keyType, key, gomock.Any()).Return(false, int64(1), errors.New("error")).Times(1)
+		IncrementAccesses(gomock.Any(), keyType, key, gomock.Any()).Return(false, int64(1), errors.New("error")).Times(1)
 
 	config.StorageAdapter = s.storageAdapterMock
 
-	returnedBlock, err := checkRateLimit(context, keyType, key, config, config.IP)
+	decision, err := checkRateLimit(context, keyType, key, config, config.IP)
 	assert.NotNil(s.T(), err)
-	assert.Nil(s.T(), returnedBlock)
+	assert.Nil(s.T(), decision)
 }
 
 func (s *RateLimiterTestSuite) TestCheckRateLimit_AddBlockError() {
@@ -178,17 +179,627 @@ func (s *RateLimiterTestSuite) TestCheckRateLimit_AddBlockError() {
 	}
 
 	s.storageAdapterMock.EXPECT().
-		GetBlock(context, keyType, key).Return(nil, nil).Times(1)
+		GetBlock(gomock.Any(), keyType, key).Return(nil, nil).Times(1)
 
 	s.storageAdapterMock.EXPECT().
-		IncrementAccesses(context, keyType, key, gomock.Any()).Return(false, int64(10), nil).Times(1)
+		IncrementAccesses(gomock.Any(), keyType, key, gomock.Any()).Return(false, int64(10), nil).Times(1)
 
 	s.storageAdapterMock.EXPECT().
-		AddBlock(context, keyType, key, config.IP.BlockTimeMilliseconds).Return(nil, errors.New("error")).Times(1)
+		AddBlock(gomock.Any(), keyType, key, config.IP.BlockTimeMilliseconds).Return(nil, errors.New("error")).Times(1)
 
 	config.StorageAdapter = s.storageAdapterMock
 
-	returnedBlock, err := checkRateLimit(context, keyType, key, config, config.IP)
+	decision, err := checkRateLimit(context, keyType, key, config, config.IP)
 	assert.NotNil(s.T(), err)
-	assert.Nil(s.T(), returnedBlock)
+	assert.Nil(s.T(), decision)
+}
+
+func (s *RateLimiterTestSuite) TestCheckRateLimit_TokenBucketAllowed() {
+	storageAdapterMock := mocks.NewMockRateLimitBucketStorageAdapter(s.controller)
+	context := s.context
+	keyType := "IP"
+	key := "127.0.0.1"
+	config := &RateLimiterConfig{
+		IP: &RateLimiterRateConfig{
+			MaxRequestsPerSecond:  10,
+			BlockTimeMilliseconds: 100,
+			Algorithm:             AlgorithmTokenBucket,
+			BucketCapacity:        50,
+		},
+	}
+
+	storageAdapterMock.EXPECT().
+		GetBlock(gomock.Any(), keyType, key).Return(nil, nil).Times(1)
+
+	storageAdapterMock.EXPECT().
+		ConsumeBucketToken(gomock.Any(), keyType, key, int64(50), int64(10)).Return(true, int64(49), nil).Times(1)
+
+	config.StorageAdapter = storageAdapterMock
+
+	decision, err := checkRateLimit(context, keyType, key, config, config.IP)
+	assert.Nil(s.T(), err)
+	assert.Nil(s.T(), decision.block)
+}
+
+func (s *RateLimiterTestSuite) TestCheckRateLimit_TokenBucketDenied() {
+	storageAdapterMock := mocks.NewMockRateLimitBucketStorageAdapter(s.controller)
+	context := s.context
+	keyType := "IP"
+	key := "127.0.0.1"
+	config := &RateLimiterConfig{
+		IP: &RateLimiterRateConfig{
+			MaxRequestsPerSecond:  10,
+			BlockTimeMilliseconds: 100,
+			Algorithm:             AlgorithmTokenBucket,
+			BucketCapacity:        50,
+			RefillRatePerSecond:   5,
+		},
+	}
+	block := time.Now().Add(time.Millisecond * 100)
+
+	storageAdapterMock.EXPECT().
+		GetBlock(gomock.Any(), keyType, key).Return(nil, nil).Times(1)
+
+	storageAdapterMock.EXPECT().
+		ConsumeBucketToken(gomock.Any(), keyType, key, int64(50), int64(5)).Return(false, int64(0), nil).Times(1)
+
+	storageAdapterMock.EXPECT().
+		AddBlock(gomock.Any(), keyType, key, config.IP.BlockTimeMilliseconds).Return(&block, nil).Times(1)
+
+	config.StorageAdapter = storageAdapterMock
+
+	decision, err := checkRateLimit(context, keyType, key, config, config.IP)
+	assert.Nil(s.T(), err)
+	assert.Equal(s.T(), block, *decision.block)
+}
+
+func (s *RateLimiterTestSuite) TestCheckRateLimit_TokenBucketUnsupported() {
+	context := s.context
+	keyType := "IP"
+	key := "127.0.0.1"
+	config := &RateLimiterConfig{
+		IP: &RateLimiterRateConfig{
+			MaxRequestsPerSecond:  10,
+			BlockTimeMilliseconds: 100,
+			Algorithm:             AlgorithmTokenBucket,
+		},
+	}
+
+	s.storageAdapterMock.EXPECT().
+		GetBlock(gomock.Any(), keyType, key).Return(nil, nil).Times(1)
+
+	config.StorageAdapter = s.storageAdapterMock
+
+	decision, err := checkRateLimit(context, keyType, key, config, config.IP)
+	assert.EqualError(s.T(), err, "the storage adapter does not support the token_bucket algorithm")
+	assert.Nil(s.T(), decision)
+}
+
+func (s *RateLimiterTestSuite) TestCheckRateLimit_GCRAUnsupported() {
+	context := s.context
+	keyType := "IP"
+	key := "127.0.0.1"
+	config := &RateLimiterConfig{
+		IP: &RateLimiterRateConfig{
+			MaxRequestsPerSecond:  10,
+			BlockTimeMilliseconds: 100,
+			Algorithm:             AlgorithmGCRA,
+		},
+	}
+
+	s.storageAdapterMock.EXPECT().
+		GetBlock(gomock.Any(), keyType, key).Return(nil, nil).Times(1)
+
+	config.StorageAdapter = s.storageAdapterMock
+
+	decision, err := checkRateLimit(context, keyType, key, config, config.IP)
+	assert.EqualError(s.T(), err, "the storage adapter does not support the gcra algorithm")
+	assert.Nil(s.T(), decision)
+}
+
+func (s *RateLimiterTestSuite) TestCheckRateLimit_UnknownAlgorithm() {
+	context := s.context
+	keyType := "IP"
+	key := "127.0.0.1"
+	config := &RateLimiterConfig{
+		IP: &RateLimiterRateConfig{
+			MaxRequestsPerSecond:  10,
+			BlockTimeMilliseconds: 100,
+			Algorithm:             "unknown",
+		},
+	}
+
+	s.storageAdapterMock.EXPECT().
+		GetBlock(gomock.Any(), keyType, key).Return(nil, nil).Times(1)
+
+	config.StorageAdapter = s.storageAdapterMock
+
+	decision, err := checkRateLimit(context, keyType, key, config, config.IP)
+	assert.NotNil(s.T(), err)
+	assert.Nil(s.T(), decision)
+}
+
+func (s *RateLimiterTestSuite) TestCheckRateLimit_GCRAAllowed() {
+	storageAdapterMock := mocks.NewMockRateLimitGCRAStorageAdapter(s.controller)
+	context := s.context
+	keyType := "IP"
+	key := "127.0.0.1"
+	config := &RateLimiterConfig{
+		IP: &RateLimiterRateConfig{
+			MaxRequestsPerSecond:  10,
+			BlockTimeMilliseconds: 100,
+			Algorithm:             AlgorithmGCRA,
+		},
+	}
+
+	storageAdapterMock.EXPECT().
+		GetBlock(gomock.Any(), keyType, key).Return(nil, nil).Times(1)
+
+	storageAdapterMock.EXPECT().
+		ConsumeGCRA(gomock.Any(), keyType, key, int64(10), int64(1000)).Return(true, int64(9), nil).Times(1)
+
+	config.StorageAdapter = storageAdapterMock
+
+	decision, err := checkRateLimit(context, keyType, key, config, config.IP)
+	assert.Nil(s.T(), err)
+	assert.Nil(s.T(), decision.block)
+}
+
+func (s *RateLimiterTestSuite) TestCheckRateLimit_GCRADenied() {
+	storageAdapterMock := mocks.NewMockRateLimitGCRAStorageAdapter(s.controller)
+	context := s.context
+	keyType := "IP"
+	key := "127.0.0.1"
+	config := &RateLimiterConfig{
+		IP: &RateLimiterRateConfig{
+			MaxRequestsPerSecond:  10,
+			BlockTimeMilliseconds: 100,
+			Algorithm:             AlgorithmGCRA,
+		},
+	}
+	block := time.Now().Add(time.Millisecond * 100)
+
+	storageAdapterMock.EXPECT().
+		GetBlock(gomock.Any(), keyType, key).Return(nil, nil).Times(1)
+
+	storageAdapterMock.EXPECT().
+		ConsumeGCRA(gomock.Any(), keyType, key, int64(10), int64(1000)).Return(false, int64(0), nil).Times(1)
+
+	storageAdapterMock.EXPECT().
+		AddBlock(gomock.Any(), keyType, key, config.IP.BlockTimeMilliseconds).Return(&block, nil).Times(1)
+
+	config.StorageAdapter = storageAdapterMock
+
+	decision, err := checkRateLimit(context, keyType, key, config, config.IP)
+	assert.Nil(s.T(), err)
+	assert.Equal(s.T(), block, *decision.block)
+}
+
+func (s *RateLimiterTestSuite) TestCheckRateLimit_CustomWindow() {
+	storageAdapterMock := mocks.NewMockRateLimitWindowStorageAdapter(s.controller)
+	context := s.context
+	keyType := "IP"
+	key := "127.0.0.1"
+	config := &RateLimiterConfig{
+		IP: &RateLimiterRateConfig{
+			MaxRequestsPerSecond:  100,
+			BlockTimeMilliseconds: 100,
+			WindowMilliseconds:    10000,
+		},
+	}
+
+	storageAdapterMock.EXPECT().
+		GetBlock(gomock.Any(), keyType, key).Return(nil, nil).Times(1)
+
+	storageAdapterMock.EXPECT().
+		IncrementWindowAccesses(gomock.Any(), keyType, key, int64(100), int64(10000)).Return(true, int64(1), nil).Times(1)
+
+	config.StorageAdapter = storageAdapterMock
+
+	decision, err := checkRateLimit(context, keyType, key, config, config.IP)
+	assert.Nil(s.T(), err)
+	assert.Nil(s.T(), decision.block)
+}
+
+func (s *RateLimiterTestSuite) TestCheckRateLimit_CustomWindowUnsupported() {
+	context := s.context
+	keyType := "IP"
+	key := "127.0.0.1"
+	config := &RateLimiterConfig{
+		IP: &RateLimiterRateConfig{
+			MaxRequestsPerSecond:  100,
+			BlockTimeMilliseconds: 100,
+			WindowMilliseconds:    10000,
+		},
+	}
+
+	s.storageAdapterMock.EXPECT().
+		GetBlock(gomock.Any(), keyType, key).Return(nil, nil).Times(1)
+
+	config.StorageAdapter = s.storageAdapterMock
+
+	decision, err := checkRateLimit(context, keyType, key, config, config.IP)
+	assert.EqualError(s.T(), err, "the storage adapter does not support windows of 10000 milliseconds, only of 1000")
+	assert.Nil(s.T(), decision)
+}
+
+func (s *RateLimiterTestSuite) TestCheckRateLimit_ExtraLimitDenied() {
+	storageAdapterMock := mocks.NewMockRateLimitWindowStorageAdapter(s.controller)
+	context := s.context
+	keyType := "IP"
+	key := "127.0.0.1"
+	minuteLimit := &RateLimiterRateConfig{
+		Name:                  "minute",
+		MaxRequestsPerSecond:  1000,
+		BlockTimeMilliseconds: 5000,
+		WindowMilliseconds:    60000,
+	}
+	config := &RateLimiterConfig{
+		IP: &RateLimiterRateConfig{
+			MaxRequestsPerSecond:  20,
+			BlockTimeMilliseconds: 100,
+			ExtraLimits:           []*RateLimiterRateConfig{minuteLimit},
+		},
+	}
+	block := time.Now().Add(time.Millisecond * 5000)
+
+	storageAdapterMock.EXPECT().
+		GetBlock(gomock.Any(), keyType, key).Return(nil, nil).Times(1)
+
+	storageAdapterMock.EXPECT().
+		GetBlock(gomock.Any(), "IP:minute", key).Return(nil, nil).Times(1)
+
+	storageAdapterMock.EXPECT().
+		IncrementAccesses(gomock.Any(), keyType, key, int64(20)).Return(true, int64(1), nil).Times(1)
+
+	storageAdapterMock.EXPECT().
+		IncrementWindowAccesses(gomock.Any(), "IP:minute", key, int64(1000), int64(60000)).Return(false, int64(1000), nil).Times(1)
+
+	storageAdapterMock.EXPECT().
+		AddBlock(gomock.Any(), "IP:minute", key, int64(5000)).Return(&block, nil).Times(1)
+
+	config.StorageAdapter = storageAdapterMock
+
+	decision, err := checkRateLimit(context, keyType, key, config, config.IP)
+	assert.Nil(s.T(), err)
+	assert.Equal(s.T(), block, *decision.block)
+	assert.Equal(s.T(), minuteLimit, decision.limit)
+}
+
+func (s *RateLimiterTestSuite) TestCheckRateLimit_ExtraLimitAlreadyBlocked() {
+	context := s.context
+	keyType := "IP"
+	key := "127.0.0.1"
+	minuteLimit := &RateLimiterRateConfig{
+		Name:                  "minute",
+		MaxRequestsPerSecond:  1000,
+		BlockTimeMilliseconds: 5000,
+		WindowMilliseconds:    60000,
+	}
+	config := &RateLimiterConfig{
+		IP: &RateLimiterRateConfig{
+			MaxRequestsPerSecond:  20,
+			BlockTimeMilliseconds: 100,
+			ExtraLimits:           []*RateLimiterRateConfig{minuteLimit},
+		},
+	}
+	block := time.Now().Add(time.Millisecond * 5000)
+
+	s.storageAdapterMock.EXPECT().
+		GetBlock(gomock.Any(), keyType, key).Return(nil, nil).Times(1)
+
+	s.storageAdapterMock.EXPECT().
+		GetBlock(gomock.Any(), "IP:minute", key).Return(&block, nil).Times(1)
+
+	config.StorageAdapter = s.storageAdapterMock
+
+	decision, err := checkRateLimit(context, keyType, key, config, config.IP)
+	assert.Nil(s.T(), err)
+	assert.Equal(s.T(), block, *decision.block)
+	assert.Equal(s.T(), minuteLimit, decision.limit)
+}
+
+func (s *RateLimiterTestSuite) TestCheckRateLimit_ExtraLimitsWithMemoryStorageAdapter() {
+	context := s.context
+	keyType := "IP"
+	key := "127.0.0.1"
+	config := &RateLimiterConfig{
+		IP: &RateLimiterRateConfig{
+			MaxRequestsPerSecond:  20,
+			BlockTimeMilliseconds: 100,
+			ExtraLimits: []*RateLimiterRateConfig{
+				{Name: "minute", MaxRequestsPerSecond: 3, BlockTimeMilliseconds: 5000, WindowMilliseconds: 60000},
+				{Name: "day", MaxRequestsPerSecond: 50000, BlockTimeMilliseconds: 60000, WindowMilliseconds: 86400000},
+			},
+		},
+		StorageAdapter: adapter.NewRateLimitMemoryStorageAdapter(),
+	}
+
+	for i := 0; i < 3; i++ {
+		decision, err := checkRateLimit(context, keyType, key, config, config.IP)
+		assert.Nil(s.T(), err)
+		assert.Nil(s.T(), decision.block)
+	}
+
+	decision, err := checkRateLimit(context, keyType, key, config, config.IP)
+	assert.Nil(s.T(), err)
+	assert.NotNil(s.T(), decision.block)
+	assert.Equal(s.T(), "minute", decision.limit.GetName())
+}
+
+func (s *RateLimiterTestSuite) TestCheckRateLimit_ExtraLimitDeniedRefundsEarlierLimits() {
+	storageAdapterMock := mocks.NewMockRateLimitRefundStorageAdapter(s.controller)
+	context := s.context
+	keyType := "IP"
+	key := "127.0.0.1"
+	burstLimit := &RateLimiterRateConfig{
+		Name:                  "burst",
+		MaxRequestsPerSecond:  5,
+		BlockTimeMilliseconds: 5000,
+	}
+	config := &RateLimiterConfig{
+		IP: &RateLimiterRateConfig{
+			MaxRequestsPerSecond:  20,
+			BlockTimeMilliseconds: 100,
+			ExtraLimits:           []*RateLimiterRateConfig{burstLimit},
+		},
+	}
+	block := time.Now().Add(time.Millisecond * 5000)
+
+	storageAdapterMock.EXPECT().
+		GetBlock(gomock.Any(), keyType, key).Return(nil, nil).Times(1)
+
+	storageAdapterMock.EXPECT().
+		GetBlock(gomock.Any(), "IP:burst", key).Return(nil, nil).Times(1)
+
+	storageAdapterMock.EXPECT().
+		IncrementAccesses(gomock.Any(), keyType, key, int64(20)).Return(true, int64(1), nil).Times(1)
+
+	storageAdapterMock.EXPECT().
+		IncrementAccesses(gomock.Any(), "IP:burst", key, int64(5)).Return(false, int64(5), nil).Times(1)
+
+	storageAdapterMock.EXPECT().
+		RefundAccess(gomock.Any(), keyType, key).Return(nil).Times(1)
+
+	storageAdapterMock.EXPECT().
+		AddBlock(gomock.Any(), "IP:burst", key, int64(5000)).Return(&block, nil).Times(1)
+
+	config.StorageAdapter = storageAdapterMock
+
+	decision, err := checkRateLimit(context, keyType, key, config, config.IP)
+	assert.Nil(s.T(), err)
+	assert.Equal(s.T(), block, *decision.block)
+	assert.Equal(s.T(), burstLimit, decision.limit)
+}
+
+func (s *RateLimiterTestSuite) TestCheckRateLimit_ExtraLimitDeniedRefundsWithMemoryStorageAdapter() {
+	context := s.context
+	keyType := "IP"
+	key := "127.0.0.1"
+	config := &RateLimiterConfig{
+		IP: &RateLimiterRateConfig{
+			MaxRequestsPerSecond:  3,
+			BlockTimeMilliseconds: 100,
+			ExtraLimits: []*RateLimiterRateConfig{
+				{Name: "burst", MaxRequestsPerSecond: 2, BlockTimeMilliseconds: 5000, Algorithm: AlgorithmTokenBucket, BucketCapacity: 2, RefillRatePerSecond: 1},
+			},
+		},
+		StorageAdapter: adapter.NewRateLimitMemoryStorageAdapter(),
+	}
+
+	for i := 0; i < 2; i++ {
+		decision, err := checkRateLimit(context, keyType, key, config, config.IP)
+		assert.Nil(s.T(), err)
+		assert.Nil(s.T(), decision.block)
+	}
+
+	decision, err := checkRateLimit(context, keyType, key, config, config.IP)
+	assert.Nil(s.T(), err)
+	assert.NotNil(s.T(), decision.block)
+	assert.Equal(s.T(), "burst", decision.limit.GetName())
+
+	// the rejected request was given back to the main limit, so it still
+	// allows a third access
+	success, accesses, err := config.StorageAdapter.IncrementAccesses(context, keyType, key, 3)
+	assert.Nil(s.T(), err)
+	assert.True(s.T(), success)
+	assert.Equal(s.T(), int64(3), accesses)
+}
+
+func (s *RateLimiterTestSuite) TestCheckRateLimit_AtomicAccessAllowed() {
+	context := s.context
+	keyType := "IP"
+	key := "127.0.0.1"
+	config := &RateLimiterConfig{
+		IP: &RateLimiterRateConfig{
+			MaxRequestsPerSecond:  10,
+			BlockTimeMilliseconds: 100,
+		},
+	}
+
+	atomicStorageAdapterMock := mocks.NewMockRateLimitAtomicStorageAdapter(s.controller)
+	atomicStorageAdapterMock.EXPECT().
+		CheckAccesses(gomock.Any(), key, []adapter.AccessLimit{
+			{KeyType: keyType, MaxAccesses: 10, WindowMilliseconds: 1000, BlockMilliseconds: 100},
+		}).
+		Return(&adapter.AccessCheckResult{BlockedLimit: -1, Counts: []int64{1}}, nil).Times(1)
+
+	config.StorageAdapter = atomicStorageAdapterMock
+
+	decision, err := checkRateLimit(context, keyType, key, config, config.IP)
+	assert.Nil(s.T(), err)
+	assert.Nil(s.T(), decision.block)
+	assert.Equal(s.T(), config.IP, decision.limit)
+	assert.Equal(s.T(), int64(9), decision.remaining)
+	assert.WithinDuration(s.T(), time.Now().Add(time.Second), decision.reset, 100*time.Millisecond)
+}
+
+func (s *RateLimiterTestSuite) TestCheckRateLimit_AtomicAccessDenied() {
+	context := s.context
+	keyType := "IP"
+	key := "127.0.0.1"
+	minuteLimit := &RateLimiterRateConfig{
+		Name:                  "minute",
+		MaxRequestsPerSecond:  1000,
+		BlockTimeMilliseconds: 5000,
+		WindowMilliseconds:    60000,
+	}
+	config := &RateLimiterConfig{
+		IP: &RateLimiterRateConfig{
+			MaxRequestsPerSecond:  10,
+			BlockTimeMilliseconds: 100,
+			ExtraLimits:           []*RateLimiterRateConfig{minuteLimit},
+		},
+	}
+	block := time.Now().Add(time.Millisecond * 5000)
+
+	atomicStorageAdapterMock := mocks.NewMockRateLimitAtomicStorageAdapter(s.controller)
+	atomicStorageAdapterMock.EXPECT().
+		CheckAccesses(gomock.Any(), key, []adapter.AccessLimit{
+			{KeyType: keyType, MaxAccesses: 10, WindowMilliseconds: 1000, BlockMilliseconds: 100},
+			{KeyType: "IP:minute", MaxAccesses: 1000, WindowMilliseconds: 60000, BlockMilliseconds: 5000},
+		}).
+		Return(&adapter.AccessCheckResult{BlockedLimit: 1, Block: &block, Counts: []int64{0, 0}}, nil).Times(1)
+
+	config.StorageAdapter = atomicStorageAdapterMock
+
+	decision, err := checkRateLimit(context, keyType, key, config, config.IP)
+	assert.Nil(s.T(), err)
+	assert.Equal(s.T(), block, *decision.block)
+	assert.Equal(s.T(), minuteLimit, decision.limit)
+}
+
+func (s *RateLimiterTestSuite) TestCheckRateLimit_AtomicError() {
+	context := s.context
+	keyType := "IP"
+	key := "127.0.0.1"
+	config := &RateLimiterConfig{
+		IP: &RateLimiterRateConfig{
+			MaxRequestsPerSecond:  10,
+			BlockTimeMilliseconds: 100,
+		},
+	}
+
+	atomicStorageAdapterMock := mocks.NewMockRateLimitAtomicStorageAdapter(s.controller)
+	atomicStorageAdapterMock.EXPECT().
+		CheckAccesses(gomock.Any(), key, gomock.Any()).Return(nil, errors.New("error")).Times(1)
+
+	config.StorageAdapter = atomicStorageAdapterMock
+
+	decision, err := checkRateLimit(context, keyType, key, config, config.IP)
+	assert.NotNil(s.T(), err)
+	assert.Nil(s.T(), decision)
+}
+
+// gcraAtomicStorageAdapter supports GCRA and atomic sliding window checks.
+type gcraAtomicStorageAdapter struct {
+	*mocks.MockRateLimitGCRAStorageAdapter
+	atomic *mocks.MockRateLimitAtomicStorageAdapter
+}
+
+func (a *gcraAtomicStorageAdapter) CheckAccesses(ctx context.Context, key string, limits []adapter.AccessLimit) (*adapter.AccessCheckResult, error) {
+	return a.atomic.CheckAccesses(ctx, key, limits)
+}
+
+func (s *RateLimiterTestSuite) TestCheckRateLimit_AtomicNotUsedForOtherAlgorithms() {
+	context := s.context
+	keyType := "IP"
+	key := "127.0.0.1"
+	config := &RateLimiterConfig{
+		IP: &RateLimiterRateConfig{
+			MaxRequestsPerSecond:  10,
+			BlockTimeMilliseconds: 100,
+			Algorithm:             AlgorithmGCRA,
+		},
+	}
+
+	storageAdapterMock := mocks.NewMockRateLimitGCRAStorageAdapter(s.controller)
+	storageAdapterMock.EXPECT().
+		GetBlock(gomock.Any(), keyType, key).Return(nil, nil).Times(1)
+	storageAdapterMock.EXPECT().
+		ConsumeGCRA(gomock.Any(), keyType, key, int64(10), int64(1000)).Return(true, int64(9), nil).Times(1)
+
+	config.StorageAdapter = &gcraAtomicStorageAdapter{storageAdapterMock, mocks.NewMockRateLimitAtomicStorageAdapter(s.controller)}
+
+	decision, err := checkRateLimit(context, keyType, key, config, config.IP)
+	assert.Nil(s.T(), err)
+	assert.Nil(s.T(), decision.block)
+}
+
+func (s *RateLimiterTestSuite) TestCheckRateLimit_RemainingFromLimitWithFewestLeft() {
+	context := s.context
+	keyType := "IP"
+	key := "127.0.0.1"
+	minuteLimit := &RateLimiterRateConfig{
+		Name:                  "minute",
+		MaxRequestsPerSecond:  5,
+		BlockTimeMilliseconds: 5000,
+		WindowMilliseconds:    60000,
+	}
+	config := &RateLimiterConfig{
+		IP: &RateLimiterRateConfig{
+			MaxRequestsPerSecond:  10,
+			BlockTimeMilliseconds: 100,
+			ExtraLimits:           []*RateLimiterRateConfig{minuteLimit},
+		},
+		StorageAdapter: adapter.NewRateLimitMemoryStorageAdapter(),
+	}
+
+	decision, err := checkRateLimit(context, keyType, key, config, config.IP)
+	assert.Nil(s.T(), err)
+	assert.Nil(s.T(), decision.block)
+	assert.Equal(s.T(), minuteLimit, decision.limit)
+	assert.Equal(s.T(), int64(4), decision.remaining)
+	assert.WithinDuration(s.T(), time.Now().Add(time.Minute), decision.reset, 100*time.Millisecond)
+}
+
+func (s *RateLimiterTestSuite) TestCheckRateLimit_RemainingTokenBucket() {
+	storageAdapterMock := mocks.NewMockRateLimitBucketStorageAdapter(s.controller)
+	context := s.context
+	keyType := "IP"
+	key := "127.0.0.1"
+	config := &RateLimiterConfig{
+		IP: &RateLimiterRateConfig{
+			MaxRequestsPerSecond:  10,
+			BlockTimeMilliseconds: 100,
+			Algorithm:             AlgorithmTokenBucket,
+			BucketCapacity:        20,
+			RefillRatePerSecond:   2,
+		},
+	}
+
+	storageAdapterMock.EXPECT().
+		GetBlock(gomock.Any(), keyType, key).Return(nil, nil).Times(1)
+	storageAdapterMock.EXPECT().
+		ConsumeBucketToken(gomock.Any(), keyType, key, int64(20), int64(2)).Return(true, int64(16), nil).Times(1)
+
+	config.StorageAdapter = storageAdapterMock
+
+	decision, err := checkRateLimit(context, keyType, key, config, config.IP)
+	assert.Nil(s.T(), err)
+	assert.Equal(s.T(), int64(16), decision.remaining)
+	assert.WithinDuration(s.T(), time.Now().Add(2*time.Second), decision.reset, 100*time.Millisecond)
+}
+
+func (s *RateLimiterTestSuite) TestCheckRateLimit_BlockedDecisionResetsAtBlock() {
+	context := s.context
+	keyType := "IP"
+	key := "127.0.0.1"
+	config := &RateLimiterConfig{
+		IP: &RateLimiterRateConfig{
+			MaxRequestsPerSecond:  10,
+			BlockTimeMilliseconds: 100,
+		},
+	}
+	block := time.Now().Add(time.Millisecond * 100)
+
+	s.storageAdapterMock.EXPECT().
+		GetBlock(gomock.Any(), keyType, key).Return(&block, nil).Times(1)
+
+	config.StorageAdapter = s.storageAdapterMock
+
+	decision, err := checkRateLimit(context, keyType, key, config, config.IP)
+	assert.Nil(s.T(), err)
+	assert.Equal(s.T(), int64(0), decision.remaining)
+	assert.Equal(s.T(), block, decision.reset)
 }
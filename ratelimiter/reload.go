@@ -0,0 +1,231 @@
+package ratelimiter
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"reflect"
+	"sync"
+	"sync/atomic"
+)
+
+// RateLimiter is a rate limiter middleware whose configuration can be
+// reloaded while it serves requests. Each request uses the configuration
+// that was current when it arrived.
+type RateLimiter struct {
+	config      atomic.Pointer[RateLimiterConfig]
+	reloadMutex sync.Mutex
+}
+
+// NewReloadableRateLimiter creates a rate limiter like NewRateLimiterWithConfig,
+// keeping a handle to reload its configuration.
+func NewReloadableRateLimiter(config *RateLimiterConfig) *RateLimiter {
+	limiter := &RateLimiter{}
+	limiter.config.Store(setConfiguration(config))
+	return limiter
+}
+
+// Handler is the middleware.
+func (l *RateLimiter) Handler(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		serveRateLimited(l.config.Load(), next, checkRateLimit, w, r)
+	})
+}
+
+// GetConfig returns the current configuration. It must not be changed.
+func (l *RateLimiter) GetConfig() *RateLimiterConfig {
+	return l.config.Load()
+}
+
+// Reload replaces the configuration, as NewRateLimiterWithConfig would set it
+// up, and returns what changed. A nil configuration reloads the defaults and
+// envs. The storage adapter is kept, so counters and blocks survive, with its
+// Redis settings, which are not reloaded and only warned about when changed.
+// The response writer, token extractor, token store, metrics, logger and
+// tracer provider are kept too when not set. Invalid configurations are not
+// used and return the validation errors. Tokens in the changes are redacted
+// when either configuration has RedactTokens. The given configuration is not
+// changed.
+func (l *RateLimiter) Reload(config *RateLimiterConfig) ([]string, error) {
+	l.reloadMutex.Lock()
+	defer l.reloadMutex.Unlock()
+
+	current := l.config.Load()
+
+	if config == nil {
+		config = &RateLimiterConfig{}
+	}
+	config = copyConfiguration(config)
+	config.ignoreAllEnvs = current.ignoreAllEnvs && config.DisableEnvs
+
+	redisConfig := config.Redis
+	config.Redis = current.Redis
+	config.StorageAdapter = current.StorageAdapter
+	if config.ResponseWriter == nil {
+		config.ResponseWriter = current.ResponseWriter
+	}
+	if config.TokenExtractor == nil {
+		config.TokenExtractor = current.TokenExtractor
+	}
+	if config.TokenStore == nil {
+		config.TokenStore = current.TokenStore
+	}
+	if config.Metrics == nil {
+		config.Metrics = current.Metrics
+	}
+	if config.Logger == nil {
+		config.Logger = current.Logger
+	}
+	if config.TracerProvider == nil {
+		config.TracerProvider = current.TracerProvider
+	}
+
+	config.reloading = true
+	config = setConfiguration(config)
+	config.reloading = false
+
+	err := config.Validate()
+	if err != nil {
+		return nil, err
+	}
+
+	if redisConfig != nil && !reflect.DeepEqual(redisConfig, current.Redis) {
+		config.GetLogger().Warn("configuration not reloaded, restart to change it", "field", "redis")
+	}
+
+	changes := diffConfigurations(current, config)
+	l.config.Store(config)
+
+	for _, change := range changes {
+		config.GetLogger().Info("configuration reloaded", "change", change)
+	}
+	return changes, nil
+}
+
+// copyConfiguration copies a configuration and the values setConfiguration
+// changes in place: the IP and Token limits and the custom tokens.
+func copyConfiguration(config *RateLimiterConfig) *RateLimiterConfig {
+	copied := *config
+	if config.IP != nil {
+		ip := *config.IP
+		copied.IP = &ip
+	}
+	if config.Token != nil {
+		token := *config.Token
+		copied.Token = &token
+	}
+	if config.CustomTokens != nil {
+		customTokens := make(map[string]*RateLimiterRateConfig, len(*config.CustomTokens))
+		for token, rateConfig := range *config.CustomTokens {
+			customTokens[token] = rateConfig
+		}
+		copied.CustomTokens = &customTokens
+	}
+	return &copied
+}
+
+// diffConfigurations lists the changed fields of two configurations, with
+// their JSON paths, e.g. "tokens.abc.maxRequestsPerSecond: 10 -> 20". With
+// RedactTokens in either configuration, tokens are replaced by their hash, as
+// in the logs.
+func diffConfigurations(current *RateLimiterConfig, config *RateLimiterConfig) []string {
+	redact := current.RedactTokens || config.RedactTokens
+	changes := []string{}
+	diffJSONValues("", toJSONValue(current, redact), toJSONValue(config, redact), &changes)
+	return changes
+}
+
+func toJSONValue(config *RateLimiterConfig, redact bool) any {
+	content, err := json.Marshal(config)
+	if err != nil {
+		return nil
+	}
+
+	var value any
+	json.Unmarshal(content, &value)
+	if redact {
+		redactJSONTokens(value)
+	}
+	return value
+}
+
+// redactJSONTokens replaces the tokens of a configuration JSON value, the keys
+// of tokens and tokenPlans and the items of allowedTokens and deniedTokens,
+// by their hash.
+func redactJSONTokens(value any) {
+	valueMap, ok := value.(map[string]any)
+	if !ok {
+		return
+	}
+
+	for _, field := range []string{"tokens", "tokenPlans"} {
+		tokens, ok := valueMap[field].(map[string]any)
+		if !ok {
+			continue
+		}
+		redacted := map[string]any{}
+		for token, tokenValue := range tokens {
+			redacted[redactToken(token)] = tokenValue
+		}
+		valueMap[field] = redacted
+	}
+
+	for _, field := range []string{"allowedTokens", "deniedTokens"} {
+		tokens, ok := valueMap[field].([]any)
+		if !ok {
+			continue
+		}
+		for i, token := range tokens {
+			if tokenString, ok := token.(string); ok {
+				tokens[i] = redactToken(tokenString)
+			}
+		}
+	}
+}
+
+func diffJSONValues(path string, current any, value any, changes *[]string) {
+	currentMap, currentIsMap := current.(map[string]any)
+	valueMap, valueIsMap := value.(map[string]any)
+
+	if !currentIsMap || !valueIsMap {
+		if !reflect.DeepEqual(current, value) {
+			*changes = append(*changes, fmt.Sprintf("%s: %s -> %s", path, formatJSONValue(current), formatJSONValue(value)))
+		}
+		return
+	}
+
+	keys := map[string]bool{}
+	for key := range currentMap {
+		keys[key] = true
+	}
+	for key := range valueMap {
+		keys[key] = true
+	}
+
+	sortedKeys := getSortedKeys(keys)
+	for _, key := range sortedKeys {
+		keyPath := key
+		if path != "" {
+			keyPath = path + "." + key
+		}
+
+		currentValue, currentOk := currentMap[key]
+		newValue, newOk := valueMap[key]
+		switch {
+		case !currentOk:
+			*changes = append(*changes, fmt.Sprintf("%s: added %s", keyPath, formatJSONValue(newValue)))
+		case !newOk:
+			*changes = append(*changes, fmt.Sprintf("%s: removed", keyPath))
+		default:
+			diffJSONValues(keyPath, currentValue, newValue, changes)
+		}
+	}
+}
+
+func formatJSONValue(value any) string {
+	content, err := json.Marshal(value)
+	if err != nil {
+		return fmt.Sprint(value)
+	}
+	return string(content)
+}
@@ -0,0 +1,176 @@
+package ratelimiter
+
+import (
+	"bytes"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/arfurlaneto/goexpert-challenge-rate-limiter/ratelimiter/adapter"
+	"github.com/arfurlaneto/goexpert-challenge-rate-limiter/ratelimiter/metrics"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/suite"
+	"go.opentelemetry.io/otel/trace/noop"
+)
+
+type ReloadTestSuite struct {
+	suite.Suite
+}
+
+func TestReloadTestSuite(t *testing.T) {
+	suite.Run(t, new(ReloadTestSuite))
+}
+
+func (s *ReloadTestSuite) getConfig(maxRequests int64) *RateLimiterConfig {
+	return &RateLimiterConfig{
+		IP:          &RateLimiterRateConfig{MaxRequestsPerSecond: maxRequests, WindowMilliseconds: 60000, BlockTimeMilliseconds: 60000},
+		Token:       &RateLimiterRateConfig{MaxRequestsPerSecond: 20, BlockTimeMilliseconds: 1000},
+		DisableEnvs: true,
+	}
+}
+
+func (s *ReloadTestSuite) getStatuses(handler http.Handler, remoteAddr string, count int) []int {
+	statuses := []int{}
+	for i := 0; i < count; i++ {
+		request := httptest.NewRequest("GET", "http://testing", nil)
+		request.RemoteAddr = remoteAddr
+		recorder := httptest.NewRecorder()
+		handler.ServeHTTP(recorder, request)
+		statuses = append(statuses, recorder.Result().StatusCode)
+	}
+	return statuses
+}
+
+func (s *ReloadTestSuite) TestReload_KeepsCountersAndBlocks() {
+	limiter := NewReloadableRateLimiter(s.getConfig(2))
+	storageAdapter := limiter.GetConfig().StorageAdapter
+	handler := limiter.Handler(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(200)
+	}))
+
+	assert.Equal(s.T(), []int{200, 200, 429}, s.getStatuses(handler, "192.0.2.1:1234", 3))
+	assert.Equal(s.T(), []int{200}, s.getStatuses(handler, "192.0.2.2:1234", 1))
+
+	changes, err := limiter.Reload(s.getConfig(4))
+	assert.Nil(s.T(), err)
+	assert.Equal(s.T(), []string{"ip.maxRequestsPerSecond: 2 -> 4"}, changes)
+	assert.Equal(s.T(), storageAdapter, limiter.GetConfig().StorageAdapter)
+
+	assert.Equal(s.T(), []int{429}, s.getStatuses(handler, "192.0.2.1:1234", 1))
+	assert.Equal(s.T(), []int{200, 200, 200, 429}, s.getStatuses(handler, "192.0.2.2:1234", 4))
+}
+
+func (s *ReloadTestSuite) TestReload_Invalid() {
+	limiter := NewReloadableRateLimiter(s.getConfig(2))
+	config := limiter.GetConfig()
+
+	changes, err := limiter.Reload(s.getConfig(-1))
+	assert.ErrorContains(s.T(), err, "ip.maxRequestsPerSecond")
+	assert.Nil(s.T(), changes)
+	assert.Equal(s.T(), config, limiter.GetConfig())
+}
+
+func (s *ReloadTestSuite) TestReload_Nil() {
+	storageAdapter := adapter.NewRateLimitMemoryStorageAdapter()
+	config := s.getConfig(2)
+	config.StorageAdapter = storageAdapter
+	config.Metrics = metrics.NewNoopMetrics()
+	config.TracerProvider = noop.NewTracerProvider()
+	limiter := NewReloadableRateLimiter(config)
+
+	_, err := limiter.Reload(nil)
+	assert.Nil(s.T(), err)
+	assert.Equal(s.T(), storageAdapter, limiter.GetConfig().StorageAdapter)
+	assert.Equal(s.T(), config.ResponseWriter, limiter.GetConfig().ResponseWriter)
+	assert.Equal(s.T(), config.Metrics, limiter.GetConfig().Metrics)
+	assert.Equal(s.T(), config.TracerProvider, limiter.GetConfig().TracerProvider)
+	assert.Equal(s.T(), int64(100), limiter.GetConfig().IP.MaxRequestsPerSecond)
+}
+
+func (s *ReloadTestSuite) TestReload_KeepsRedisConfig() {
+	output := &bytes.Buffer{}
+	config := s.getConfig(2)
+	config.Logger = slog.New(slog.NewTextHandler(output, nil))
+	limiter := NewReloadableRateLimiter(config)
+
+	newConfig := s.getConfig(2)
+	newConfig.Redis = &RateLimiterRedisConfig{Addresses: []string{"localhost:6379"}}
+	changes, err := limiter.Reload(newConfig)
+	assert.Nil(s.T(), err)
+	assert.Empty(s.T(), changes)
+	assert.Nil(s.T(), limiter.GetConfig().Redis)
+	assert.Contains(s.T(), output.String(), "configuration not reloaded, restart to change it")
+	assert.Contains(s.T(), output.String(), "field=redis")
+}
+
+func (s *ReloadTestSuite) TestReload_DoesNotChangeConfig() {
+	limiter := NewReloadableRateLimiter(s.getConfig(2))
+
+	newConfig := s.getConfig(4)
+	newConfig.CustomTokens = &map[string]*RateLimiterRateConfig{"abc": nil}
+	_, err := limiter.Reload(newConfig)
+	assert.Nil(s.T(), err)
+
+	assert.Nil(s.T(), newConfig.StorageAdapter)
+	assert.Nil(s.T(), newConfig.ResponseWriter)
+	assert.False(s.T(), newConfig.reloading)
+	assert.Nil(s.T(), (*newConfig.CustomTokens)["abc"])
+	assert.NotSame(s.T(), newConfig, limiter.GetConfig())
+	assert.Equal(s.T(), int64(4), limiter.GetConfig().IP.MaxRequestsPerSecond)
+}
+
+func (s *ReloadTestSuite) TestDiffConfigurations() {
+	current := s.getConfig(2)
+	current.CustomTokens = &map[string]*RateLimiterRateConfig{
+		"abc": {MaxRequestsPerSecond: 10, BlockTimeMilliseconds: 100},
+		"def": {MaxRequestsPerSecond: 10, BlockTimeMilliseconds: 100},
+	}
+
+	config := s.getConfig(2)
+	config.CustomTokens = &map[string]*RateLimiterRateConfig{
+		"abc": {MaxRequestsPerSecond: 20, BlockTimeMilliseconds: 100},
+		"ghi": {MaxRequestsPerSecond: 30, BlockTimeMilliseconds: 100},
+	}
+	config.Rules = []*RateLimiterRule{{ID: "login", Path: "/login"}}
+
+	assert.Equal(s.T(), []string{
+		`rules: null -> [{"id":"login","ip":null,"methods":null,"path":"/login","pathType":"","token":null}]`,
+		"tokens.abc.maxRequestsPerSecond: 10 -> 20",
+		"tokens.def: removed",
+		`tokens.ghi: added {"algorithm":"","blockTimeMilliseconds":100,"bucketCapacity":0,"extraLimits":null,"maxRequestsPerSecond":30,"name":"","refillRatePerSecond":0,"windowMilliseconds":0}`,
+	}, diffConfigurations(current, config))
+
+	assert.Empty(s.T(), diffConfigurations(current, current))
+}
+
+func (s *ReloadTestSuite) TestDiffConfigurations_RedactTokens() {
+	current := s.getConfig(2)
+	current.RedactTokens = true
+	current.CustomTokens = &map[string]*RateLimiterRateConfig{"abc": {MaxRequestsPerSecond: 10, BlockTimeMilliseconds: 100}}
+	current.TokenPlans = map[string]string{"abc": "free"}
+	current.DeniedTokens = []string{"def"}
+
+	config := s.getConfig(2)
+	config.RedactTokens = true
+	config.CustomTokens = &map[string]*RateLimiterRateConfig{"abc": {MaxRequestsPerSecond: 20, BlockTimeMilliseconds: 100}}
+	config.TokenPlans = map[string]string{"abc": "pro"}
+	config.AllowedTokens = []string{"ghi"}
+	config.DeniedTokens = []string{"def", "jkl"}
+
+	abc := getLogToken(config, "abc")
+	assert.Equal(s.T(), []string{
+		fmt.Sprintf(`allowedTokens: null -> ["%s"]`, getLogToken(config, "ghi")),
+		fmt.Sprintf(`deniedTokens: ["%s"] -> ["%s","%s"]`, getLogToken(config, "def"), getLogToken(config, "def"), getLogToken(config, "jkl")),
+		fmt.Sprintf(`tokenPlans.%s: "free" -> "pro"`, abc),
+		fmt.Sprintf("tokens.%s.maxRequestsPerSecond: 10 -> 20", abc),
+	}, diffConfigurations(current, config))
+
+	current.RedactTokens = false
+	for _, change := range diffConfigurations(current, config) {
+		for _, token := range []string{"abc", "def", "ghi", "jkl"} {
+			assert.NotContains(s.T(), change, token)
+		}
+	}
+}
@@ -1,8 +1,60 @@
 package responsewriter
 
-import "net/http"
+import (
+	"net/http"
+	"time"
+)
 
 type RateLimiterResponseWriter interface {
 	WriteResponse(w *http.ResponseWriter) error
 	WriteError(w *http.ResponseWriter, err error) error
 }
+
+// RateLimiterDecisionResponseWriter is a RateLimiterResponseWriter that also
+// gets the request and the decision. When the configured ResponseWriter
+// implements it, WriteDecisionResponse and WriteRequestError are used instead
+// of WriteResponse and WriteError.
+type RateLimiterDecisionResponseWriter interface {
+	RateLimiterResponseWriter
+	WriteDecisionResponse(w *http.ResponseWriter, r *http.Request, decision *RateLimiterDecision) error
+	WriteRequestError(w *http.ResponseWriter, r *http.Request, err error) error
+}
+
+// Reasons of a RateLimiterDecision.
+const (
+	// ReasonRateLimited is a request over one of its limits.
+	ReasonRateLimited = "rate_limited"
+	// ReasonDenied is a request whose IP or token is in the denylist.
+	ReasonDenied = "denied"
+	// ReasonUnknownToken is a request with a token that is not known, with
+	// UnknownTokens set to "reject".
+	ReasonUnknownToken = "unknown_token"
+)
+
+// RateLimiterDecision describes why a request was rejected and, when it was
+// rate limited, the limit that blocked it.
+type RateLimiterDecision struct {
+	// Reason is ReasonRateLimited, ReasonDenied or ReasonUnknownToken. The
+	// limit fields are only set with ReasonRateLimited.
+	Reason string
+	// StatusCode is the status code the rate limiter answers with when the
+	// response writer does not handle the decision: 429, the denied status
+	// code or 401.
+	StatusCode int
+	// KeyType is "IP" or "TOKEN".
+	KeyType string
+	// Key is the IP or token.
+	Key string
+	// RuleID is the ID of the rule whose limits were applied, if any.
+	RuleID string
+	// LimitName is the name of the limit that tripped.
+	LimitName string
+	// Limit is how many requests the limit allows at once.
+	Limit int64
+	// Remaining is how many requests are left, always zero when blocked.
+	Remaining int64
+	// Reset is when the limit is fully available again.
+	Reset time.Time
+	// BlockedUntil is when the block ends.
+	BlockedUntil *time.Time
+}
@@ -0,0 +1,232 @@
+package ratelimiter
+
+import (
+	"fmt"
+	"net/http"
+	"os"
+	"path"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+const PathTypePrefix = "prefix"
+const PathTypeGlob = "glob"
+const PathTypeRegex = "regex"
+
+// RateLimiterRule applies its own limits to the requests whose method and
+// path it matches. Rules have their own counters and blocks, kept apart by ID.
+type RateLimiterRule struct {
+	ID string `json:"id"`
+	// Methods matched by the rule. Empty matches any method.
+	Methods []string `json:"methods"`
+	// Path is a prefix, a glob (as in path.Match) or a regular expression,
+	// according to PathType.
+	Path     string `json:"path"`
+	PathType string `json:"pathType"`
+	// IP and Token replace the IP and token limits for the matched requests.
+	// When nil, the global limits and counters are used.
+	IP    *RateLimiterRateConfig `json:"ip"`
+	Token *RateLimiterRateConfig `json:"token"`
+
+	pathRegexp *regexp.Regexp
+}
+
+// GetPathType returns the path type, defaulting to prefix.
+func (r *RateLimiterRule) GetPathType() string {
+	if r.PathType == "" {
+		return PathTypePrefix
+	}
+	return r.PathType
+}
+
+func (r *RateLimiterRule) matches(request *http.Request) bool {
+	if len(r.Methods) > 0 {
+		methodMatches := false
+		for _, method := range r.Methods {
+			if strings.EqualFold(method, request.Method) {
+				methodMatches = true
+				break
+			}
+		}
+		if !methodMatches {
+			return false
+		}
+	}
+
+	switch r.GetPathType() {
+	case PathTypePrefix:
+		return strings.HasPrefix(request.URL.Path, r.Path)
+	case PathTypeGlob:
+		matched, _ := path.Match(r.Path, request.URL.Path)
+		return matched
+	case PathTypeRegex:
+		return r.pathRegexp != nil && r.pathRegexp.MatchString(request.URL.Path)
+	default:
+		return false
+	}
+}
+
+// validate checks the rule without changing it, so it is safe to call on a
+// rule in use.
+func (r *RateLimiterRule) validate() error {
+	_, err := r.compile()
+	return err
+}
+
+// configure checks the rule and stores its compiled regular expression.
+func (r *RateLimiterRule) configure() error {
+	pathRegexp, err := r.compile()
+	if err != nil {
+		return err
+	}
+	r.pathRegexp = pathRegexp
+	return nil
+}
+
+// compile checks the rule and returns its compiled regular expression, which
+// is nil when the path is not a regex.
+func (r *RateLimiterRule) compile() (*regexp.Regexp, error) {
+	if r.ID == "" {
+		return nil, fmt.Errorf("rule for path \"%s\" has no id", r.Path)
+	}
+	if strings.ContainsAny(r.ID, keyTypeSeparators) {
+		return nil, fmt.Errorf("rule \"%s\" has an id with \"@\" or \":\"", r.ID)
+	}
+
+	switch r.GetPathType() {
+	case PathTypePrefix:
+		return nil, nil
+	case PathTypeGlob:
+		_, err := path.Match(r.Path, "")
+		if err != nil {
+			return nil, fmt.Errorf("rule \"%s\" has an invalid glob \"%s\"", r.ID, r.Path)
+		}
+		return nil, nil
+	case PathTypeRegex:
+		pathRegexp, err := regexp.Compile(r.Path)
+		if err != nil {
+			return nil, fmt.Errorf("rule \"%s\" has an invalid regex \"%s\": %s", r.ID, r.Path, err)
+		}
+		return pathRegexp, nil
+	default:
+		return nil, fmt.Errorf("rule \"%s\" has an unknown path type \"%s\"", r.ID, r.PathType)
+	}
+}
+
+// getRule returns the first rule matching the request, or nil.
+func getRule(config *RateLimiterConfig, r *http.Request) *RateLimiterRule {
+	for _, rule := range config.Rules {
+		if rule.matches(r) {
+			return rule
+		}
+	}
+	return nil
+}
+
+// getRuleKeyType appends the rule ID to the key type, e.g. "IP@login".
+func getRuleKeyType(keyType string, rule *RateLimiterRule) string {
+	return fmt.Sprintf("%s@%s", keyType, rule.ID)
+}
+
+// keyTypeSeparators separate the rule ID and the limit name in storage key
+// types, so they are not allowed in them.
+const keyTypeSeparators = "@:"
+
+// splitKeyType returns the key type and the rule ID of a storage key type,
+// which may carry a rule and a limit name, as in "TOKEN@login:minute".
+func splitKeyType(keyType string) (string, string) {
+	keyType, ruleAndLimit, _ := strings.Cut(keyType, "@")
+	keyType, _, _ = strings.Cut(keyType, ":")
+	ruleID, _, _ := strings.Cut(ruleAndLimit, ":")
+	return keyType, ruleID
+}
+
+func configureRules(config *RateLimiterConfig) {
+	if !config.DisableEnvs {
+		for _, ruleID := range getRuleList() {
+			configureRuleFromEnvs(config, ruleID)
+		}
+	}
+
+	rules := []*RateLimiterRule{}
+	for _, rule := range config.Rules {
+		if rule == nil {
+			continue
+		}
+		err := rule.configure()
+		if err != nil {
+			addConfigurationProblem(config, "rule: %s", err)
+			continue
+		}
+		rules = append(rules, rule)
+	}
+	config.Rules = rules
+}
+
+// getRuleList returns the IDs of the rules defined by RATE_LIMITER_RULE_<ID>_PATH
+// envs, sorted, since that is the order they are matched in.
+func getRuleList() []string {
+	envKeyRegex := regexp.MustCompile(fmt.Sprintf("^%s_(.+)%s$", envKeyRulePrefix, envKeySuffixRulePath))
+
+	ruleIDs := []string{}
+	for _, env := range os.Environ() {
+		envKey, _, _ := strings.Cut(env, "=")
+		if envKeyRegex.MatchString(envKey) {
+			ruleIDs = append(ruleIDs, envKeyRegex.FindStringSubmatch(envKey)[1])
+		}
+	}
+	sort.Strings(ruleIDs)
+
+	return ruleIDs
+}
+
+// configureRuleFromEnvs creates or updates a rule. Its limits start from the
+// global ones and are only created if an env for them is defined.
+func configureRuleFromEnvs(config *RateLimiterConfig, ruleID string) {
+	config.GetLogger().Debug("configuring rule from envs", "rule", ruleID)
+
+	var rule *RateLimiterRule
+	for _, existingRule := range config.Rules {
+		if existingRule != nil && existingRule.ID == ruleID {
+			rule = existingRule
+		}
+	}
+	if rule == nil {
+		rule = &RateLimiterRule{ID: ruleID}
+		config.Rules = append(config.Rules, rule)
+	}
+
+	envKeyPrefix := fmt.Sprintf("%s_%s", envKeyRulePrefix, ruleID)
+
+	rulePath, ok := getStringEnv(envKeyPrefix + envKeySuffixRulePath)
+	if ok {
+		rule.Path = rulePath
+	}
+
+	pathType, ok := getStringEnv(envKeyPrefix + envKeySuffixRulePathType)
+	if ok {
+		rule.PathType = pathType
+	}
+
+	methods, ok := getStringListEnv(envKeyPrefix + envKeySuffixRuleMethods)
+	if ok {
+		rule.Methods = methods
+	}
+
+	if hasEnvWithPrefix(envKeyPrefix + "_IP_") {
+		if rule.IP == nil {
+			ipConfig := *config.IP
+			rule.IP = &ipConfig
+		}
+		configureRateConfigFromEnvs(config, rule.IP, envKeyPrefix+"_IP")
+	}
+
+	if hasEnvWithPrefix(envKeyPrefix + "_TOKEN_") {
+		if rule.Token == nil {
+			tokenConfig := *config.Token
+			rule.Token = &tokenConfig
+		}
+		configureRateConfigFromEnvs(config, rule.Token, envKeyPrefix+"_TOKEN")
+	}
+}
@@ -0,0 +1,156 @@
+package ratelimiter
+
+import (
+	"encoding/json"
+	"net/http/httptest"
+	"os"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/suite"
+)
+
+type RulesTestSuite struct {
+	suite.Suite
+}
+
+func TestRulesTestSuite(t *testing.T) {
+	suite.Run(t, new(RulesTestSuite))
+}
+
+func (s *RulesTestSuite) SetupTest() {
+	os.Unsetenv("RATE_LIMITER_RULE_login_PATH")
+	os.Unsetenv("RATE_LIMITER_RULE_login_METHODS")
+	os.Unsetenv("RATE_LIMITER_RULE_login_IP_MAX_REQUESTS")
+	os.Unsetenv("RATE_LIMITER_RULE_export_PATH")
+	os.Unsetenv("RATE_LIMITER_RULE_export_PATH_TYPE")
+	os.Unsetenv("RATE_LIMITER_RULE_export_TOKEN_MAX_REQUESTS")
+}
+
+func (s *RulesTestSuite) TearDownTest() {
+	s.SetupTest()
+}
+
+func (s *RulesTestSuite) TestMatches_Prefix() {
+	rule := &RateLimiterRule{ID: "api", Path: "/api/"}
+	assert.Nil(s.T(), rule.configure())
+
+	assert.True(s.T(), rule.matches(httptest.NewRequest("GET", "http://testing/api/users", nil)))
+	assert.False(s.T(), rule.matches(httptest.NewRequest("GET", "http://testing/apix", nil)))
+}
+
+func (s *RulesTestSuite) TestMatches_Glob() {
+	rule := &RateLimiterRule{ID: "export", Path: "/reports/*/export", PathType: PathTypeGlob}
+	assert.Nil(s.T(), rule.configure())
+
+	assert.True(s.T(), rule.matches(httptest.NewRequest("GET", "http://testing/reports/42/export", nil)))
+	assert.False(s.T(), rule.matches(httptest.NewRequest("GET", "http://testing/reports/42/43/export", nil)))
+}
+
+func (s *RulesTestSuite) TestMatches_Regex() {
+	rule := &RateLimiterRule{ID: "users", Path: `^/users/\d+$`, PathType: PathTypeRegex}
+	assert.Nil(s.T(), rule.configure())
+
+	assert.True(s.T(), rule.matches(httptest.NewRequest("GET", "http://testing/users/42", nil)))
+	assert.False(s.T(), rule.matches(httptest.NewRequest("GET", "http://testing/users/abc", nil)))
+}
+
+func (s *RulesTestSuite) TestMatches_Methods() {
+	rule := &RateLimiterRule{ID: "login", Path: "/login", Methods: []string{"post", "PUT"}}
+	assert.Nil(s.T(), rule.configure())
+
+	assert.True(s.T(), rule.matches(httptest.NewRequest("POST", "http://testing/login", nil)))
+	assert.True(s.T(), rule.matches(httptest.NewRequest("PUT", "http://testing/login", nil)))
+	assert.False(s.T(), rule.matches(httptest.NewRequest("GET", "http://testing/login", nil)))
+}
+
+func (s *RulesTestSuite) TestValidate_Invalid() {
+	assert.NotNil(s.T(), (&RateLimiterRule{Path: "/login"}).validate())
+	assert.NotNil(s.T(), (&RateLimiterRule{ID: "a", Path: "[", PathType: PathTypeGlob}).validate())
+	assert.NotNil(s.T(), (&RateLimiterRule{ID: "a", Path: "(", PathType: PathTypeRegex}).validate())
+	assert.NotNil(s.T(), (&RateLimiterRule{ID: "a", Path: "/", PathType: "exact"}).validate())
+	assert.EqualError(s.T(), (&RateLimiterRule{ID: "a@b", Path: "/"}).validate(), `rule "a@b" has an id with "@" or ":"`)
+	assert.EqualError(s.T(), (&RateLimiterRule{ID: "a:b", Path: "/"}).validate(), `rule "a:b" has an id with "@" or ":"`)
+}
+
+func (s *RulesTestSuite) TestValidate_DoesNotChangeRule() {
+	rule := &RateLimiterRule{ID: "users", Path: `^/users/\d+$`, PathType: PathTypeRegex}
+	assert.Nil(s.T(), rule.validate())
+	assert.Nil(s.T(), rule.pathRegexp)
+
+	config := setConfiguration(&RateLimiterConfig{Rules: []*RateLimiterRule{rule}, DisableEnvs: true})
+	pathRegexp := config.Rules[0].pathRegexp
+	assert.NotNil(s.T(), pathRegexp)
+
+	assert.Nil(s.T(), config.Validate())
+	assert.Same(s.T(), pathRegexp, config.Rules[0].pathRegexp)
+}
+
+func (s *RulesTestSuite) TestGetRule_FirstMatch() {
+	config := &RateLimiterConfig{
+		Rules: []*RateLimiterRule{
+			{ID: "login", Path: "/login", Methods: []string{"POST"}},
+			{ID: "all", Path: "/"},
+			{ID: "invalid", Path: "(", PathType: PathTypeRegex},
+		},
+		DisableEnvs: true,
+	}
+	configureRules(config)
+
+	assert.Len(s.T(), config.Rules, 2)
+	assert.Equal(s.T(), "login", getRule(config, httptest.NewRequest("POST", "http://testing/login", nil)).ID)
+	assert.Equal(s.T(), "all", getRule(config, httptest.NewRequest("GET", "http://testing/login", nil)).ID)
+
+	config.Rules = config.Rules[:1]
+	assert.Nil(s.T(), getRule(config, httptest.NewRequest("GET", "http://testing/", nil)))
+}
+
+func (s *RulesTestSuite) TestConfigureRules_FromEnv() {
+	os.Setenv("RATE_LIMITER_RULE_login_PATH", "/login")
+	os.Setenv("RATE_LIMITER_RULE_login_METHODS", "POST")
+	os.Setenv("RATE_LIMITER_RULE_login_IP_MAX_REQUESTS", "5")
+	os.Setenv("RATE_LIMITER_RULE_export_PATH", "/reports/*/export")
+	os.Setenv("RATE_LIMITER_RULE_export_PATH_TYPE", "glob")
+	os.Setenv("RATE_LIMITER_RULE_export_TOKEN_MAX_REQUESTS", "2")
+
+	config := &RateLimiterConfig{
+		IP:    &RateLimiterRateConfig{MaxRequestsPerSecond: 100, BlockTimeMilliseconds: 1000},
+		Token: &RateLimiterRateConfig{MaxRequestsPerSecond: 200, BlockTimeMilliseconds: 500},
+		Rules: []*RateLimiterRule{{ID: "login", Path: "/signin"}},
+	}
+	configureRules(config)
+
+	assert.Len(s.T(), config.Rules, 2)
+
+	login := config.Rules[0]
+	assert.Equal(s.T(), "/login", login.Path)
+	assert.Equal(s.T(), []string{"POST"}, login.Methods)
+	assert.Equal(s.T(), int64(5), login.IP.MaxRequestsPerSecond)
+	assert.Equal(s.T(), int64(1000), login.IP.BlockTimeMilliseconds)
+	assert.Nil(s.T(), login.Token)
+	assert.Equal(s.T(), int64(100), config.IP.MaxRequestsPerSecond)
+
+	export := config.Rules[1]
+	assert.Equal(s.T(), "export", export.ID)
+	assert.Equal(s.T(), PathTypeGlob, export.PathType)
+	assert.Nil(s.T(), export.IP)
+	assert.Equal(s.T(), int64(2), export.Token.MaxRequestsPerSecond)
+}
+
+func (s *RulesTestSuite) TestConfigureRules_FromJSON() {
+	config := &RateLimiterConfig{}
+	err := json.Unmarshal([]byte(`{
+		"rules": [
+			{"id": "login", "methods": ["POST"], "path": "/login", "ip": {"maxRequestsPerSecond": 5, "blockTimeMilliseconds": 60000}},
+			{"id": "users", "path": "^/users/\\d+$", "pathType": "regex"}
+		]
+	}`), config)
+	assert.Nil(s.T(), err)
+
+	config.DisableEnvs = true
+	configureRules(config)
+
+	assert.Len(s.T(), config.Rules, 2)
+	assert.Equal(s.T(), int64(5), config.Rules[0].IP.MaxRequestsPerSecond)
+	assert.Equal(s.T(), "users", getRule(config, httptest.NewRequest("GET", "http://testing/users/42", nil)).ID)
+}
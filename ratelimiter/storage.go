@@ -0,0 +1,99 @@
+package ratelimiter
+
+import (
+	"context"
+	"time"
+
+	"github.com/arfurlaneto/goexpert-challenge-rate-limiter/ratelimiter/adapter"
+)
+
+// The storage adapter is called through these functions, so that each call
+// is measured and traced.
+
+// startStorageCall starts the span of a storage adapter call. The returned
+// function ends it and reports the latency.
+func startStorageCall(ctx context.Context, config *RateLimiterConfig, operation string) (context.Context, func(err error)) {
+	start := time.Now()
+	ctx, span := startSpan(ctx, config, storageSpanNamePrefix+operation)
+	return ctx, func(err error) {
+		config.GetMetrics().StorageLatency(operation, time.Since(start))
+		endSpan(span, err)
+	}
+}
+
+func storageGetBlock(ctx context.Context, config *RateLimiterConfig, keyType string, key string) (*time.Time, error) {
+	ctx, end := startStorageCall(ctx, config, "GetBlock")
+	block, err := config.StorageAdapter.GetBlock(ctx, keyType, key)
+	end(err)
+	return block, err
+}
+
+func storageAddBlock(ctx context.Context, config *RateLimiterConfig, keyType string, key string, milliseconds int64) (*time.Time, error) {
+	ctx, end := startStorageCall(ctx, config, "AddBlock")
+	block, err := config.StorageAdapter.AddBlock(ctx, keyType, key, milliseconds)
+	end(err)
+	return block, err
+}
+
+func storageIncrementAccesses(ctx context.Context, config *RateLimiterConfig, keyType string, key string, maxAccesses int64) (bool, int64, error) {
+	ctx, end := startStorageCall(ctx, config, "IncrementAccesses")
+	success, count, err := config.StorageAdapter.IncrementAccesses(ctx, keyType, key, maxAccesses)
+	end(err)
+	return success, count, err
+}
+
+func storageIncrementWindowAccesses(ctx context.Context, config *RateLimiterConfig, windowStorageAdapter adapter.RateLimitWindowStorageAdapter, keyType string, key string, maxAccesses int64, windowMilliseconds int64) (bool, int64, error) {
+	ctx, end := startStorageCall(ctx, config, "IncrementWindowAccesses")
+	success, count, err := windowStorageAdapter.IncrementWindowAccesses(ctx, keyType, key, maxAccesses, windowMilliseconds)
+	end(err)
+	return success, count, err
+}
+
+func storageConsumeBucketToken(ctx context.Context, config *RateLimiterConfig, bucketStorageAdapter adapter.RateLimitBucketStorageAdapter, keyType string, key string, capacity int64, refillRatePerSecond int64) (bool, int64, error) {
+	ctx, end := startStorageCall(ctx, config, "ConsumeBucketToken")
+	success, remaining, err := bucketStorageAdapter.ConsumeBucketToken(ctx, keyType, key, capacity, refillRatePerSecond)
+	end(err)
+	return success, remaining, err
+}
+
+func storageConsumeGCRA(ctx context.Context, config *RateLimiterConfig, gcraStorageAdapter adapter.RateLimitGCRAStorageAdapter, keyType string, key string, maxRequests int64, periodMilliseconds int64) (bool, int64, error) {
+	ctx, end := startStorageCall(ctx, config, "ConsumeGCRA")
+	success, remaining, err := gcraStorageAdapter.ConsumeGCRA(ctx, keyType, key, maxRequests, periodMilliseconds)
+	end(err)
+	return success, remaining, err
+}
+
+func storageRefundAccess(ctx context.Context, config *RateLimiterConfig, refundStorageAdapter adapter.RateLimitRefundStorageAdapter, keyType string, key string) error {
+	ctx, end := startStorageCall(ctx, config, "RefundAccess")
+	err := refundStorageAdapter.RefundAccess(ctx, keyType, key)
+	end(err)
+	return err
+}
+
+func storageRefundBucketToken(ctx context.Context, config *RateLimiterConfig, refundStorageAdapter adapter.RateLimitRefundStorageAdapter, keyType string, key string, capacity int64) error {
+	ctx, end := startStorageCall(ctx, config, "RefundBucketToken")
+	err := refundStorageAdapter.RefundBucketToken(ctx, keyType, key, capacity)
+	end(err)
+	return err
+}
+
+func storageRefundGCRA(ctx context.Context, config *RateLimiterConfig, refundStorageAdapter adapter.RateLimitRefundStorageAdapter, keyType string, key string, maxRequests int64, periodMilliseconds int64) error {
+	ctx, end := startStorageCall(ctx, config, "RefundGCRA")
+	err := refundStorageAdapter.RefundGCRA(ctx, keyType, key, maxRequests, periodMilliseconds)
+	end(err)
+	return err
+}
+
+func storageCheckAccesses(ctx context.Context, config *RateLimiterConfig, atomicStorageAdapter adapter.RateLimitAtomicStorageAdapter, key string, limits []adapter.AccessLimit) (*adapter.AccessCheckResult, error) {
+	ctx, end := startStorageCall(ctx, config, "CheckAccesses")
+	result, err := atomicStorageAdapter.CheckAccesses(ctx, key, limits)
+	end(err)
+	return result, err
+}
+
+func storageGetTokenPlan(ctx context.Context, config *RateLimiterConfig, planStorageAdapter adapter.RateLimitPlanStorageAdapter, token string) (*adapter.TokenPlan, error) {
+	ctx, end := startStorageCall(ctx, config, "GetTokenPlan")
+	tokenPlan, err := planStorageAdapter.GetTokenPlan(ctx, token)
+	end(err)
+	return tokenPlan, err
+}
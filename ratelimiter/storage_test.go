@@ -0,0 +1,54 @@
+package ratelimiter
+
+import (
+	"context"
+	"testing"
+
+	"github.com/arfurlaneto/goexpert-challenge-rate-limiter/ratelimiter/adapter"
+	"github.com/arfurlaneto/goexpert-challenge-rate-limiter/ratelimiter/mocks"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/suite"
+	"go.uber.org/mock/gomock"
+)
+
+type StorageTestSuite struct {
+	suite.Suite
+	controller *gomock.Controller
+	context    context.Context
+}
+
+func TestStorageTestSuite(t *testing.T) {
+	suite.Run(t, new(StorageTestSuite))
+}
+
+func (s *StorageTestSuite) SetupTest() {
+	s.controller = gomock.NewController(s.T())
+	s.context = context.Background()
+}
+
+func (s *StorageTestSuite) TestStorageLatency() {
+	metricsMock := mocks.NewMockRateLimiterMetrics(s.controller)
+	config := &RateLimiterConfig{StorageAdapter: adapter.NewRateLimitMemoryStorageAdapter(), Metrics: metricsMock}
+
+	operations := []string{}
+	metricsMock.EXPECT().StorageLatency(gomock.Any(), gomock.Any()).Do(func(operation string, duration any) {
+		operations = append(operations, operation)
+	}).AnyTimes()
+
+	rateConfig := &RateLimiterRateConfig{MaxRequestsPerSecond: 1, BlockTimeMilliseconds: 1000}
+	for i := 0; i < 2; i++ {
+		_, err := checkRateLimit(s.context, "IP", "127.0.0.1", config, rateConfig)
+		assert.Nil(s.T(), err)
+	}
+
+	assert.Equal(s.T(), []string{"CheckAccesses", "CheckAccesses"}, operations)
+
+	operations = []string{}
+	rateConfig = &RateLimiterRateConfig{MaxRequestsPerSecond: 1, BlockTimeMilliseconds: 1000, Algorithm: AlgorithmTokenBucket}
+	for i := 0; i < 2; i++ {
+		_, err := checkRateLimit(s.context, "TOKEN", "abc", config, rateConfig)
+		assert.Nil(s.T(), err)
+	}
+
+	assert.Equal(s.T(), []string{"GetBlock", "ConsumeBucketToken", "GetBlock", "ConsumeBucketToken", "AddBlock"}, operations)
+}
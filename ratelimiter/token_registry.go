@@ -0,0 +1,12 @@
+package ratelimiter
+
+import "context"
+
+// isStoredToken tells if a token is in the TokenStore. Custom tokens and
+// tokens on a plan are known without asking it.
+func isStoredToken(ctx context.Context, config *RateLimiterConfig, token string) (bool, error) {
+	if config.TokenStore == nil {
+		return false, nil
+	}
+	return config.TokenStore.HasToken(ctx, token)
+}
@@ -0,0 +1,111 @@
+package ratelimiter
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/arfurlaneto/goexpert-challenge-rate-limiter/ratelimiter/mocks"
+	"github.com/arfurlaneto/goexpert-challenge-rate-limiter/ratelimiter/tokenstore"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/suite"
+	"go.uber.org/mock/gomock"
+)
+
+type TokenRegistryTestSuite struct {
+	suite.Suite
+	controller *gomock.Controller
+	context    context.Context
+}
+
+func TestTokenRegistryTestSuite(t *testing.T) {
+	suite.Run(t, new(TokenRegistryTestSuite))
+}
+
+func (s *TokenRegistryTestSuite) SetupTest() {
+	s.controller = gomock.NewController(s.T())
+	s.context = context.Background()
+	os.Unsetenv(envUnknownTokens)
+	os.Unsetenv(envTokenStore)
+	os.Unsetenv(envRedisAddress)
+}
+
+func (s *TokenRegistryTestSuite) TearDownTest() {
+	s.SetupTest()
+}
+
+func (s *TokenRegistryTestSuite) TestIsStoredToken() {
+	config := &RateLimiterConfig{}
+
+	stored, err := isStoredToken(s.context, config, "abc")
+	assert.Nil(s.T(), err)
+	assert.False(s.T(), stored)
+
+	config.TokenStore = tokenstore.NewMemoryTokenStore("abc")
+	stored, err = isStoredToken(s.context, config, "abc")
+	assert.Nil(s.T(), err)
+	assert.True(s.T(), stored)
+
+	stored, err = isStoredToken(s.context, config, "def")
+	assert.Nil(s.T(), err)
+	assert.False(s.T(), stored)
+}
+
+func (s *TokenRegistryTestSuite) TestIsStoredToken_StoreError() {
+	tokenStoreMock := mocks.NewMockRateLimiterTokenStore(s.controller)
+	tokenStoreMock.EXPECT().HasToken(s.context, "def").Return(false, errors.New("store error"))
+
+	config := &RateLimiterConfig{TokenStore: tokenStoreMock}
+
+	_, err := isStoredToken(s.context, config, "def")
+	assert.NotNil(s.T(), err)
+}
+
+func (s *TokenRegistryTestSuite) TestGetUnknownTokens() {
+	assert.Equal(s.T(), UnknownTokensAllow, (&RateLimiterConfig{}).GetUnknownTokens())
+	assert.Equal(s.T(), UnknownTokensAllow, (&RateLimiterConfig{UnknownTokens: "drop"}).GetUnknownTokens())
+	assert.Equal(s.T(), UnknownTokensReject, (&RateLimiterConfig{UnknownTokens: UnknownTokensReject}).GetUnknownTokens())
+	assert.Equal(s.T(), UnknownTokensAsIP, (&RateLimiterConfig{UnknownTokens: UnknownTokensAsIP}).GetUnknownTokens())
+}
+
+func (s *TokenRegistryTestSuite) TestSetConfiguration_FromEnv() {
+	path := filepath.Join(s.T().TempDir(), "tokens")
+	os.WriteFile(path, []byte("abc\n"), 0644)
+
+	os.Setenv(envUnknownTokens, "reject")
+	os.Setenv(envTokenStore, "file:"+path)
+
+	config := setConfiguration(nil)
+	assert.Equal(s.T(), UnknownTokensReject, config.UnknownTokens)
+	assert.NotNil(s.T(), config.TokenStore)
+
+	known, err := config.TokenStore.HasToken(s.context, "abc")
+	assert.Nil(s.T(), err)
+	assert.True(s.T(), known)
+}
+
+func (s *TokenRegistryTestSuite) TestSetConfiguration_RedisFromEnv() {
+	os.Setenv(envTokenStore, "redis:api-keys")
+	os.Setenv(envRedisAddress, "localhost:6379")
+
+	config := setConfiguration(nil)
+	assert.NotNil(s.T(), config.TokenStore)
+}
+
+func (s *TokenRegistryTestSuite) TestSetConfiguration_InvalidEnv() {
+	os.Setenv(envUnknownTokens, "drop")
+	os.Setenv(envTokenStore, "file:"+filepath.Join(s.T().TempDir(), "missing"))
+
+	config := setConfiguration(nil)
+	assert.Equal(s.T(), "", config.UnknownTokens)
+	assert.Nil(s.T(), config.TokenStore)
+}
+
+func (s *TokenRegistryTestSuite) TestParseTokenStore_Invalid() {
+	for _, value := range []string{"file", "file:", "memory", ""} {
+		_, err := parseTokenStore(&RateLimiterConfig{}, value)
+		assert.NotNil(s.T(), err, value)
+	}
+}
@@ -0,0 +1,85 @@
+package tokenextractor
+
+import (
+	"net/http"
+	"strings"
+)
+
+const DefaultHeaderName = "API_KEY"
+
+type headerTokenExtractor struct {
+	name string
+}
+
+// NewHeaderTokenExtractor reads the token from the header with the given name.
+func NewHeaderTokenExtractor(name string) *headerTokenExtractor {
+	return &headerTokenExtractor{name: name}
+}
+
+func (e *headerTokenExtractor) ExtractToken(r *http.Request) string {
+	return r.Header.Get(e.name)
+}
+
+type bearerTokenExtractor struct{}
+
+// NewBearerTokenExtractor reads the token from an "Authorization: Bearer <token>" header.
+func NewBearerTokenExtractor() *bearerTokenExtractor {
+	return &bearerTokenExtractor{}
+}
+
+func (e *bearerTokenExtractor) ExtractToken(r *http.Request) string {
+	scheme, token, ok := strings.Cut(r.Header.Get("Authorization"), " ")
+	if !ok || !strings.EqualFold(scheme, "Bearer") {
+		return ""
+	}
+	return strings.TrimSpace(token)
+}
+
+type queryTokenExtractor struct {
+	name string
+}
+
+// NewQueryTokenExtractor reads the token from the query parameter with the given name.
+func NewQueryTokenExtractor(name string) *queryTokenExtractor {
+	return &queryTokenExtractor{name: name}
+}
+
+func (e *queryTokenExtractor) ExtractToken(r *http.Request) string {
+	return r.URL.Query().Get(e.name)
+}
+
+type cookieTokenExtractor struct {
+	name string
+}
+
+// NewCookieTokenExtractor reads the token from the cookie with the given name.
+func NewCookieTokenExtractor(name string) *cookieTokenExtractor {
+	return &cookieTokenExtractor{name: name}
+}
+
+func (e *cookieTokenExtractor) ExtractToken(r *http.Request) string {
+	cookie, err := r.Cookie(e.name)
+	if err != nil {
+		return ""
+	}
+	return cookie.Value
+}
+
+type chainTokenExtractor struct {
+	extractors []RateLimiterTokenExtractor
+}
+
+// NewChainTokenExtractor returns the first token found by the extractors, in order.
+func NewChainTokenExtractor(extractors ...RateLimiterTokenExtractor) *chainTokenExtractor {
+	return &chainTokenExtractor{extractors: extractors}
+}
+
+func (e *chainTokenExtractor) ExtractToken(r *http.Request) string {
+	for _, extractor := range e.extractors {
+		token := extractor.ExtractToken(r)
+		if token != "" {
+			return token
+		}
+	}
+	return ""
+}
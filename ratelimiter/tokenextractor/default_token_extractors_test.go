@@ -0,0 +1,81 @@
+package tokenextractor
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/suite"
+)
+
+type DefaultTokenExtractorsTestSuite struct {
+	suite.Suite
+}
+
+func TestDefaultTokenExtractorsTestSuite(t *testing.T) {
+	suite.Run(t, new(DefaultTokenExtractorsTestSuite))
+}
+
+func (s *DefaultTokenExtractorsTestSuite) TestHeaderTokenExtractor() {
+	request := httptest.NewRequest("GET", "http://testing", nil)
+	request.Header.Add("X-Api-Key", "abc")
+
+	assert.Equal(s.T(), "abc", NewHeaderTokenExtractor("X-API-KEY").ExtractToken(request))
+	assert.Equal(s.T(), "", NewHeaderTokenExtractor(DefaultHeaderName).ExtractToken(request))
+}
+
+func (s *DefaultTokenExtractorsTestSuite) TestBearerTokenExtractor() {
+	request := httptest.NewRequest("GET", "http://testing", nil)
+	request.Header.Add("Authorization", "bearer abc")
+	assert.Equal(s.T(), "abc", NewBearerTokenExtractor().ExtractToken(request))
+
+	request = httptest.NewRequest("GET", "http://testing", nil)
+	request.Header.Add("Authorization", "Basic dXNlcjpwYXNz")
+	assert.Equal(s.T(), "", NewBearerTokenExtractor().ExtractToken(request))
+
+	request = httptest.NewRequest("GET", "http://testing", nil)
+	assert.Equal(s.T(), "", NewBearerTokenExtractor().ExtractToken(request))
+}
+
+func (s *DefaultTokenExtractorsTestSuite) TestQueryTokenExtractor() {
+	request := httptest.NewRequest("GET", "http://testing/?api_key=abc", nil)
+
+	assert.Equal(s.T(), "abc", NewQueryTokenExtractor("api_key").ExtractToken(request))
+	assert.Equal(s.T(), "", NewQueryTokenExtractor("token").ExtractToken(request))
+}
+
+func (s *DefaultTokenExtractorsTestSuite) TestCookieTokenExtractor() {
+	request := httptest.NewRequest("GET", "http://testing", nil)
+	request.AddCookie(&http.Cookie{Name: "api_key", Value: "abc"})
+
+	assert.Equal(s.T(), "abc", NewCookieTokenExtractor("api_key").ExtractToken(request))
+	assert.Equal(s.T(), "", NewCookieTokenExtractor("token").ExtractToken(request))
+}
+
+func (s *DefaultTokenExtractorsTestSuite) TestChainTokenExtractor() {
+	extractor := NewChainTokenExtractor(
+		NewHeaderTokenExtractor(DefaultHeaderName),
+		NewBearerTokenExtractor(),
+		NewQueryTokenExtractor("api_key"),
+	)
+
+	request := httptest.NewRequest("GET", "http://testing/?api_key=query", nil)
+	request.Header.Add("Authorization", "Bearer bearer")
+	assert.Equal(s.T(), "bearer", extractor.ExtractToken(request))
+
+	request.Header.Add(DefaultHeaderName, "header")
+	assert.Equal(s.T(), "header", extractor.ExtractToken(request))
+
+	request = httptest.NewRequest("GET", "http://testing", nil)
+	assert.Equal(s.T(), "", extractor.ExtractToken(request))
+}
+
+func (s *DefaultTokenExtractorsTestSuite) TestTokenExtractorFunc() {
+	extractor := RateLimiterTokenExtractorFunc(func(r *http.Request) string {
+		return r.URL.Query().Get("tenant")
+	})
+
+	request := httptest.NewRequest("GET", "http://testing/?tenant=acme", nil)
+	assert.Equal(s.T(), "acme", extractor.ExtractToken(request))
+}
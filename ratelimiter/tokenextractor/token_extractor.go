@@ -0,0 +1,17 @@
+package tokenextractor
+
+import "net/http"
+
+// RateLimiterTokenExtractor returns the token of a request, or an empty string
+// when the request has no token and must be limited by IP.
+type RateLimiterTokenExtractor interface {
+	ExtractToken(r *http.Request) string
+}
+
+// RateLimiterTokenExtractorFunc lets an ordinary function be used as a
+// RateLimiterTokenExtractor.
+type RateLimiterTokenExtractorFunc func(r *http.Request) string
+
+func (f RateLimiterTokenExtractorFunc) ExtractToken(r *http.Request) string {
+	return f(r)
+}
@@ -0,0 +1,35 @@
+package tokenstore
+
+import (
+	"bufio"
+	"os"
+	"strings"
+)
+
+// NewFileTokenStore loads the tokens of a file, one per line. Empty lines and
+// lines starting with # are ignored.
+func NewFileTokenStore(path string) (*memoryTokenStore, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	store := NewMemoryTokenStore()
+
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		token := strings.TrimSpace(scanner.Text())
+		if token == "" || strings.HasPrefix(token, "#") {
+			continue
+		}
+		store.AddToken(token)
+	}
+
+	err = scanner.Err()
+	if err != nil {
+		return nil, err
+	}
+
+	return store, nil
+}
@@ -0,0 +1,40 @@
+package tokenstore
+
+import (
+	"context"
+	"sync"
+)
+
+type memoryTokenStore struct {
+	mutex  sync.RWMutex
+	tokens map[string]bool
+}
+
+func NewMemoryTokenStore(tokens ...string) *memoryTokenStore {
+	store := &memoryTokenStore{tokens: map[string]bool{}}
+	for _, token := range tokens {
+		store.tokens[token] = true
+	}
+	return store
+}
+
+func (s *memoryTokenStore) HasToken(ctx context.Context, token string) (bool, error) {
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+
+	return s.tokens[token], nil
+}
+
+func (s *memoryTokenStore) AddToken(token string) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	s.tokens[token] = true
+}
+
+func (s *memoryTokenStore) RemoveToken(token string) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	delete(s.tokens, token)
+}
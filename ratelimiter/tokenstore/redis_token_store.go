@@ -0,0 +1,37 @@
+package tokenstore
+
+import (
+	"context"
+
+	"github.com/redis/go-redis/v9"
+)
+
+const DefaultRedisTokenStoreKey = "rate-limiter-tokens"
+
+type redisTokenStore struct {
+	client redis.UniversalClient
+	key    string
+}
+
+// NewRedisTokenStore checks tokens against the members of the Redis set at key,
+// so tokens can be registered with SADD while servers are running.
+func NewRedisTokenStore(client redis.UniversalClient, key string) *redisTokenStore {
+	if key == "" {
+		key = DefaultRedisTokenStoreKey
+	}
+	return &redisTokenStore{client: client, key: key}
+}
+
+func (s *redisTokenStore) HasToken(ctx context.Context, token string) (bool, error) {
+	return s.client.SIsMember(ctx, s.key, token).Result()
+}
+
+// Ping checks that Redis is reachable.
+func (s *redisTokenStore) Ping(ctx context.Context) error {
+	return s.client.Ping(ctx).Err()
+}
+
+// Close closes the Redis client.
+func (s *redisTokenStore) Close() error {
+	return s.client.Close()
+}
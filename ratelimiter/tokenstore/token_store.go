@@ -0,0 +1,9 @@
+package tokenstore
+
+import "context"
+
+// RateLimiterTokenStore tells which tokens are registered. In token registry
+// mode, tokens that are neither custom tokens nor in the store are unknown.
+type RateLimiterTokenStore interface {
+	HasToken(ctx context.Context, token string) (bool, error)
+}
@@ -0,0 +1,100 @@
+package tokenstore
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/redis/go-redis/v9"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/suite"
+)
+
+type TokenStoreTestSuite struct {
+	suite.Suite
+	context context.Context
+}
+
+func TestTokenStoreTestSuite(t *testing.T) {
+	suite.Run(t, new(TokenStoreTestSuite))
+}
+
+func (s *TokenStoreTestSuite) SetupTest() {
+	s.context = context.Background()
+}
+
+func (s *TokenStoreTestSuite) TestMemoryTokenStore() {
+	store := NewMemoryTokenStore("abc")
+
+	known, err := store.HasToken(s.context, "abc")
+	assert.Nil(s.T(), err)
+	assert.True(s.T(), known)
+
+	known, _ = store.HasToken(s.context, "def")
+	assert.False(s.T(), known)
+
+	store.AddToken("def")
+	known, _ = store.HasToken(s.context, "def")
+	assert.True(s.T(), known)
+
+	store.RemoveToken("abc")
+	known, _ = store.HasToken(s.context, "abc")
+	assert.False(s.T(), known)
+}
+
+func (s *TokenStoreTestSuite) TestFileTokenStore() {
+	path := filepath.Join(s.T().TempDir(), "tokens")
+	os.WriteFile(path, []byte("# customers\nabc\n\n  def  \n"), 0644)
+
+	store, err := NewFileTokenStore(path)
+	assert.Nil(s.T(), err)
+
+	for token, expected := range map[string]bool{"abc": true, "def": true, "# customers": false, "": false} {
+		known, err := store.HasToken(s.context, token)
+		assert.Nil(s.T(), err)
+		assert.Equal(s.T(), expected, known, token)
+	}
+}
+
+func (s *TokenStoreTestSuite) TestFileTokenStore_MissingFile() {
+	_, err := NewFileTokenStore(filepath.Join(s.T().TempDir(), "missing"))
+	assert.NotNil(s.T(), err)
+}
+
+func (s *TokenStoreTestSuite) TestRedisTokenStore() {
+	server := miniredis.RunT(s.T())
+	client := redis.NewClient(&redis.Options{Addr: server.Addr()})
+	server.SAdd(DefaultRedisTokenStoreKey, "abc")
+
+	store := NewRedisTokenStore(client, "")
+
+	known, err := store.HasToken(s.context, "abc")
+	assert.Nil(s.T(), err)
+	assert.True(s.T(), known)
+
+	known, err = store.HasToken(s.context, "def")
+	assert.Nil(s.T(), err)
+	assert.False(s.T(), known)
+
+	server.Close()
+	_, err = store.HasToken(s.context, "abc")
+	assert.NotNil(s.T(), err)
+}
+
+func (s *TokenStoreTestSuite) TestRedisTokenStore_Ping() {
+	server := miniredis.RunT(s.T())
+	store := NewRedisTokenStore(redis.NewClient(&redis.Options{Addr: server.Addr()}), "")
+	assert.Nil(s.T(), store.Ping(s.context))
+
+	server.Close()
+	assert.NotNil(s.T(), store.Ping(s.context))
+}
+
+func (s *TokenStoreTestSuite) TestRedisTokenStore_Close() {
+	server := miniredis.RunT(s.T())
+	store := NewRedisTokenStore(redis.NewClient(&redis.Options{Addr: server.Addr()}), "")
+	assert.Nil(s.T(), store.Close())
+	assert.ErrorIs(s.T(), store.Ping(s.context), redis.ErrClosed)
+}
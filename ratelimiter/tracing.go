@@ -0,0 +1,57 @@
+package ratelimiter
+
+import (
+	"context"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// tracerName is the instrumentation scope of the rate limiter spans.
+const tracerName = "github.com/arfurlaneto/goexpert-challenge-rate-limiter/ratelimiter"
+
+const requestSpanName = "rate_limiter.request"
+const checkSpanName = "rate_limiter.check"
+const storageSpanNamePrefix = "rate_limiter.storage."
+
+// startSpan starts a span. Without a TracerProvider, the span records
+// nothing.
+func startSpan(ctx context.Context, config *RateLimiterConfig, name string, opts ...trace.SpanStartOption) (context.Context, trace.Span) {
+	return config.GetTracer().Start(ctx, name, opts...)
+}
+
+// startCheckSpan starts the span of a rate limit check. The key is not
+// recorded, as it may be a token.
+func startCheckSpan(ctx context.Context, config *RateLimiterConfig, keyType string) (context.Context, trace.Span) {
+	keyType, ruleID := splitKeyType(keyType)
+	return startSpan(ctx, config, checkSpanName, trace.WithAttributes(
+		attribute.String("rate_limiter.key_type", keyType),
+		attribute.String("rate_limiter.rule", ruleID),
+	))
+}
+
+// endCheckSpan records the decision of a rate limit check and ends its span.
+func endCheckSpan(span trace.Span, decision *rateLimitDecision, err error) {
+	if err == nil {
+		if decision.block != nil {
+			span.SetAttributes(attribute.String("rate_limiter.decision", "blocked"))
+		} else {
+			span.SetAttributes(attribute.String("rate_limiter.decision", "allowed"))
+		}
+		span.SetAttributes(attribute.Int64("rate_limiter.remaining", decision.remaining))
+		if decision.limit != nil {
+			span.SetAttributes(attribute.String("rate_limiter.limit", decision.limit.GetName()))
+		}
+	}
+	endSpan(span, err)
+}
+
+// endSpan ends a span, marking it as failed when there is an error.
+func endSpan(span trace.Span, err error) {
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+	}
+	span.End()
+}
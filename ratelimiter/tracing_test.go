@@ -0,0 +1,191 @@
+package ratelimiter
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/arfurlaneto/goexpert-challenge-rate-limiter/ratelimiter/adapter"
+	"github.com/arfurlaneto/goexpert-challenge-rate-limiter/ratelimiter/mocks"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/suite"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	"go.uber.org/mock/gomock"
+)
+
+type TracingTestSuite struct {
+	suite.Suite
+	controller     *gomock.Controller
+	context        context.Context
+	exporter       *tracetest.InMemoryExporter
+	tracerProvider *sdktrace.TracerProvider
+}
+
+func TestTracingTestSuite(t *testing.T) {
+	suite.Run(t, new(TracingTestSuite))
+}
+
+func (s *TracingTestSuite) SetupTest() {
+	s.controller = gomock.NewController(s.T())
+	s.context = context.Background()
+	s.exporter = tracetest.NewInMemoryExporter()
+	s.tracerProvider = sdktrace.NewTracerProvider(sdktrace.WithSyncer(s.exporter))
+}
+
+// getSpans returns the ended spans with the name.
+func (s *TracingTestSuite) getSpans(name string) tracetest.SpanStubs {
+	spans := tracetest.SpanStubs{}
+	for _, span := range s.exporter.GetSpans() {
+		if span.Name == name {
+			spans = append(spans, span)
+		}
+	}
+	return spans
+}
+
+func (s *TracingTestSuite) getAttributes(span tracetest.SpanStub) map[attribute.Key]attribute.Value {
+	attributes := map[attribute.Key]attribute.Value{}
+	for _, attr := range span.Attributes {
+		attributes[attr.Key] = attr.Value
+	}
+	return attributes
+}
+
+// getChildren returns the names of the children of a span.
+func (s *TracingTestSuite) getChildren(parent tracetest.SpanStub) []string {
+	children := []string{}
+	for _, span := range s.exporter.GetSpans() {
+		if span.Parent.SpanID() == parent.SpanContext.SpanID() {
+			children = append(children, span.Name)
+		}
+	}
+	return children
+}
+
+func (s *TracingTestSuite) TestCheckSpans() {
+	config := &RateLimiterConfig{StorageAdapter: adapter.NewRateLimitMemoryStorageAdapter(), TracerProvider: s.tracerProvider}
+	rateConfig := &RateLimiterRateConfig{Name: "second", MaxRequestsPerSecond: 2, BlockTimeMilliseconds: 1000, Algorithm: AlgorithmTokenBucket}
+
+	for i := 0; i < 3; i++ {
+		_, err := checkRateLimit(s.context, "TOKEN@login", "abc", config, rateConfig)
+		assert.Nil(s.T(), err)
+	}
+
+	checks := s.getSpans(checkSpanName)
+	assert.Len(s.T(), checks, 3)
+
+	attributes := s.getAttributes(checks[0])
+	assert.Equal(s.T(), "TOKEN", attributes["rate_limiter.key_type"].AsString())
+	assert.Equal(s.T(), "login", attributes["rate_limiter.rule"].AsString())
+	assert.Equal(s.T(), "allowed", attributes["rate_limiter.decision"].AsString())
+	assert.Equal(s.T(), int64(1), attributes["rate_limiter.remaining"].AsInt64())
+	assert.Equal(s.T(), "second", attributes["rate_limiter.limit"].AsString())
+	assert.NotContains(s.T(), attributes, attribute.Key("rate_limiter.key"))
+
+	attributes = s.getAttributes(checks[2])
+	assert.Equal(s.T(), "blocked", attributes["rate_limiter.decision"].AsString())
+	assert.Equal(s.T(), int64(0), attributes["rate_limiter.remaining"].AsInt64())
+
+	assert.Equal(s.T(), []string{"rate_limiter.storage.GetBlock", "rate_limiter.storage.ConsumeBucketToken"}, s.getChildren(checks[0]))
+	assert.Equal(s.T(), []string{"rate_limiter.storage.GetBlock", "rate_limiter.storage.ConsumeBucketToken", "rate_limiter.storage.AddBlock"}, s.getChildren(checks[2]))
+}
+
+func (s *TracingTestSuite) TestCheckSpans_Atomic() {
+	config := &RateLimiterConfig{StorageAdapter: adapter.NewRateLimitMemoryStorageAdapter(), TracerProvider: s.tracerProvider}
+	rateConfig := &RateLimiterRateConfig{MaxRequestsPerSecond: 1, BlockTimeMilliseconds: 1000}
+
+	for i := 0; i < 2; i++ {
+		_, err := checkRateLimit(s.context, "IP", "127.0.0.1", config, rateConfig)
+		assert.Nil(s.T(), err)
+	}
+
+	checks := s.getSpans(checkSpanName)
+	assert.Len(s.T(), checks, 2)
+	assert.Equal(s.T(), "IP", s.getAttributes(checks[0])["rate_limiter.key_type"].AsString())
+	assert.Equal(s.T(), "", s.getAttributes(checks[0])["rate_limiter.rule"].AsString())
+	assert.Equal(s.T(), "allowed", s.getAttributes(checks[0])["rate_limiter.decision"].AsString())
+	assert.Equal(s.T(), "blocked", s.getAttributes(checks[1])["rate_limiter.decision"].AsString())
+	assert.Equal(s.T(), []string{"rate_limiter.storage.CheckAccesses"}, s.getChildren(checks[1]))
+}
+
+func (s *TracingTestSuite) TestCheckSpans_Error() {
+	storageAdapterMock := mocks.NewMockRateLimitStorageAdapter(s.controller)
+	storageAdapterMock.EXPECT().GetBlock(gomock.Any(), "IP", "127.0.0.1").Return(nil, errors.New("storage is down"))
+
+	config := &RateLimiterConfig{StorageAdapter: storageAdapterMock, TracerProvider: s.tracerProvider}
+	_, err := checkRateLimit(s.context, "IP", "127.0.0.1", config, &RateLimiterRateConfig{MaxRequestsPerSecond: 1, BlockTimeMilliseconds: 1000})
+	assert.NotNil(s.T(), err)
+
+	for _, name := range []string{checkSpanName, "rate_limiter.storage.GetBlock"} {
+		spans := s.getSpans(name)
+		assert.Len(s.T(), spans, 1)
+		assert.Equal(s.T(), codes.Error, spans[0].Status.Code)
+		assert.Equal(s.T(), "storage is down", spans[0].Status.Description)
+		assert.Len(s.T(), spans[0].Events, 1)
+	}
+	assert.NotContains(s.T(), s.getAttributes(s.getSpans(checkSpanName)[0]), attribute.Key("rate_limiter.decision"))
+}
+
+func (s *TracingTestSuite) TestCheckSpans_RequestParent() {
+	config := setConfiguration(&RateLimiterConfig{StorageAdapter: adapter.NewRateLimitMemoryStorageAdapter(), TracerProvider: s.tracerProvider, DisableEnvs: true})
+	handler := rateLimiter(config, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(200)
+	}), checkRateLimit)
+
+	ctx, span := s.tracerProvider.Tracer("test").Start(s.context, "request")
+	handler.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", "http://testing/", nil).WithContext(ctx))
+	span.End()
+
+	requests := s.getSpans(requestSpanName)
+	assert.Len(s.T(), requests, 1)
+	assert.Equal(s.T(), span.SpanContext().TraceID(), requests[0].SpanContext.TraceID())
+	assert.Equal(s.T(), span.SpanContext().SpanID(), requests[0].Parent.SpanID())
+	assert.Equal(s.T(), []string{checkSpanName}, s.getChildren(requests[0]))
+}
+
+func (s *TracingTestSuite) TestRequestSpan_TokenStorageCalls() {
+	storageAdapter := adapter.NewRateLimitMemoryStorageAdapter()
+	config := setConfiguration(&RateLimiterConfig{StorageAdapter: storageAdapter, StoragePlans: true, TracerProvider: s.tracerProvider, DisableEnvs: true})
+	handler := rateLimiter(config, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(200)
+	}), checkRateLimit)
+
+	request := httptest.NewRequest("GET", "http://testing/", nil)
+	request.Header.Add("API_KEY", "xyz")
+	handler.ServeHTTP(httptest.NewRecorder(), request)
+
+	requests := s.getSpans(requestSpanName)
+	assert.Len(s.T(), requests, 1)
+	assert.False(s.T(), requests[0].Parent.IsValid())
+	assert.Equal(s.T(), []string{"rate_limiter.storage.GetTokenPlan", checkSpanName}, s.getChildren(requests[0]))
+}
+
+func (s *TracingTestSuite) TestWithoutTracerProvider() {
+	previous := otel.GetTracerProvider()
+	defer otel.SetTracerProvider(previous)
+	otel.SetTracerProvider(s.tracerProvider)
+
+	config := &RateLimiterConfig{StorageAdapter: adapter.NewRateLimitMemoryStorageAdapter()}
+	_, err := checkRateLimit(s.context, "IP", "127.0.0.1", config, &RateLimiterRateConfig{MaxRequestsPerSecond: 1, BlockTimeMilliseconds: 1000})
+	assert.Nil(s.T(), err)
+	assert.Empty(s.T(), s.exporter.GetSpans())
+
+	_, span := config.GetTracer().Start(s.context, "span")
+	assert.False(s.T(), span.IsRecording())
+}
+
+func (s *TracingTestSuite) TestGetTracer() {
+	config := &RateLimiterConfig{TracerProvider: s.tracerProvider}
+	_, span := config.GetTracer().Start(s.context, "span")
+	span.End()
+
+	spans := s.getSpans("span")
+	assert.Len(s.T(), spans, 1)
+	assert.Equal(s.T(), tracerName, spans[0].InstrumentationLibrary.Name)
+}
@@ -4,9 +4,13 @@ import (
 	"fmt"
 	"os"
 	"strconv"
+	"strings"
 	"time"
 )
 
+// DebugPrintf prints a debug message about a key to stdout when Debug is set.
+//
+// Deprecated: the rate limiter logs structured records to config.GetLogger().
 func DebugPrintf(config *RateLimiterConfig, format string, keyType string, key string, a ...any) (n int, err error) {
 	if config.Debug {
 		timeString := time.Now().UTC().Format("2006-01-02 15:04:05")
@@ -18,6 +22,9 @@ func DebugPrintf(config *RateLimiterConfig, format string, keyType string, key s
 	return 0, nil
 }
 
+// DebugPrintfWithoutKey prints a debug message to stdout when Debug is set.
+//
+// Deprecated: the rate limiter logs structured records to config.GetLogger().
 func DebugPrintfWithoutKey(config *RateLimiterConfig, format string, a ...any) (n int, err error) {
 	if config.Debug {
 		timeString := time.Now().UTC().Format("2006-01-02 15:04:05")
@@ -44,6 +51,30 @@ func getStringEnv(key string) (string, bool) {
 	return value, true
 }
 
+func hasEnvWithPrefix(prefix string) bool {
+	for _, env := range os.Environ() {
+		if strings.HasPrefix(env, prefix) {
+			return true
+		}
+	}
+	return false
+}
+
+func getStringListEnv(key string) ([]string, bool) {
+	value, ok := getStringEnv(key)
+	if !ok {
+		return []string{}, false
+	}
+	values := []string{}
+	for _, item := range strings.Split(value, ",") {
+		item = strings.TrimSpace(item)
+		if item != "" {
+			values = append(values, item)
+		}
+	}
+	return values, true
+}
+
 func getBoolEnv(key string) (bool, bool) {
 	value, ok := os.LookupEnv(key)
 	if !ok {
@@ -73,3 +104,11 @@ func getInt64Env(key string) (int64, bool) {
 	}
 	return parsed, true
 }
+
+// addConfigurationProblem reports an invalid value that is ignored. Problems
+// are returned by NewValidatedRateLimiter.
+func addConfigurationProblem(config *RateLimiterConfig, format string, a ...any) {
+	err := fmt.Errorf(format, a...)
+	config.problems = append(config.problems, err)
+	config.GetLogger().Warn("ignoring invalid configuration value", "error", err)
+}
@@ -0,0 +1,182 @@
+package ratelimiter
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/arfurlaneto/goexpert-challenge-rate-limiter/ratelimiter/adapter"
+	"github.com/arfurlaneto/goexpert-challenge-rate-limiter/ratelimiter/tokenstore"
+)
+
+// pinger is implemented by storage adapters and token stores that can check
+// their connection, like the Redis ones.
+type pinger interface {
+	Ping(ctx context.Context) error
+}
+
+var intEnvKeys = []string{
+	envTrustedProxyHops,
+	envIPv4PrefixLength,
+	envIPv6PrefixLength,
+	envKeyMaxTokensPerIPPrefix,
+	envDeniedStatusCode,
+	envRedisDB,
+	envMemoryCleanupInterval,
+	envMemoryMaxKeys,
+	envMemoryShards,
+}
+
+var intEnvKeySuffixes = []string{
+	envKeySuffixMaxRequests,
+	envKeySuffixBlockTime,
+	envKeySuffixWindowTime,
+	envKeySuffixBucketCapacity,
+	envKeySuffixRefillRate,
+}
+
+var boolEnvKeys = []string{
+	envKeyDebug,
+	envLegacyHeaders,
+	envRedactTokens,
+	envEnforceIPAndToken,
+	envUseRedis,
+	envRedisCluster,
+	envStoragePlans,
+}
+
+// NewValidatedRateLimiter creates a rate limiter like NewRateLimiterWithConfig,
+// but fails instead of ignoring configuration problems or panicking. See
+// NewValidatedReloadableRateLimiter.
+func NewValidatedRateLimiter(ctx context.Context, config *RateLimiterConfig) (func(next http.Handler) http.Handler, error) {
+	limiter, err := NewValidatedReloadableRateLimiter(ctx, config)
+	if err != nil {
+		return nil, err
+	}
+	return limiter.Handler, nil
+}
+
+// NewValidatedReloadableRateLimiter creates a reloadable rate limiter and
+// returns every configuration problem at once: env values that cannot be
+// parsed, invalid values that would be ignored, a missing Redis address,
+// validation errors and a Redis (or any storage adapter or token store with
+// a Ping method) that cannot be reached within ctx. On errors, the storage
+// adapter and token store it created are closed, not the ones of config.
+func NewValidatedReloadableRateLimiter(ctx context.Context, config *RateLimiterConfig) (*RateLimiter, error) {
+	var storageAdapter adapter.RateLimitStorageAdapter
+	var tokenStore tokenstore.RateLimiterTokenStore
+	if config == nil {
+		config = getDefaultConfiguration()
+	} else {
+		storageAdapter = config.StorageAdapter
+		tokenStore = config.TokenStore
+	}
+
+	errs := []error{}
+	if !config.DisableEnvs {
+		errs = append(errs, getInvalidEnvs()...)
+	}
+
+	config.collectProblems = true
+	config = setConfiguration(config)
+	config.collectProblems = false
+	errs = append(errs, config.problems...)
+
+	err := config.Validate()
+	if err != nil {
+		errs = append(errs, err)
+	}
+
+	storageAdapterPinger, ok := config.StorageAdapter.(pinger)
+	if ok {
+		err := storageAdapterPinger.Ping(ctx)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("storage adapter is unreachable: %w", err))
+		}
+	}
+
+	tokenStorePinger, ok := config.TokenStore.(pinger)
+	if ok {
+		err := tokenStorePinger.Ping(ctx)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("token store is unreachable: %w", err))
+		}
+	}
+
+	if len(errs) > 0 {
+		if config.StorageAdapter != storageAdapter {
+			closeIfCloser(config.StorageAdapter)
+		}
+		if config.TokenStore != tokenStore {
+			closeIfCloser(config.TokenStore)
+		}
+		return nil, errors.Join(errs...)
+	}
+
+	limiter := &RateLimiter{}
+	limiter.config.Store(config)
+	return limiter, nil
+}
+
+// closeIfCloser closes a storage adapter or token store that can be closed,
+// like the Redis ones.
+func closeIfCloser(value any) {
+	closer, ok := value.(io.Closer)
+	if ok {
+		closer.Close()
+	}
+}
+
+// getInvalidEnvs returns an error for each rate limiter env whose value cannot
+// be parsed as the integer or boolean it must be. Those envs are otherwise
+// ignored.
+func getInvalidEnvs() []error {
+	errs := []error{}
+	for _, env := range os.Environ() {
+		key, value, _ := strings.Cut(env, "=")
+		if !strings.HasPrefix(key, "RATE_LIMITER_") || value == "" {
+			continue
+		}
+
+		if isIntEnvKey(key) {
+			_, err := strconv.ParseInt(value, 10, 64)
+			if err != nil {
+				errs = append(errs, fmt.Errorf("env %s: \"%s\" is not an integer", key, value))
+			}
+		} else if isBoolEnvKey(key) {
+			_, err := strconv.ParseBool(value)
+			if err != nil {
+				errs = append(errs, fmt.Errorf("env %s: \"%s\" is not a boolean", key, value))
+			}
+		}
+	}
+	return errs
+}
+
+func isIntEnvKey(key string) bool {
+	for _, intEnvKey := range intEnvKeys {
+		if key == intEnvKey {
+			return true
+		}
+	}
+	for _, suffix := range intEnvKeySuffixes {
+		if strings.HasSuffix(key, suffix) {
+			return true
+		}
+	}
+	return false
+}
+
+func isBoolEnvKey(key string) bool {
+	for _, boolEnvKey := range boolEnvKeys {
+		if key == boolEnvKey {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,141 @@
+package ratelimiter
+
+import (
+	"context"
+	"os"
+	"testing"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/arfurlaneto/goexpert-challenge-rate-limiter/ratelimiter/adapter"
+	"github.com/redis/go-redis/v9"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/suite"
+)
+
+type ValidatedRateLimiterTestSuite struct {
+	suite.Suite
+	context context.Context
+}
+
+func TestValidatedRateLimiterTestSuite(t *testing.T) {
+	suite.Run(t, new(ValidatedRateLimiterTestSuite))
+}
+
+func (s *ValidatedRateLimiterTestSuite) SetupTest() {
+	s.context = context.Background()
+	os.Unsetenv(envKeyIPMaxRequestsPerSecond)
+	os.Unsetenv(envKeyDebug)
+	os.Unsetenv(envMemoryShards)
+	os.Unsetenv(envUseRedis)
+	os.Unsetenv(envRedisAddress)
+	os.Unsetenv(envUnknownTokens)
+	os.Unsetenv("RATE_LIMITER_TOKEN_abc_BLOCK_TIME")
+	os.Unsetenv("RATE_LIMITER_TOKEN_abc_ALGORITHM")
+}
+
+func (s *ValidatedRateLimiterTestSuite) TearDownTest() {
+	s.SetupTest()
+}
+
+func (s *ValidatedRateLimiterTestSuite) TestNewValidatedRateLimiter() {
+	middleware, err := NewValidatedRateLimiter(s.context, nil)
+	assert.Nil(s.T(), err)
+	assert.NotNil(s.T(), middleware)
+
+	limiter, err := NewValidatedReloadableRateLimiter(s.context, &RateLimiterConfig{DisableEnvs: true})
+	assert.Nil(s.T(), err)
+	assert.Equal(s.T(), int64(100), limiter.GetConfig().IP.MaxRequestsPerSecond)
+}
+
+func (s *ValidatedRateLimiterTestSuite) TestNewValidatedRateLimiter_InvalidEnvs() {
+	os.Setenv(envKeyIPMaxRequestsPerSecond, "ten")
+	os.Setenv(envKeyDebug, "maybe")
+	os.Setenv(envMemoryShards, "1.5")
+	os.Setenv(envUnknownTokens, "drop")
+	os.Setenv("RATE_LIMITER_TOKEN_abc_BLOCK_TIME", "1s")
+	os.Setenv("RATE_LIMITER_TOKEN_abc_ALGORITHM", "leaky_bucket")
+
+	middleware, err := NewValidatedRateLimiter(s.context, nil)
+	assert.Nil(s.T(), middleware)
+	assert.ErrorContains(s.T(), err, `env RATE_LIMITER_IP_MAX_REQUESTS: "ten" is not an integer`)
+	assert.ErrorContains(s.T(), err, `env RATE_LIMITER_DEBUG: "maybe" is not a boolean`)
+	assert.ErrorContains(s.T(), err, `env RATE_LIMITER_MEMORY_SHARDS: "1.5" is not an integer`)
+	assert.ErrorContains(s.T(), err, `env RATE_LIMITER_TOKEN_abc_BLOCK_TIME: "1s" is not an integer`)
+	assert.ErrorContains(s.T(), err, "env RATE_LIMITER_UNKNOWN_TOKENS: expected allow, reject or ip")
+	assert.ErrorContains(s.T(), err, `tokens.abc.algorithm: must be sliding_window, token_bucket or gcra, got "leaky_bucket"`)
+}
+
+func (s *ValidatedRateLimiterTestSuite) TestNewValidatedRateLimiter_EnvsDisabled() {
+	os.Setenv(envKeyIPMaxRequestsPerSecond, "ten")
+
+	_, err := NewValidatedRateLimiter(s.context, &RateLimiterConfig{DisableEnvs: true})
+	assert.Nil(s.T(), err)
+}
+
+func (s *ValidatedRateLimiterTestSuite) TestNewValidatedRateLimiter_MissingRedisAddress() {
+	os.Setenv(envUseRedis, "true")
+
+	_, err := NewValidatedRateLimiter(s.context, nil)
+	assert.ErrorContains(s.T(), err, "RATE_LIMITER_REDIS_ADDRESS env is required")
+}
+
+func (s *ValidatedRateLimiterTestSuite) TestNewValidatedRateLimiter_Redis() {
+	server := miniredis.RunT(s.T())
+	config := &RateLimiterConfig{Redis: &RateLimiterRedisConfig{Addresses: []string{server.Addr()}}, DisableEnvs: true}
+
+	_, err := NewValidatedRateLimiter(s.context, config)
+	assert.Nil(s.T(), err)
+
+	address := server.Addr()
+	server.Close()
+	config = &RateLimiterConfig{Redis: &RateLimiterRedisConfig{Addresses: []string{address}}, DisableEnvs: true}
+
+	_, err = NewValidatedRateLimiter(s.context, config)
+	assert.ErrorContains(s.T(), err, "storage adapter is unreachable")
+	assert.ErrorIs(s.T(), config.StorageAdapter.(pinger).Ping(s.context), redis.ErrClosed)
+}
+
+// closeRecordingStorageAdapter records whether it was closed.
+type closeRecordingStorageAdapter struct {
+	adapter.RateLimitStorageAdapter
+	closed bool
+}
+
+func (a *closeRecordingStorageAdapter) Close() error {
+	a.closed = true
+	return nil
+}
+
+func (s *ValidatedRateLimiterTestSuite) TestNewValidatedRateLimiter_KeepsGivenStorageAdapterOpen() {
+	storageAdapter := &closeRecordingStorageAdapter{RateLimitStorageAdapter: adapter.NewRateLimitMemoryStorageAdapter()}
+	config := &RateLimiterConfig{
+		IP:             &RateLimiterRateConfig{MaxRequestsPerSecond: -1, BlockTimeMilliseconds: 1000},
+		StorageAdapter: storageAdapter,
+		DisableEnvs:    true,
+	}
+
+	_, err := NewValidatedRateLimiter(s.context, config)
+	assert.ErrorContains(s.T(), err, "ip.maxRequestsPerSecond")
+	assert.False(s.T(), storageAdapter.closed)
+}
+
+func (s *ValidatedRateLimiterTestSuite) TestNewValidatedRateLimiter_IgnoredValues() {
+	config := &RateLimiterConfig{
+		Rules:          []*RateLimiterRule{{ID: "export", Path: "(", PathType: PathTypeRegex}},
+		AccessListFile: "/missing/access-list",
+		DisableEnvs:    true,
+	}
+
+	_, err := NewValidatedRateLimiter(s.context, config)
+	assert.ErrorContains(s.T(), err, "rule: ")
+	assert.ErrorContains(s.T(), err, "access list file: ")
+}
+
+func (s *ValidatedRateLimiterTestSuite) TestGetInvalidEnvs() {
+	os.Setenv(envKeyIPMaxRequestsPerSecond, "10")
+	os.Setenv(envKeyDebug, "true")
+	assert.Empty(s.T(), getInvalidEnvs())
+
+	os.Setenv(envKeyIPMaxRequestsPerSecond, "10.0")
+	assert.Len(s.T(), getInvalidEnvs(), 1)
+}